@@ -0,0 +1,46 @@
+package main
+
+import (
+    "log"
+    "strings"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends/fanout"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+    "github.com/spf13/pflag"
+)
+
+// Each backend_*.go file defines a backend's options and registers it in
+// an init function, so adding a new one doesn't touch main.go. Programs
+// embedding the pool can register their own with backends.Register too.
+
+// DescribeBackends lists the registered backends in --backend's usage
+func describeBackends() {
+    flag := pflag.Lookup("backend")
+    flag.Usage = "The database to load: " + strings.Join(backends.Names(), ", ")
+}
+
+// OpenBackend configures the backend chosen with --backend, along with the
+// classifier for its errors. If --fan-out names other backends too, each
+// job is written to all of them.
+func openBackend() (backends.Backend, pool.ErrorClassifier) {
+
+    if *fanOut == "" {
+        database, classify, err := backends.Open(*backend)
+        if err != nil {
+            log.Fatal(err)
+        }
+        return database, classify
+    }
+
+    fan := &fanout.Connector{}
+    for _, name := range append([]string{*backend}, strings.Split(*fanOut, ",")...) {
+        database, classify, err := backends.Open(name)
+        if err != nil {
+            log.Fatal(err)
+        }
+        fan.Targets = append(fan.Targets, fanout.Target{Name: name, Backend: database, Classify: classify})
+    }
+    return fan, fan.Classifier()
+
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+    "strings"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends/cassandra"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+    "github.com/spf13/pflag"
+)
+
+// Cassandra's options
+var cassandraHosts *string = pflag.String("cassandra-hosts", "localhost", "A comma separated list of the Cassandra or Scylla cluster's seed nodes")
+var cassandraKeyspace *string = pflag.String("cassandra-keyspace", "worker_test", "The keyspace to write to, which is created if it doesn't exist")
+var cassandraConsistency *string = pflag.String("cassandra-consistency", "", "The consistency level of the writes, e.g. ONE or LOCAL_QUORUM (default is QUORUM)")
+
+// Register the Cassandra backend, chosen with --backend=cassandra
+func init() {
+    backends.Register("cassandra", func() (backends.Backend, pool.ErrorClassifier, error) {
+        keyspace := *cassandraKeyspace
+        schema := []string{
+            "CREATE KEYSPACE IF NOT EXISTS " + keyspace + " WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}",
+            "CREATE TABLE IF NOT EXISTS " + keyspace + ".warmup (email text PRIMARY KEY, name text, link text)",
+        }
+        for _, table := range collectionNames() {
+            schema = append(schema, "CREATE TABLE IF NOT EXISTS "+keyspace+"."+table+" (email text PRIMARY KEY, name text, link text)")
+        }
+        if *dedup == "db" {
+            schema = append(schema, "CREATE TABLE IF NOT EXISTS "+keyspace+"."+dedupCollection+" (idempotency_key text PRIMARY KEY)")
+        }
+        return &cassandra.Connector{
+            Hosts:       strings.Split(*cassandraHosts, ","),
+            Keyspace:    keyspace,
+            Consistency: *cassandraConsistency,
+            Schema:      schema,
+        }, cassandra.Classify, nil
+    })
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+    "strings"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends/clickhouse"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+    "github.com/spf13/pflag"
+)
+
+// ClickHouse's options
+var clickhouseURLs *string = pflag.String("clickhouse-urls", "http://localhost:8123", "A comma separated list of the URLs of the ClickHouse servers' HTTP interfaces")
+var clickhouseDatabase *string = pflag.String("clickhouse-database", "default", "The ClickHouse database to write to")
+var clickhouseUsername *string = pflag.String("clickhouse-username", "", "The username to authenticate to ClickHouse with")
+var clickhousePassword *string = pflag.String("clickhouse-password", "", "The password to authenticate to ClickHouse with")
+var clickhouseBatchSize *int = pflag.Int("clickhouse-batch-size", clickhouse.DefaultBatchSize, "The number of rows each worker buffers before sending them to ClickHouse in one INSERT")
+
+// Register the ClickHouse backend, chosen with --backend=clickhouse
+func init() {
+    backends.Register("clickhouse", func() (backends.Backend, pool.ErrorClassifier, error) {
+        schema := []string{"CREATE TABLE IF NOT EXISTS warmup (name String, email String, link String) ENGINE = MergeTree ORDER BY email"}
+        for _, table := range collectionNames() {
+            schema = append(schema, "CREATE TABLE IF NOT EXISTS "+table+" (name String, email String, link String) ENGINE = MergeTree ORDER BY email")
+        }
+        return &clickhouse.Connector{
+            URLs:           strings.Split(*clickhouseURLs, ","),
+            Database:       *clickhouseDatabase,
+            Username:       *clickhouseUsername,
+            Password:       *clickhousePassword,
+            BatchSize:      *clickhouseBatchSize,
+            MaxConnections: int(*maxConnections),
+            Schema:         schema,
+        }, clickhouse.Classify, nil
+    })
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends/dynamodb"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+    "github.com/spf13/pflag"
+)
+
+// DynamoDB's options
+var dynamoRegion *string = pflag.String("dynamodb-region", "", "The AWS region of the DynamoDB tables (default is the one configured in the environment)")
+var dynamoEndpoint *string = pflag.String("dynamodb-endpoint", "", "Send requests to this endpoint instead of DynamoDB's, e.g. http://localhost:8000 for DynamoDB Local")
+var dynamoPrefix *string = pflag.String("dynamodb-table-prefix", "", "Prefix the names of the tables written to, which must already exist, with this")
+
+// Register the DynamoDB backend, chosen with --backend=dynamodb
+func init() {
+    backends.Register("dynamodb", func() (backends.Backend, pool.ErrorClassifier, error) {
+        return &dynamodb.Connector{
+            Region:      *dynamoRegion,
+            Endpoint:    *dynamoEndpoint,
+            TablePrefix: *dynamoPrefix,
+        }, dynamodb.Classify, nil
+    })
+}
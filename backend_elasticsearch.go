@@ -0,0 +1,27 @@
+package main
+
+import (
+    "strings"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends/elasticsearch"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+    "github.com/spf13/pflag"
+)
+
+// Elasticsearch's options
+var elasticURLs *string = pflag.String("elasticsearch-urls", "http://localhost:9200", "A comma separated list of the Elasticsearch or OpenSearch nodes' URLs")
+var elasticUsername *string = pflag.String("elasticsearch-username", "", "The username to authenticate to Elasticsearch with")
+var elasticPassword *string = pflag.String("elasticsearch-password", "", "The password to authenticate to Elasticsearch with")
+
+// Register the Elasticsearch backend, chosen with --backend=elasticsearch
+func init() {
+    backends.Register("elasticsearch", func() (backends.Backend, pool.ErrorClassifier, error) {
+        return &elasticsearch.Connector{
+            URLs:           strings.Split(*elasticURLs, ","),
+            Username:       *elasticUsername,
+            Password:       *elasticPassword,
+            MaxConnections: int(*maxConnections),
+        }, elasticsearch.Classify, nil
+    })
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends/grpcapi"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+    "github.com/spf13/pflag"
+)
+
+// The gRPC service's options
+var grpcTarget *string = pflag.String("grpc-target", "localhost:50051", "The address of the gRPC server")
+var grpcMethod *string = pflag.String("grpc-method", "", "The unary method each job calls, as package.Service/Method, which is looked up with the server's reflection service")
+var grpcRequest *string = pflag.String("grpc-request", grpcapi.DefaultRequest, "The template of each job's request, as protobuf JSON, which can use .Collection, .Key and the .Document's fields")
+
+// Register the gRPC backend, chosen with --backend=grpc
+func init() {
+    backends.Register("grpc", func() (backends.Backend, pool.ErrorClassifier, error) {
+        return &grpcapi.Connector{
+            Target:  *grpcTarget,
+            Method:  *grpcMethod,
+            Request: *grpcRequest,
+        }, grpcapi.Classify, nil
+    })
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends/httpapi"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+    "github.com/spf13/pflag"
+)
+
+// The HTTP endpoint's options
+var httpMethod *string = pflag.String("http-method", "POST", "The method of each job's HTTP request")
+var httpURL *string = pflag.String("http-url", "http://localhost:8080/{{.Collection}}", "The template of the URL each job's HTTP request is sent to")
+var httpBody *string = pflag.String("http-body", httpapi.DefaultBody, "The template of each job's HTTP request body, which can use .Collection, .Key and the .Document's fields")
+var httpPingURL *string = pflag.String("http-ping-url", "", "A URL to GET to check the endpoint is up before sending jobs (default is not to check)")
+
+// Register the HTTP backend, chosen with --backend=http
+func init() {
+    backends.Register("http", func() (backends.Backend, pool.ErrorClassifier, error) {
+        return &httpapi.Connector{
+            Method:         *httpMethod,
+            URL:            *httpURL,
+            Body:           *httpBody,
+            PingURL:        *httpPingURL,
+            MaxConnections: int(*maxConnections),
+        }, httpapi.Classify, nil
+    })
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+    "strings"
+    "time"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends/kafka"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+    "github.com/spf13/pflag"
+)
+
+// Kafka's options
+var kafkaBrokers *string = pflag.String("kafka-brokers", "localhost:9092", "A comma separated list of the Kafka brokers to bootstrap from")
+var kafkaTopic *string = pflag.String("kafka-topic", "", "The topic to publish every message to (default is a topic named after each job's collection)")
+var kafkaPartitioner *string = pflag.String("kafka-partitioner", "hash", "How messages are assigned partitions: hash, murmur2, crc32, round-robin or least-bytes")
+var kafkaAcks *string = pflag.String("kafka-acks", "all", "The acknowledgement each message waits for: none, one or all")
+var kafkaLinger *time.Duration = pflag.Duration("kafka-linger", kafka.DefaultLinger, "How long the producer waits for more messages to fill a batch")
+var kafkaCreateTopics *bool = pflag.Bool("kafka-create-topics", false, "Create topics which don't exist when they're published to")
+
+// Register the Kafka backend, chosen with --backend=kafka
+func init() {
+    backends.Register("kafka", func() (backends.Backend, pool.ErrorClassifier, error) {
+        return &kafka.Connector{
+            Brokers:      strings.Split(*kafkaBrokers, ","),
+            Topic:        *kafkaTopic,
+            Partitioner:  *kafkaPartitioner,
+            Acks:         *kafkaAcks,
+            Linger:       *kafkaLinger,
+            CreateTopics: *kafkaCreateTopics,
+        }, kafka.Classify, nil
+    })
+}
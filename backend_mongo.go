@@ -0,0 +1,119 @@
+package main
+
+import (
+    "log"
+    "strings"
+    "time"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends/documentdb"
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends/mongo"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+    "github.com/PaulMaddox/golang-db-pool-pattern/secrets"
+    "github.com/spf13/pflag"
+)
+
+// MongoDB's options
+var uri *string = pflag.String("uri", "", "A MongoDB connection string, e.g. mongodb://user:pass@h1,h2/db?replicaSet=rs0, which takes the place of --host (options given as flags override its settings)")
+var host *string = pflag.String("host", "localhost", "The MongoDB hostname to connect to, or a comma separated seed list of replica set members")
+var fallbackHosts *string = pflag.String("fallback-hosts", "", "Standby MongoDB clusters, separated by semicolons, to fail over to in turn when connecting keeps failing (each a host, seed list or connection string)")
+var failoverAfter *int = pflag.Int("failover-after", 3, "The number of failed attempts to connect in a row before failing over to the next of --fallback-hosts")
+var replicaSet *string = pflag.String("replica-set", "", "The name of the replica set the hosts belong to")
+var db *string = pflag.String("db", "worker-test", "The MongoDB database to use (default is the one in --uri, if it names one)")
+var username *string = pflag.String("username", "", "The user to authenticate to MongoDB as (default is no authentication)")
+var password *string = pflag.String("password", "", "The password to authenticate to MongoDB with (prefer --password-from, as this is visible in ps)")
+var passwordFrom *string = pflag.String("password-from", "", "Where to read the password from: env:NAME, file:PATH, or vault:PATH#KEY using VAULT_ADDR and VAULT_TOKEN")
+var authDb *string = pflag.String("auth-db", "", "The MongoDB database to authenticate against (default is admin)")
+var useTLS *bool = pflag.Bool("tls", false, "Connect to MongoDB over TLS")
+var tlsCA *string = pflag.String("tls-ca", "", "A PEM file of the certificate authorities to trust (default is the system's)")
+var tlsCert *string = pflag.String("tls-cert", "", "A PEM client certificate to present to the server")
+var tlsKey *string = pflag.String("tls-key", "", "The private key for --tls-cert")
+var tlsInsecure *bool = pflag.Bool("tls-insecure", false, "Skip verification of the server's certificate (for testing only)")
+var writeConcern *string = pflag.String("write-concern", "", "The number of members which must acknowledge each write, or a tag such as majority (default is the server's)")
+var journal *bool = pflag.Bool("journal", false, "Require writes to reach the on-disk journal before they are acknowledged")
+var wtimeout *time.Duration = pflag.Duration("wtimeout", 0, "How long to wait for --write-concern members to acknowledge a write (default is no limit)")
+var readPreference *string = pflag.String("read-preference", "", "The read preference mode, e.g. primary or secondaryPreferred (default is primary)")
+var dialTimeout *time.Duration = pflag.Duration("dial-timeout", 0, "The maximum time opening a connection to MongoDB may take (default is the driver's 30s)")
+var socketTimeout *time.Duration = pflag.Duration("socket-timeout", 0, "The maximum time a read or write on a MongoDB connection may block (default is no limit)")
+var serverSelectionTimeout *time.Duration = pflag.Duration("server-selection-timeout", 0, "The maximum time an operation waits for a suitable server, e.g. a new primary (default is the driver's 30s)")
+var sessionMode *string = pflag.String("session-mode", "shared", "Whether the workers share one client and its connection pool (shared), or each have a dedicated connection (per-worker)")
+var gridfsChunkSize *int32 = pflag.Int32("gridfs-chunk-size", 0, "The size of the chunks --object-size files are split into in GridFS, which bounds the memory each upload uses (default is 255KiB)")
+var documentDB *bool = pflag.Bool("documentdb", false, "Connect to Amazon DocumentDB, using TLS and the authentication it supports")
+var documentDBCA *string = pflag.String("documentdb-ca", documentdb.DefaultCAFile, "The Amazon CA bundle to verify DocumentDB's certificates with, unless --tls-ca is given")
+var awsIAM *bool = pflag.Bool("aws-iam", false, "Authenticate to DocumentDB with the AWS credentials in the environment, instead of --username and --password")
+
+// Register the MongoDB backend, chosen with --backend=mongo
+func init() {
+    backends.Register("mongo", func() (backends.Backend, pool.ErrorClassifier, error) {
+        return mongoConnector(), mongo.Classify, nil
+    })
+}
+
+// MongoConnector configures the MongoDB backend from the CLI parameters
+func mongoConnector() *mongo.Connector {
+
+    // A database named in --uri is used unless --db is given too
+    name := *db
+    if *uri != "" {
+        name = ""
+        pflag.Visit(func(f *pflag.Flag) {
+            if f.Name == "db" {
+                name = *db
+            }
+        })
+    }
+
+    var mode mongo.SessionMode
+    switch *sessionMode {
+    case "shared":
+        mode = mongo.Shared
+    case "per-worker":
+        mode = mongo.PerWorker
+    default:
+        log.Fatalf("Unknown --session-mode %q, expected shared or per-worker", *sessionMode)
+    }
+    c := &mongo.Connector{
+        URI:            *uri,
+        Host:           *host,
+        Database:       name,
+        ReplicaSet:     *replicaSet,
+        SessionMode:    mode,
+        MaxConnections: *maxConnections,
+        Username:       *username,
+        Password:       *password,
+        AuthDatabase:   *authDb,
+        ReadPreference: *readPreference,
+        ChunkSize:      *gridfsChunkSize,
+
+        DialTimeout:            *dialTimeout,
+        SocketTimeout:          *socketTimeout,
+        ServerSelectionTimeout: *serverSelectionTimeout,
+    }
+    if *fallbackHosts != "" {
+        c.FallbackHosts = strings.Split(*fallbackHosts, ";")
+        c.FailoverAfter = *failoverAfter
+    }
+    if *passwordFrom != "" {
+        provider, err := secrets.Parse(*passwordFrom)
+        if err != nil {
+            log.Fatal(err)
+        }
+        c.PasswordProvider = provider
+    }
+    if *writeConcern != "" || *journal || *wtimeout > 0 {
+        c.WriteConcern = &mongo.WriteConcern{W: *writeConcern, Journal: *journal, Timeout: *wtimeout}
+    }
+    if *useTLS {
+        c.TLS = &backends.TLS{
+            CAFile:             *tlsCA,
+            CertFile:           *tlsCert,
+            KeyFile:            *tlsKey,
+            InsecureSkipVerify: *tlsInsecure,
+        }
+    }
+    if *documentDB {
+        documentdb.Configure(c, *documentDBCA, *awsIAM)
+    }
+    return c
+
+}
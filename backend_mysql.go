@@ -0,0 +1,28 @@
+package main
+
+import (
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends/mysql"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+    "github.com/spf13/pflag"
+)
+
+// MySQL's options
+var mysqlDSN *string = pflag.String("mysql-dsn", "root@tcp(localhost:3306)/worker-test", "The MySQL data source name, as user:password@tcp(host:port)/database?param=value")
+
+// Register the MySQL backend, chosen with --backend=mysql
+func init() {
+    backends.Register("mysql", func() (backends.Backend, pool.ErrorClassifier, error) {
+        c := mysql.NewConnector(*mysqlDSN)
+        c.MaxConnections = int(*maxConnections)
+        c.TxSize = *txSize
+        c.Schema = []string{"CREATE TABLE IF NOT EXISTS warmup (name text, email text, link text)"}
+        for _, table := range collectionNames() {
+            c.Schema = append(c.Schema, "CREATE TABLE IF NOT EXISTS "+table+" (name text, email varchar(255) UNIQUE, link text)")
+        }
+        if *dedup == "db" {
+            c.Schema = append(c.Schema, "CREATE TABLE IF NOT EXISTS "+dedupCollection+" (idempotency_key varchar(255) PRIMARY KEY)")
+        }
+        return c, mysql.Classify, nil
+    })
+}
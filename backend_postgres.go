@@ -0,0 +1,28 @@
+package main
+
+import (
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends/postgres"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+    "github.com/spf13/pflag"
+)
+
+// PostgreSQL's options
+var dsn *string = pflag.String("dsn", "postgres://localhost/worker-test", "The PostgreSQL connection string, as a URL or key=value settings")
+
+// Register the PostgreSQL backend, chosen with --backend=postgres
+func init() {
+    backends.Register("postgres", func() (backends.Backend, pool.ErrorClassifier, error) {
+        c := postgres.NewConnector(*dsn)
+        c.MaxConnections = int(*maxConnections)
+        c.TxSize = *txSize
+        c.Schema = []string{`CREATE TABLE IF NOT EXISTS warmup (name text, email text, link text)`}
+        for _, table := range collectionNames() {
+            c.Schema = append(c.Schema, `CREATE TABLE IF NOT EXISTS `+table+` (name text, email text UNIQUE, link text)`)
+        }
+        if *dedup == "db" {
+            c.Schema = append(c.Schema, `CREATE TABLE IF NOT EXISTS `+dedupCollection+` (idempotency_key text PRIMARY KEY)`)
+        }
+        return c, postgres.Classify, nil
+    })
+}
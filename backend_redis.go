@@ -0,0 +1,32 @@
+package main
+
+import (
+    "strings"
+    "time"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends/redis"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+    "github.com/spf13/pflag"
+)
+
+// Redis's options
+var redisAddrs *string = pflag.String("redis-addrs", "localhost:6379", "The Redis server's host:port, or a comma separated list of cluster nodes")
+var redisPassword *string = pflag.String("redis-password", "", "The password to authenticate to Redis with")
+var redisDB *int = pflag.Int("redis-db", 0, "The Redis database number to use, outside a cluster")
+var redisStrings *bool = pflag.Bool("redis-strings", false, "Store each document as a JSON string with SET, rather than a hash with HSET")
+var redisTTL *time.Duration = pflag.Duration("redis-ttl", 0, "Expire the keys written after this long (default is never)")
+
+// Register the Redis backend, chosen with --backend=redis
+func init() {
+    backends.Register("redis", func() (backends.Backend, pool.ErrorClassifier, error) {
+        return &redis.Connector{
+            Addrs:          strings.Split(*redisAddrs, ","),
+            Password:       *redisPassword,
+            DB:             *redisDB,
+            Strings:        *redisStrings,
+            TTL:            *redisTTL,
+            MaxConnections: int(*maxConnections),
+        }, redis.Classify, nil
+    })
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends/s3"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+    "github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+    "github.com/spf13/pflag"
+)
+
+// S3's options
+var s3Bucket *string = pflag.String("s3-bucket", "worker-test", "The S3 bucket to upload objects to, which must exist")
+var s3Region *string = pflag.String("s3-region", "", "The AWS region of the S3 bucket (default is the one configured in the environment)")
+var s3Endpoint *string = pflag.String("s3-endpoint", "", "Send requests to this endpoint instead of S3's, for S3-compatible stores such as MinIO, addressing the bucket in the path")
+var s3PartSize *int64 = pflag.Int64("s3-part-size", manager.DefaultUploadPartSize, "Upload objects larger than this many bytes, at least 5MiB, in parts of this size")
+
+// Register the S3 backend, chosen with --backend=s3
+func init() {
+    backends.Register("s3", func() (backends.Backend, pool.ErrorClassifier, error) {
+        return &s3.Connector{
+            Bucket:    *s3Bucket,
+            Region:    *s3Region,
+            Endpoint:  *s3Endpoint,
+            PathStyle: *s3Endpoint != "",
+            PartSize:  *s3PartSize,
+        }, s3.Classify, nil
+    })
+}
@@ -0,0 +1,276 @@
+// Package cassandra implements the pool's Connector and Store for Apache
+// Cassandra and ScyllaDB, using gocql
+package cassandra
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "strings"
+    "sync"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+    "github.com/gocql/gocql"
+)
+
+// Connector holds the details of the cluster a pool's workers connect to.
+// The gocql session manages its own connections to every node, so the
+// Connector creates one session which every worker shares. Queries are
+// routed to a replica which owns the partition being written.
+type Connector struct {
+    // Hosts are the cluster's seed nodes
+    Hosts []string
+
+    // Keyspace is the keyspace the collections are tables in
+    Keyspace string
+
+    // Consistency is the consistency level of the writes, such as ONE or
+    // LOCAL_QUORUM, defaulting to gocql's (QUORUM)
+    Consistency string
+
+    // Username and Password authenticate to the cluster, if set
+    Username string
+    Password string
+
+    // Schema statements, such as CREATE KEYSPACE IF NOT EXISTS and CREATE
+    // TABLE IF NOT EXISTS, are run once before the session is created, so
+    // they must give the keyspace of each table they refer to
+    Schema []string
+
+    mu      sync.Mutex
+    session *gocql.Session
+}
+
+// Connect returns a Store for the worker, creating the shared session
+// first if this is the first worker to connect. The pool takes care of
+// retrying, with backoff, if the cluster can't be reached.
+func (c *Connector) Connect(ctx context.Context, workerId int) (pool.Store, error) {
+
+    session, err := c.dial()
+    if err != nil {
+        return nil, err
+    }
+    s := &Store{session: session}
+    if err := s.Ping(ctx); err != nil {
+        return nil, err
+    }
+    return s, nil
+
+}
+
+// Close closes the shared session once the pool has finished with it
+func (c *Connector) Close() error {
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if c.session != nil {
+        c.session.Close()
+        c.session = nil
+    }
+    return nil
+
+}
+
+// Dial creates the shared session the first time it's needed, setting up
+// the schema first
+func (c *Connector) dial() (*gocql.Session, error) {
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if c.session != nil && !c.session.Closed() {
+        return c.session, nil
+    }
+
+    log.Printf("Connecting to cassandra://%s/%s", strings.Join(c.Hosts, ","), c.Keyspace)
+    cluster := gocql.NewCluster(c.Hosts...)
+    cluster.PoolConfig.HostSelectionPolicy = gocql.TokenAwareHostPolicy(gocql.RoundRobinHostPolicy())
+    if c.Consistency != "" {
+        consistency, err := gocql.ParseConsistencyWrapper(c.Consistency)
+        if err != nil {
+            return nil, err
+        }
+        cluster.Consistency = consistency
+    }
+    if c.Username != "" {
+        cluster.Authenticator = gocql.PasswordAuthenticator{Username: c.Username, Password: c.Password}
+    }
+
+    // The keyspace may not exist until the schema has been set up
+    if len(c.Schema) > 0 {
+        session, err := cluster.CreateSession()
+        if err != nil {
+            return nil, err
+        }
+        defer session.Close()
+        for _, stmt := range c.Schema {
+            if err := session.Query(stmt).Exec(); err != nil {
+                return nil, err
+            }
+        }
+    }
+
+    cluster.Keyspace = c.Keyspace
+    session, err := cluster.CreateSession()
+    if err != nil {
+        return nil, err
+    }
+    c.session = session
+    return session, nil
+
+}
+
+// Store is a worker's handle on the shared session
+type Store struct {
+    session *gocql.Session
+}
+
+// Exec performs a backends operation against the cluster. gocql prepares
+// each distinct statement once, and uses the prepared statement's metadata
+// to send the write to a replica for its partition.
+func (s *Store) Exec(ctx context.Context, op any) (any, error) {
+
+    switch op := op.(type) {
+    case backends.Upsert:
+        // Writes to Cassandra always replace any existing row
+        return s.Exec(ctx, backends.Insert{Collection: op.Collection, Document: op.Document})
+    case backends.Insert:
+        columns, values, err := backends.Fields(op.Document)
+        if err != nil {
+            return nil, err
+        }
+        quoted := make([]string, len(columns))
+        params := make([]string, len(columns))
+        for i, column := range columns {
+            quoted[i] = quote(column)
+            params[i] = "?"
+        }
+        stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+            quote(op.Collection), strings.Join(quoted, ", "), strings.Join(params, ", "))
+        return nil, s.session.Query(stmt, values...).WithContext(ctx).Exec()
+    case backends.Count:
+        // Counting scans every partition, so it's only fit for checking a
+        // run afterwards
+        var n int64
+        err := s.session.Query("SELECT COUNT(*) FROM " + quote(op.Collection)).WithContext(ctx).Scan(&n)
+        return n, err
+    case backends.Find:
+        columns, values, err := backends.Fields(op.Filter)
+        if err != nil {
+            return nil, err
+        }
+        where := make([]string, len(columns))
+        for i, column := range columns {
+            where[i] = quote(column) + " = ?"
+        }
+        stmt := "SELECT * FROM " + quote(op.Collection)
+        if len(where) > 0 {
+            stmt += " WHERE " + strings.Join(where, " AND ")
+        }
+        doc := map[string]any{}
+        err = s.session.Query(stmt+" LIMIT 1", values...).WithContext(ctx).MapScan(doc)
+        if errors.Is(err, gocql.ErrNotFound) {
+            return nil, backends.ErrNotFound
+        }
+        if err != nil {
+            return nil, err
+        }
+        return doc, nil
+    case backends.Update:
+        set, setValues, err := backends.Fields(op.Set)
+        if err != nil {
+            return nil, err
+        }
+        where, whereValues, err := backends.Fields(op.Filter)
+        if err != nil {
+            return nil, err
+        }
+        assignments := make([]string, len(set))
+        for i, column := range set {
+            assignments[i] = quote(column) + " = ?"
+        }
+        conditions := make([]string, len(where))
+        for i, column := range where {
+            conditions[i] = quote(column) + " = ?"
+        }
+        stmt := fmt.Sprintf("UPDATE %s SET %s WHERE %s IF EXISTS",
+            quote(op.Collection), strings.Join(assignments, ", "), strings.Join(conditions, " AND "))
+        applied, err := s.session.Query(stmt, append(setValues, whereValues...)...).WithContext(ctx).MapScanCAS(map[string]any{})
+        if err != nil {
+            return nil, err
+        }
+        if !applied {
+            return nil, backends.ErrNotFound
+        }
+        return nil, nil
+    case backends.Delete:
+        columns, values, err := backends.Fields(op.Filter)
+        if err != nil {
+            return nil, err
+        }
+        conditions := make([]string, len(columns))
+        for i, column := range columns {
+            conditions[i] = quote(column) + " = ?"
+        }
+        stmt := fmt.Sprintf("DELETE FROM %s WHERE %s IF EXISTS", quote(op.Collection), strings.Join(conditions, " AND "))
+        applied, err := s.session.Query(stmt, values...).WithContext(ctx).MapScanCAS(map[string]any{})
+        if err != nil {
+            return nil, err
+        }
+        if !applied {
+            return nil, backends.ErrNotFound
+        }
+        return nil, nil
+    }
+
+    return nil, backends.Unsupported("cassandra", op)
+
+}
+
+// Ping checks the cluster is still reachable
+func (s *Store) Ping(ctx context.Context) error {
+    return s.session.Query("SELECT now() FROM system.local").WithContext(ctx).Exec()
+}
+
+// Close releases the worker's handle. The session itself stays open for
+// the other workers until the Connector is closed.
+func (s *Store) Close() error {
+    return nil
+}
+
+// Quote quotes an identifier
+func quote(name string) string {
+    return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// Classify recognises the gocql errors caused by losing the connections or
+// the session being closed, so those jobs are retried after reconnecting,
+// and the coordinator reporting replicas unavailable, overloaded or timing
+// out, which are worth retrying. Anything else falls back to the pool's
+// default classification.
+func Classify(err error) pool.ErrorClass {
+
+    switch {
+    case errors.Is(err, gocql.ErrNoConnections), errors.Is(err, gocql.ErrSessionClosed),
+        errors.Is(err, gocql.ErrConnectionClosed):
+        return pool.Disconnected
+    case errors.Is(err, gocql.ErrTimeoutNoResponse):
+        return pool.Retryable
+    }
+
+    var reqErr gocql.RequestError
+    if errors.As(err, &reqErr) {
+        switch reqErr.Code() {
+        case gocql.ErrCodeUnavailable, gocql.ErrCodeOverloaded, gocql.ErrCodeBootstrapping,
+            gocql.ErrCodeWriteTimeout, gocql.ErrCodeReadTimeout:
+            return pool.Retryable
+        }
+        return pool.Fatal
+    }
+
+    return pool.DefaultClassifier(err)
+
+}
@@ -0,0 +1,525 @@
+// Package clickhouse implements the pool's Connector and Store for
+// ClickHouse, which each worker writes to in large batched INSERTs over its
+// HTTP interface
+package clickhouse
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "net/url"
+    "slices"
+    "strconv"
+    "strings"
+    "sync"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+)
+
+// DefaultBatchSize is the number of rows a worker buffers before flushing
+// them if the Connector's BatchSize isn't set
+const DefaultBatchSize = 10000
+
+// Connector holds the details of the ClickHouse servers a pool's workers
+// write to. The workers share one HTTP client, whose keep-alive connections
+// are spread across the servers.
+//
+// ClickHouse performs badly with many small INSERTs, so rather than
+// writing each document as it's inserted, each worker buffers rows until
+// it has BatchSize of them for a table and then sends them in one INSERT.
+// A job whose insert is only buffered succeeds straight away, so the rows
+// a worker still has buffered when its Store is closed mustn't be lost. If
+// they can't be flushed they're kept on the Connector, and taken up again
+// when the worker reconnects, and any which still haven't been written
+// when the Connector is closed are flushed then, with an error returned
+// for those which can't be. A batch ClickHouse rejects is split up until
+// the rows it rejects are on their own, so the rest are still written. A
+// rejected row fails the job which buffered it if it's the one flushing
+// the batch, and is otherwise reported when the Connector is closed.
+type Connector struct {
+    // URLs are the base URLs of the servers' HTTP interfaces, such as
+    // http://localhost:8123, which the workers are assigned to in turn
+    URLs []string
+
+    // Database, Username and Password select the database and the
+    // credentials to use. The server's defaults are used if they're empty.
+    Database string
+    Username string
+    Password string
+
+    // TLS secures the connections to https:// URLs if it's set
+    TLS *backends.TLS
+
+    // BatchSize is the number of rows each worker buffers for a table
+    // before flushing them (default DefaultBatchSize)
+    BatchSize int
+
+    // MaxConnections caps the number of connections open to each server.
+    // There's no limit if it's zero.
+    MaxConnections int
+
+    // Schema holds statements, such as CREATE TABLE IF NOT EXISTS, run
+    // once when the client is first created
+    Schema []string
+
+    mu     sync.Mutex
+    client *http.Client
+
+    // parked holds the rows each worker's Store couldn't flush when it was
+    // closed, by worker and table, until the worker reconnects
+    parked map[int]map[string]*batch
+
+    // rejected holds an error for each batch with rows ClickHouse rejected
+    // after the jobs which buffered them had succeeded
+    rejected []error
+}
+
+// Connect returns a Store for the worker, creating the shared client and
+// applying the schema first if this is the first worker to connect. The
+// pool takes care of retrying, with backoff, if the servers can't be
+// reached.
+func (c *Connector) Connect(ctx context.Context, workerId int) (pool.Store, error) {
+
+    if len(c.URLs) == 0 {
+        return nil, errors.New("clickhouse: no URLs to connect to")
+    }
+    s := c.store(workerId)
+
+    client, err := c.dial(ctx, s)
+    if err != nil {
+        return nil, err
+    }
+    s.client = client
+    if err := s.Ping(ctx); err != nil {
+        return nil, err
+    }
+
+    // Take up the rows the worker's last Store couldn't flush
+    c.mu.Lock()
+    if parked := c.parked[workerId]; parked != nil {
+        s.pending = parked
+        delete(c.parked, workerId)
+    }
+    c.mu.Unlock()
+    return s, nil
+
+}
+
+// Store returns a Store for the worker without a client, assigning it the
+// worker's server
+func (c *Connector) store(workerId int) *Store {
+
+    size := c.BatchSize
+    if size <= 0 {
+        size = DefaultBatchSize
+    }
+    return &Store{
+        connector: c,
+        worker:    workerId,
+        url:       strings.TrimSuffix(c.URLs[workerId%len(c.URLs)], "/"),
+        database:  c.Database,
+        username:  c.Username,
+        password:  c.Password,
+        size:      size,
+        pending:   map[string]*batch{},
+    }
+
+}
+
+// Park keeps the rows a worker's Store couldn't flush until the worker
+// reconnects, or the Connector is closed
+func (c *Connector) park(workerId int, pending map[string]*batch) {
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if c.parked == nil {
+        c.parked = map[int]map[string]*batch{}
+    }
+    parked := c.parked[workerId]
+    if parked == nil {
+        c.parked[workerId] = pending
+        return
+    }
+    for table, b := range pending {
+        if p := parked[table]; p != nil {
+            p.rows = append(p.rows, b.rows...)
+        } else {
+            parked[table] = b
+        }
+    }
+
+}
+
+// Close flushes the rows the workers' Stores couldn't, through the shared
+// client, and then closes its idle connections once the pool has finished
+// with it. An error is returned for each table whose rows still can't be
+// written, as the jobs which buffered them have already succeeded.
+func (c *Connector) Close() error {
+
+    c.mu.Lock()
+    parked, client := c.parked, c.client
+    c.parked, c.client = nil, nil
+    c.mu.Unlock()
+
+    var errs []error
+    for workerId, pending := range parked {
+        s := c.store(workerId)
+        s.client = client
+        for table, b := range pending {
+            if client == nil {
+                errs = append(errs, fmt.Errorf("clickhouse: %d rows buffered for %s were never written", len(b.rows), table))
+                continue
+            }
+            if err := s.flushBatch(context.Background(), table, b, 0); err != nil {
+                errs = append(errs, fmt.Errorf("clickhouse: %d rows buffered for %s were never written: %w", len(b.rows), table, err))
+            }
+        }
+    }
+    if client != nil {
+        client.CloseIdleConnections()
+    }
+
+    c.mu.Lock()
+    errs = append(errs, c.rejected...)
+    c.rejected = nil
+    c.mu.Unlock()
+    return errors.Join(errs...)
+
+}
+
+// Reject records the error for rows ClickHouse rejected after their jobs
+// had succeeded, to be returned when the Connector is closed
+func (c *Connector) reject(err error) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.rejected = append(c.rejected, err)
+}
+
+// Dial creates the shared client and applies the schema, through the
+// first worker's Store, the first time it's needed
+func (c *Connector) dial(ctx context.Context, s *Store) (*http.Client, error) {
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if c.client != nil {
+        return c.client, nil
+    }
+
+    transport := http.DefaultTransport.(*http.Transport).Clone()
+    transport.MaxConnsPerHost = c.MaxConnections
+    transport.MaxIdleConnsPerHost = 100
+    if c.TLS != nil {
+        config, err := c.TLS.Config()
+        if err != nil {
+            return nil, err
+        }
+        transport.TLSClientConfig = config
+    }
+
+    log.Printf("Connecting to %s/%s", strings.Join(c.URLs, ","), c.Database)
+    s.client = &http.Client{Transport: transport}
+    for _, statement := range c.Schema {
+        if err := s.query(ctx, statement, nil); err != nil {
+            s.client.CloseIdleConnections()
+            return nil, err
+        }
+    }
+    c.client = s.client
+    return c.client, nil
+
+}
+
+// Exception is returned when ClickHouse fails a query
+type Exception struct {
+    Code    int
+    Message string
+}
+
+// Error returns the exception's message, which includes its code
+func (e *Exception) Error() string {
+    return "clickhouse: " + e.Message
+}
+
+// batch holds the rows a worker has buffered for a table
+type batch struct {
+    columns []string
+    rows    [][]any
+}
+
+// Store is a worker's handle on the shared client and the server it's been
+// assigned, along with the rows it has buffered for each table
+type Store struct {
+    connector *Connector
+    worker    int
+    client    *http.Client
+    url       string
+    database  string
+    username  string
+    password  string
+    size      int
+    pending   map[string]*batch
+}
+
+// Exec performs a backends operation against ClickHouse. An Insert adds
+// the document to the rows buffered for its table, which are flushed once
+// there are enough of them. An InsertMany adds its documents and then
+// flushes the table straight away. If the job's own rows aren't written
+// by the flush they're dropped from the buffer, so they're added again if
+// the job is retried, while the rest are kept for the next flush unless
+// ClickHouse rejected them.
+func (s *Store) Exec(ctx context.Context, op any) (any, error) {
+
+    switch op := op.(type) {
+    case backends.Insert:
+        b, err := s.add(op.Collection, op.Document)
+        if err != nil {
+            return nil, err
+        }
+        if len(b.rows) < s.size {
+            return nil, nil
+        }
+        return nil, s.flushBatch(ctx, op.Collection, b, 1)
+    case backends.InsertMany:
+        if len(op.Documents) == 0 {
+            return nil, nil
+        }
+        var b *batch
+        for i, doc := range op.Documents {
+            var err error
+            if b, err = s.add(op.Collection, doc); err != nil {
+                if i > 0 {
+                    b = s.pending[op.Collection]
+                    b.rows = b.rows[:len(b.rows)-i]
+                }
+                return nil, err
+            }
+        }
+        return nil, s.flushBatch(ctx, op.Collection, b, len(op.Documents))
+    }
+
+    return nil, backends.Unsupported("clickhouse", op)
+
+}
+
+// Add buffers a document as a row of the table, whose columns are taken
+// from the first document buffered for it
+func (s *Store) add(table string, doc any) (*batch, error) {
+
+    names, values, err := backends.Fields(doc)
+    if err != nil {
+        return nil, err
+    }
+
+    b := s.pending[table]
+    switch {
+    case b == nil:
+        b = &batch{columns: names}
+        s.pending[table] = b
+    case len(b.rows) == 0:
+        b.columns = names
+    case !slices.Equal(names, b.columns):
+        return nil, fmt.Errorf("clickhouse: %T has columns %s, expected %s for %s", doc, strings.Join(names, ", "), strings.Join(b.columns, ", "), table)
+    }
+    b.rows = append(b.rows, values)
+    return b, nil
+
+}
+
+// FlushBatch sends a batch of rows for the table in a single INSERT, and
+// empties it if it succeeds. The last own rows belong to the job flushing
+// the batch, if there is one, and the error returned is theirs. If
+// ClickHouse rejects the batch it's split up to isolate the rows it
+// rejects, which are dropped, failing the job if they're its own, while
+// the rest are written. Any other error leaves the rows not yet written in
+// the batch, less the job's own, which are added again if it's retried.
+func (s *Store) flushBatch(ctx context.Context, table string, b *batch, own int) error {
+
+    if len(b.rows) == 0 {
+        return nil
+    }
+
+    rejected := map[int]error{}
+    written, err := s.isolate(ctx, table, b.columns, b.rows, 0, rejected)
+
+    // Report the rejected rows of jobs which have already succeeded
+    var errs []error
+    var others error
+    lost := 0
+    for i, rowErr := range rejected {
+        if i >= len(b.rows)-own {
+            errs = append(errs, rowErr)
+        } else {
+            others = rowErr
+            lost++
+        }
+    }
+    if others != nil {
+        s.connector.reject(fmt.Errorf("clickhouse: %d rows buffered for %s were rejected: %w", lost, table, others))
+    }
+
+    // Keep the rows not yet written, less any of the job's own
+    unwritten := b.rows[written:]
+    if n := min(own, len(unwritten)); n > 0 {
+        unwritten = unwritten[:len(unwritten)-n]
+    } else if err != nil && own > 0 {
+        err = nil
+    }
+    b.rows = append(b.rows[:0], unwritten...)
+    return errors.Join(append(errs, err)...)
+
+}
+
+// Isolate writes rows to the table in a single INSERT, and if ClickHouse
+// rejects them splits them in half and writes each half the same way,
+// recording the rows it rejects on their own in rejected by their index.
+// It stops at the first error which isn't Fatal, or once ctx is done,
+// returning the error along with the number of rows dealt with before it.
+func (s *Store) isolate(ctx context.Context, table string, columns []string, rows [][]any, first int, rejected map[int]error) (int, error) {
+
+    err := s.insert(ctx, table, columns, rows)
+    switch {
+    case err == nil:
+        return len(rows), nil
+    case ctx.Err() != nil || Classify(err) != pool.Fatal:
+        return 0, err
+    case len(rows) == 1:
+        rejected[first] = err
+        return 1, nil
+    }
+
+    half := len(rows) / 2
+    n, err := s.isolate(ctx, table, columns, rows[:half], first, rejected)
+    if err != nil {
+        return n, err
+    }
+    n, err = s.isolate(ctx, table, columns, rows[half:], first+half, rejected)
+    return half + n, err
+
+}
+
+// Insert sends rows of the columns to the table in a single INSERT
+func (s *Store) insert(ctx context.Context, table string, columns []string, rows [][]any) error {
+
+    var body bytes.Buffer
+    enc := json.NewEncoder(&body)
+    row := make(map[string]any, len(columns))
+    for _, values := range rows {
+        for i, column := range columns {
+            row[column] = values[i]
+        }
+        if err := enc.Encode(row); err != nil {
+            return err
+        }
+    }
+
+    quoted := make([]string, len(columns))
+    for i, column := range columns {
+        quoted[i] = quote(column)
+    }
+    query := fmt.Sprintf("INSERT INTO %s (%s) FORMAT JSONEachRow", quote(table), strings.Join(quoted, ", "))
+    return s.query(ctx, query, &body)
+
+}
+
+// Quote quotes an identifier, such as a table or column name
+func quote(name string) string {
+    return "`" + strings.NewReplacer("\\", "\\\\", "`", "\\`").Replace(name) + "`"
+}
+
+// Query runs a statement on the worker's server, sending body as the
+// statement's data if it isn't nil
+func (s *Store) query(ctx context.Context, query string, body io.Reader) error {
+
+    params := url.Values{"query": {query}}
+    if s.database != "" {
+        params.Set("database", s.database)
+    }
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url+"/?"+params.Encode(), body)
+    if err != nil {
+        return err
+    }
+    if s.username != "" {
+        req.Header.Set("X-ClickHouse-User", s.username)
+        req.Header.Set("X-ClickHouse-Key", s.password)
+    }
+
+    resp, err := s.client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+        code, _ := strconv.Atoi(resp.Header.Get("X-ClickHouse-Exception-Code"))
+        return &Exception{Code: code, Message: strings.TrimSpace(string(message))}
+    }
+    _, err = io.Copy(io.Discard, resp.Body)
+    return err
+
+}
+
+// Ping checks the server is still reachable
+func (s *Store) Ping(ctx context.Context) error {
+    return s.query(ctx, "SELECT 1", nil)
+}
+
+// Close flushes the rows the worker still has buffered. Those which can't
+// be written, such as when the worker is reconnecting after losing the
+// server, are kept on the Connector for the worker's next Store, as the
+// jobs which buffered them have already succeeded. The shared client's
+// connections stay open for the other workers until the Connector is
+// closed.
+func (s *Store) Close() error {
+
+    var errs []error
+    unwritten := map[string]*batch{}
+    for table, b := range s.pending {
+        if err := s.flushBatch(context.Background(), table, b, 0); err != nil {
+            unwritten[table] = b
+            errs = append(errs, err)
+        }
+    }
+    if len(unwritten) > 0 {
+        s.connector.park(s.worker, unwritten)
+    }
+    s.pending = map[string]*batch{}
+    return errors.Join(errs...)
+
+}
+
+// Classify recognises the ClickHouse exceptions raised when a server is
+// overloaded, such as too many parts waiting to be merged or too many
+// simultaneous queries, as worth retrying. Other exceptions, such as a
+// missing table or a row of the wrong type, will never succeed. Anything
+// else falls back to the pool's default classification.
+func Classify(err error) pool.ErrorClass {
+
+    var exception *Exception
+    if errors.As(err, &exception) {
+        switch exception.Code {
+        case 159, 202, 209, 241, 252:
+            // TIMEOUT_EXCEEDED, TOO_MANY_SIMULTANEOUS_QUERIES,
+            // SOCKET_TIMEOUT, MEMORY_LIMIT_EXCEEDED, TOO_MANY_PARTS
+            return pool.Retryable
+        case 210:
+            // NETWORK_ERROR
+            return pool.Disconnected
+        case 0:
+            // Not an exception, but an overloaded proxy or similar
+            return pool.Retryable
+        }
+        return pool.Fatal
+    }
+
+    return pool.DefaultClassifier(err)
+
+}
@@ -0,0 +1,45 @@
+// Package documentdb adapts the MongoDB backend to Amazon DocumentDB, so
+// the pool can be used to load test DocumentDB clusters
+package documentdb
+
+import (
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends/mongo"
+)
+
+// DefaultCAFile is the name of the certificate bundle Amazon publishes for
+// verifying DocumentDB's TLS certificates, which isn't in the system's
+// trusted roots
+const DefaultCAFile = "global-bundle.pem"
+
+// Configure adapts a MongoDB connector to DocumentDB's quirks. Connections
+// must use TLS, verified against Amazon's CA bundle in caFile unless the
+// connector's TLS already names a CA file. DocumentDB doesn't support
+// retryable writes, and password authentication uses SCRAM-SHA-1. With iam
+// set, the connector authenticates with the AWS credentials found in the
+// environment (or the instance's role) instead of a username and password.
+func Configure(c *mongo.Connector, caFile string, iam bool) {
+
+    if c.TLS == nil {
+        c.TLS = &backends.TLS{}
+    }
+    if c.TLS.CAFile == "" {
+        c.TLS.CAFile = caFile
+    }
+    c.DisableRetryWrites = true
+
+    if iam {
+        c.AuthMechanism = "MONGODB-AWS"
+        c.AuthDatabase = "$external"
+        c.Username = ""
+        c.Password = ""
+    } else if c.Username != "" {
+        c.AuthMechanism = "SCRAM-SHA-1"
+    }
+
+    // A cluster endpoint always points at the primary of replica set rs0
+    if c.URI == "" && c.ReplicaSet == "" {
+        c.ReplicaSet = "rs0"
+    }
+
+}
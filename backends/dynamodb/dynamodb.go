@@ -0,0 +1,246 @@
+// Package dynamodb implements the pool's Connector and Store for Amazon
+// DynamoDB, using the AWS SDK
+package dynamodb
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "strconv"
+    "sync"
+    "time"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+    "github.com/aws/aws-sdk-go-v2/aws"
+    "github.com/aws/aws-sdk-go-v2/config"
+    "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+    "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+    "github.com/aws/smithy-go"
+)
+
+// maxBatch is the most items BatchWriteItem accepts in one request
+const maxBatch = 25
+
+// ErrUnprocessed is returned when DynamoDB keeps leaving some of a batch's
+// items unprocessed, usually because the table's throughput is exceeded
+var ErrUnprocessed = errors.New("dynamodb: items left unprocessed")
+
+// Connector holds the details of the DynamoDB endpoint a pool's workers
+// write to. The SDK's client is safe for concurrent use and pools its own
+// connections, so every worker shares the same one. Credentials and the
+// region are found in the usual places, such as the environment.
+type Connector struct {
+    // Region overrides the region found in the environment
+    Region string
+
+    // Endpoint overrides the service's endpoint, e.g. for DynamoDB Local
+    Endpoint string
+
+    // TablePrefix is prepended to each collection's name to give the name
+    // of its table
+    TablePrefix string
+
+    mu     sync.Mutex
+    client *dynamodb.Client
+}
+
+// Connect returns a Store for the worker, creating the shared client first
+// if this is the first worker to connect
+func (c *Connector) Connect(ctx context.Context, workerId int) (pool.Store, error) {
+
+    client, err := c.dial(ctx)
+    if err != nil {
+        return nil, err
+    }
+    s := &Store{client: client, prefix: c.TablePrefix}
+    if err := s.Ping(ctx); err != nil {
+        return nil, err
+    }
+    return s, nil
+
+}
+
+// Close releases the shared client. The SDK's client needs no cleaning up.
+func (c *Connector) Close() error {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.client = nil
+    return nil
+}
+
+// Dial creates the shared client the first time it's needed
+func (c *Connector) dial(ctx context.Context) (*dynamodb.Client, error) {
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if c.client != nil {
+        return c.client, nil
+    }
+
+    var opts []func(*config.LoadOptions) error
+    if c.Region != "" {
+        opts = append(opts, config.WithRegion(c.Region))
+    }
+    cfg, err := config.LoadDefaultConfig(ctx, opts...)
+    if err != nil {
+        return nil, err
+    }
+
+    log.Printf("Connecting to DynamoDB in %s", cfg.Region)
+    c.client = dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+        if c.Endpoint != "" {
+            o.BaseEndpoint = aws.String(c.Endpoint)
+        }
+    })
+    return c.client, nil
+
+}
+
+// Store is a worker's handle on the shared client
+type Store struct {
+    client *dynamodb.Client
+    prefix string
+}
+
+// Exec performs a backends operation against DynamoDB. An Insert is
+// written with PutItem, and an InsertMany with BatchWriteItem, 25 items
+// per request, retrying any items DynamoDB leaves unprocessed. PutItem
+// replaces any existing item, so an Upsert is written the same way.
+func (s *Store) Exec(ctx context.Context, op any) (any, error) {
+
+    switch op := op.(type) {
+    case backends.Upsert:
+        return s.Exec(ctx, backends.Insert{Collection: op.Collection, Key: op.Key, Document: op.Document})
+    case backends.Insert:
+        item, err := item(op.Document)
+        if err != nil {
+            return nil, err
+        }
+        _, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+            TableName: aws.String(s.prefix + op.Collection),
+            Item:      item,
+        })
+        return nil, err
+    case backends.InsertMany:
+        requests := make([]types.WriteRequest, len(op.Documents))
+        for i, doc := range op.Documents {
+            item, err := item(doc)
+            if err != nil {
+                return nil, err
+            }
+            requests[i] = types.WriteRequest{PutRequest: &types.PutRequest{Item: item}}
+        }
+        for len(requests) > 0 {
+            n := min(len(requests), maxBatch)
+            if err := s.batchWrite(ctx, s.prefix+op.Collection, requests[:n]); err != nil {
+                return nil, err
+            }
+            requests = requests[n:]
+        }
+        return nil, nil
+    }
+
+    return nil, backends.Unsupported("dynamodb", op)
+
+}
+
+// BatchWrite writes a batch of up to 25 items, backing off and retrying
+// the items DynamoDB leaves unprocessed when it's throttling the table
+func (s *Store) batchWrite(ctx context.Context, table string, requests []types.WriteRequest) error {
+
+    for attempt := 1; ; attempt++ {
+
+        out, err := s.client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+            RequestItems: map[string][]types.WriteRequest{table: requests},
+        })
+        if err != nil {
+            return err
+        }
+        requests = out.UnprocessedItems[table]
+        if len(requests) == 0 {
+            return nil
+        }
+        if attempt == 8 {
+            return fmt.Errorf("%w: %d of them after %d attempts", ErrUnprocessed, len(requests), attempt)
+        }
+
+        timer := time.NewTimer(pool.DefaultBackoff.Delay(attempt))
+        select {
+        case <-timer.C:
+        case <-ctx.Done():
+            timer.Stop()
+            return ctx.Err()
+        }
+
+    }
+
+}
+
+// Ping checks DynamoDB can be reached with the credentials provided
+func (s *Store) Ping(ctx context.Context) error {
+    _, err := s.client.ListTables(ctx, &dynamodb.ListTablesInput{Limit: aws.Int32(1)})
+    return err
+}
+
+// Close releases the worker's handle
+func (s *Store) Close() error {
+    return nil
+}
+
+// Item converts a document to a DynamoDB item
+func item(doc any) (map[string]types.AttributeValue, error) {
+
+    names, values, err := backends.Fields(doc)
+    if err != nil {
+        return nil, err
+    }
+
+    item := make(map[string]types.AttributeValue, len(names))
+    for i, name := range names {
+        switch v := values[i].(type) {
+        case nil:
+            item[name] = &types.AttributeValueMemberNULL{Value: true}
+        case string:
+            item[name] = &types.AttributeValueMemberS{Value: v}
+        case bool:
+            item[name] = &types.AttributeValueMemberBOOL{Value: v}
+        case []byte:
+            item[name] = &types.AttributeValueMemberB{Value: v}
+        case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+            item[name] = &types.AttributeValueMemberN{Value: fmt.Sprint(v)}
+        case time.Time:
+            item[name] = &types.AttributeValueMemberN{Value: strconv.FormatInt(v.UnixMilli(), 10)}
+        default:
+            item[name] = &types.AttributeValueMemberS{Value: fmt.Sprint(v)}
+        }
+    }
+    return item, nil
+
+}
+
+// Classify recognises DynamoDB throttling, including a table's provisioned
+// throughput being exceeded, as worth retrying, once the SDK's own retries
+// have given up. Validation errors, such as a missing table, will never
+// succeed. Anything else falls back to the pool's default classification.
+func Classify(err error) pool.ErrorClass {
+
+    if errors.Is(err, ErrUnprocessed) {
+        return pool.Retryable
+    }
+
+    var apiErr smithy.APIError
+    if errors.As(err, &apiErr) {
+        switch apiErr.ErrorCode() {
+        case "ProvisionedThroughputExceededException", "ThrottlingException",
+            "RequestLimitExceeded", "InternalServerError", "ServiceUnavailable":
+            return pool.Retryable
+        }
+        return pool.Fatal
+    }
+
+    return pool.DefaultClassifier(err)
+
+}
@@ -0,0 +1,336 @@
+// Package elasticsearch implements the pool's Connector and Store for
+// Elasticsearch and OpenSearch, indexing documents with the bulk API
+package elasticsearch
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "net/url"
+    "strings"
+    "sync"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+)
+
+// Connector holds the details of the Elasticsearch (or OpenSearch) cluster
+// a pool's workers index into. The workers share one HTTP client, whose
+// keep-alive connections are spread across the cluster's nodes.
+type Connector struct {
+    // URLs are the base URLs of the nodes, such as http://localhost:9200,
+    // which the workers are assigned to in turn
+    URLs []string
+
+    // Username and Password authenticate with HTTP basic auth if they're
+    // set
+    Username string
+    Password string
+
+    // TLS secures the connections to https:// URLs if it's set
+    TLS *backends.TLS
+
+    // MaxConnections caps the number of connections open to each node.
+    // There's no limit if it's zero.
+    MaxConnections int
+
+    mu     sync.Mutex
+    client *http.Client
+}
+
+// Connect returns a Store for the worker, creating the shared client first
+// if this is the first worker to connect
+func (c *Connector) Connect(ctx context.Context, workerId int) (pool.Store, error) {
+
+    if len(c.URLs) == 0 {
+        return nil, errors.New("elasticsearch: no URLs to connect to")
+    }
+    client, err := c.dial()
+    if err != nil {
+        return nil, err
+    }
+    s := &Store{
+        client:   client,
+        url:      strings.TrimSuffix(c.URLs[workerId%len(c.URLs)], "/"),
+        username: c.Username,
+        password: c.Password,
+    }
+    if err := s.Ping(ctx); err != nil {
+        return nil, err
+    }
+    return s, nil
+
+}
+
+// Close closes the shared client's idle connections once the pool has
+// finished with it
+func (c *Connector) Close() error {
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if c.client != nil {
+        c.client.CloseIdleConnections()
+        c.client = nil
+    }
+    return nil
+
+}
+
+// Dial creates the shared client the first time it's needed
+func (c *Connector) dial() (*http.Client, error) {
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if c.client != nil {
+        return c.client, nil
+    }
+
+    transport := http.DefaultTransport.(*http.Transport).Clone()
+    transport.MaxConnsPerHost = c.MaxConnections
+    transport.MaxIdleConnsPerHost = 100
+    if c.TLS != nil {
+        config, err := c.TLS.Config()
+        if err != nil {
+            return nil, err
+        }
+        transport.TLSClientConfig = config
+    }
+
+    log.Printf("Connecting to %s", strings.Join(c.URLs, ","))
+    c.client = &http.Client{Transport: transport}
+    return c.client, nil
+
+}
+
+// StatusError is returned when Elasticsearch rejects a request, or any of
+// the documents in a bulk request, with an HTTP error status
+type StatusError struct {
+    Code   int
+    Reason string
+}
+
+// Error describes the status and the reason given for it
+func (e *StatusError) Error() string {
+    return fmt.Sprintf("elasticsearch: %d %s: %s", e.Code, http.StatusText(e.Code), e.Reason)
+}
+
+// Store is a worker's handle on the shared client and the node it's been
+// assigned
+type Store struct {
+    client   *http.Client
+    url      string
+    username string
+    password string
+}
+
+// Exec performs a backends operation against Elasticsearch. An Insert or
+// an InsertMany is sent as a single bulk request, indexing the documents
+// into the index named by the collection, with the Insert's Key as the
+// document's _id if it has one. If any document is rejected the first
+// failure is returned, and if any were rejected with 429 Too Many Requests
+// it's that one, so the job is retried once the cluster has caught up. A
+// Find gets the document back by its _id, the Key it was inserted with, an
+// Update sets fields of it and a Delete removes it. An Upsert is indexed
+// like an Insert, which replaces any document with the same _id.
+func (s *Store) Exec(ctx context.Context, op any) (any, error) {
+
+    var body bytes.Buffer
+    switch op := op.(type) {
+    case backends.Find:
+        return s.get(ctx, op.Collection, op.Key)
+    case backends.Update:
+        return nil, s.update(ctx, op.Collection, op.Key, op.Set)
+    case backends.Delete:
+        return nil, s.delete(ctx, op.Collection, op.Key)
+    case backends.Insert:
+        if err := writeAction(&body, op.Collection, op.Key, op.Document); err != nil {
+            return nil, err
+        }
+    case backends.Upsert:
+        if err := writeAction(&body, op.Collection, op.Key, op.Document); err != nil {
+            return nil, err
+        }
+    case backends.InsertMany:
+        for _, doc := range op.Documents {
+            if err := writeAction(&body, op.Collection, "", doc); err != nil {
+                return nil, err
+            }
+        }
+    default:
+        return nil, backends.Unsupported("elasticsearch", op)
+    }
+
+    var response struct {
+        Errors bool
+        Items  []map[string]struct {
+            Status int
+            Error  json.RawMessage
+        }
+    }
+    if err := s.do(ctx, http.MethodPost, "/_bulk", &body, &response); err != nil {
+        return nil, err
+    }
+    if !response.Errors {
+        return nil, nil
+    }
+
+    var failed *StatusError
+    for _, item := range response.Items {
+        for _, result := range item {
+            if result.Status < 300 || (failed != nil && failed.Code == http.StatusTooManyRequests) {
+                continue
+            }
+            failed = &StatusError{Code: result.Status, Reason: string(result.Error)}
+        }
+    }
+    if failed == nil {
+        return nil, errors.New("elasticsearch: bulk request reported errors")
+    }
+    return nil, failed
+
+}
+
+// Get reads a document back by its _id
+func (s *Store) get(ctx context.Context, index string, id string) (map[string]any, error) {
+
+    var response struct {
+        Source map[string]any `json:"_source"`
+    }
+    err := s.do(ctx, http.MethodGet, "/"+url.PathEscape(index)+"/_doc/"+url.PathEscape(id), nil, &response)
+    var statusErr *StatusError
+    if errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound {
+        return nil, backends.ErrNotFound
+    }
+    if err != nil {
+        return nil, err
+    }
+    return response.Source, nil
+
+}
+
+// Update sets fields of a document, found by its _id
+func (s *Store) update(ctx context.Context, index string, id string, set map[string]any) error {
+
+    body, err := json.Marshal(map[string]any{"doc": set})
+    if err != nil {
+        return err
+    }
+    err = s.do(ctx, http.MethodPost, "/"+url.PathEscape(index)+"/_update/"+url.PathEscape(id), bytes.NewReader(body), nil)
+    var statusErr *StatusError
+    if errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound {
+        return backends.ErrNotFound
+    }
+    return err
+
+}
+
+// Delete removes a document, found by its _id
+func (s *Store) delete(ctx context.Context, index string, id string) error {
+    err := s.do(ctx, http.MethodDelete, "/"+url.PathEscape(index)+"/_doc/"+url.PathEscape(id), nil, nil)
+    var statusErr *StatusError
+    if errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound {
+        return backends.ErrNotFound
+    }
+    return err
+}
+
+// Ping checks the node is still reachable
+func (s *Store) Ping(ctx context.Context) error {
+    return s.do(ctx, http.MethodGet, "/", nil, nil)
+}
+
+// Close releases the worker's handle. The shared client's connections
+// stay open for the other workers until the Connector is closed.
+func (s *Store) Close() error {
+    return nil
+}
+
+// Do sends a request to the worker's node, decoding the JSON response into
+// out if it isn't nil
+func (s *Store) do(ctx context.Context, method string, path string, body io.Reader, out any) error {
+
+    req, err := http.NewRequestWithContext(ctx, method, s.url+path, body)
+    if err != nil {
+        return err
+    }
+    if body != nil {
+        req.Header.Set("Content-Type", "application/json")
+        if strings.HasSuffix(path, "/_bulk") {
+            req.Header.Set("Content-Type", "application/x-ndjson")
+        }
+    }
+    if s.username != "" {
+        req.SetBasicAuth(s.username, s.password)
+    }
+
+    resp, err := s.client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode >= 300 {
+        reason, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+        return &StatusError{Code: resp.StatusCode, Reason: strings.TrimSpace(string(reason))}
+    }
+    if out == nil {
+        _, err = io.Copy(io.Discard, resp.Body)
+        return err
+    }
+    return json.NewDecoder(resp.Body).Decode(out)
+
+}
+
+// WriteAction appends the bulk API's index action for a document, followed
+// by the document itself, to the body of a bulk request
+func writeAction(body *bytes.Buffer, index string, id string, doc any) error {
+
+    names, values, err := backends.Fields(doc)
+    if err != nil {
+        return err
+    }
+    source := make(map[string]any, len(names))
+    for i, name := range names {
+        source[name] = values[i]
+    }
+
+    action := map[string]string{"_index": index}
+    if id != "" {
+        action["_id"] = id
+    }
+    enc := json.NewEncoder(body)
+    if err := enc.Encode(map[string]any{"index": action}); err != nil {
+        return err
+    }
+    return enc.Encode(source)
+
+}
+
+// Classify treats 429 Too Many Requests, which Elasticsearch responds with
+// when its queues are full, and the statuses of an overloaded or
+// restarting node as worth retrying, so the pool's retry policy applies
+// the backpressure. Other statuses, such as a malformed document, will
+// never succeed. Anything else falls back to the pool's default
+// classification.
+func Classify(err error) pool.ErrorClass {
+
+    var statusErr *StatusError
+    if errors.As(err, &statusErr) {
+        switch statusErr.Code {
+        case http.StatusTooManyRequests, http.StatusBadGateway,
+            http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+            return pool.Retryable
+        }
+        return pool.Fatal
+    }
+
+    return pool.DefaultClassifier(err)
+
+}
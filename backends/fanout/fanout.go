@@ -0,0 +1,288 @@
+// Package fanout implements a pool Connector which writes every operation
+// to several backends at once, such as a database and an audit topic
+package fanout
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "reflect"
+    "slices"
+    "sort"
+    "strings"
+    "sync"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+)
+
+// Target is one of the backends a fan-out writes to
+type Target struct {
+    // Name identifies the target in results and errors
+    Name string
+
+    Backend  backends.Backend
+    Classify pool.ErrorClassifier
+}
+
+// Connector connects each worker to every one of its Targets, and performs
+// each operation on all of them concurrently. It remembers which targets
+// an operation succeeded on when it failed on the others, so when the job
+// is retried the operation is only performed on the targets it failed on.
+// What's remembered about a job which fails for good is kept until Forget
+// is called for it.
+type Connector struct {
+    Targets []Target
+
+    mu      sync.Mutex
+    partial map[int][]partial
+}
+
+// partial is an operation of a job which failed on some of the targets,
+// with the outcome on each of them so far
+type partial struct {
+    op      any
+    results Results
+}
+
+// Connect returns a Store for the worker holding a store for each target.
+// If any target can't be reached the others are closed again, so the pool
+// retries connecting to all of them.
+func (c *Connector) Connect(ctx context.Context, workerId int) (pool.Store, error) {
+
+    s := &Store{connector: c, targets: c.Targets, stores: make([]pool.Store, len(c.Targets))}
+    for i, target := range c.Targets {
+        store, err := target.Backend.Connect(ctx, workerId)
+        if err != nil {
+            s.Close()
+            return nil, fmt.Errorf("%s: %w", target.Name, err)
+        }
+        s.stores[i] = store
+    }
+    return s, nil
+
+}
+
+// Forget discards what's remembered about the operations of a job which
+// only succeeded on some of the targets, once the job has finished and
+// won't be retried
+func (c *Connector) Forget(jobId int) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    delete(c.partial, jobId)
+}
+
+// Succeeded returns the outcome so far of an operation of a job which only
+// succeeded on some of the targets, if it's been performed before
+func (c *Connector) succeeded(jobId int, op any) Results {
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    for _, p := range c.partial[jobId] {
+        if reflect.DeepEqual(p.op, op) {
+            return p.results
+        }
+    }
+    return nil
+
+}
+
+// Record remembers the outcome of an operation of a job, if it failed on
+// any of the targets, until it has succeeded on all of them
+func (c *Connector) record(jobId int, op any, results Results, failed bool) {
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    ops := c.partial[jobId]
+    i := slices.IndexFunc(ops, func(p partial) bool { return reflect.DeepEqual(p.op, op) })
+    switch {
+    case !failed && i >= 0:
+        ops = slices.Delete(ops, i, i+1)
+    case failed && i >= 0:
+        ops[i].results = results
+    case failed:
+        ops = append(ops, partial{op: op, results: results})
+    }
+
+    if len(ops) == 0 {
+        delete(c.partial, jobId)
+        return
+    }
+    if c.partial == nil {
+        c.partial = map[int][]partial{}
+    }
+    c.partial[jobId] = ops
+
+}
+
+// Close closes every target once the pool has finished with them
+func (c *Connector) Close() error {
+    var errs []error
+    for _, target := range c.Targets {
+        if err := target.Backend.Close(); err != nil {
+            errs = append(errs, fmt.Errorf("%s: %w", target.Name, err))
+        }
+    }
+    return errors.Join(errs...)
+}
+
+// Results records the outcome of an operation on each target, by name,
+// with a nil error for those it succeeded on
+type Results map[string]error
+
+// Error is returned when an operation fails on any of the targets. Its
+// Results record which targets succeeded as well as which failed.
+type Error struct {
+    Results Results
+}
+
+// Error lists the targets which failed, and why
+func (e *Error) Error() string {
+    var failed []string
+    for _, name := range e.names() {
+        if err := e.Results[name]; err != nil {
+            failed = append(failed, fmt.Sprintf("%s: %s", name, err))
+        }
+    }
+    return "fanout: " + strings.Join(failed, "; ")
+}
+
+// Unwrap returns the errors of the targets which failed
+func (e *Error) Unwrap() []error {
+    var errs []error
+    for _, name := range e.names() {
+        if err := e.Results[name]; err != nil {
+            errs = append(errs, err)
+        }
+    }
+    return errs
+}
+
+// Names returns the names of the targets, sorted
+func (e *Error) names() []string {
+    names := make([]string, 0, len(e.Results))
+    for name := range e.Results {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// Store is a worker's handle on each of the targets
+type Store struct {
+    connector *Connector
+    targets   []Target
+    stores    []pool.Store
+}
+
+// Exec performs the operation on every target concurrently, and returns
+// the Results, which are also recorded as the job's outcome with
+// pool.SetOutcome. If it failed on any of them an *Error holding the
+// Results is returned too. When the job retries the same operation it's
+// only performed on the targets it hasn't succeeded on yet, so it isn't
+// repeated on those it has.
+func (s *Store) Exec(ctx context.Context, op any) (any, error) {
+
+    jobId, inJob := pool.JobIdFromContext(ctx)
+    var before Results
+    if inJob {
+        before = s.connector.succeeded(jobId, op)
+    }
+
+    errs := make([]error, len(s.stores))
+    var wg sync.WaitGroup
+    for i, store := range s.stores {
+        if before != nil && before[s.targets[i].Name] == nil {
+            continue
+        }
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            _, errs[i] = store.Exec(ctx, op)
+        }()
+    }
+    wg.Wait()
+
+    results := make(Results, len(s.targets))
+    failed := false
+    for i, target := range s.targets {
+        results[target.Name] = errs[i]
+        failed = failed || errs[i] != nil
+    }
+    if inJob {
+        s.connector.record(jobId, op, results, failed)
+    }
+    pool.SetOutcome(ctx, results)
+    if failed {
+        return results, &Error{Results: results}
+    }
+    return results, nil
+
+}
+
+// Ping checks every target is still reachable
+func (s *Store) Ping(ctx context.Context) error {
+    for i, store := range s.stores {
+        if err := store.Ping(ctx); err != nil {
+            return fmt.Errorf("%s: %w", s.targets[i].Name, err)
+        }
+    }
+    return nil
+}
+
+// Close closes the worker's store for each target
+func (s *Store) Close() error {
+    var errs []error
+    for i, store := range s.stores {
+        if store == nil {
+            continue
+        }
+        if err := store.Close(); err != nil {
+            errs = append(errs, fmt.Errorf("%s: %w", s.targets[i].Name, err))
+        }
+    }
+    return errors.Join(errs...)
+}
+
+// Classifier returns an ErrorClassifier which classifies the failure of
+// each target with its own classifier, and treats the job as having lost
+// its connection if any target has, or otherwise as worth retrying if any
+// target's failure is. Errors which didn't come from the targets fall
+// back to the pool's default classification.
+func (c *Connector) Classifier() pool.ErrorClassifier {
+
+    classifiers := make(map[string]pool.ErrorClassifier, len(c.Targets))
+    for _, target := range c.Targets {
+        classifiers[target.Name] = target.Classify
+    }
+
+    return func(err error) pool.ErrorClass {
+
+        var fanErr *Error
+        if !errors.As(err, &fanErr) {
+            return pool.DefaultClassifier(err)
+        }
+
+        class := pool.Fatal
+        for name, err := range fanErr.Results {
+            if err == nil {
+                continue
+            }
+            classify := classifiers[name]
+            if classify == nil {
+                classify = pool.DefaultClassifier
+            }
+            switch classify(err) {
+            case pool.Disconnected:
+                return pool.Disconnected
+            case pool.Retryable:
+                class = pool.Retryable
+            }
+        }
+        return class
+
+    }
+
+}
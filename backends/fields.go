@@ -0,0 +1,77 @@
+package backends
+
+import (
+    "fmt"
+    "reflect"
+    "sort"
+    "strings"
+)
+
+// Fields flattens a document into its field names and values, for backends
+// which store documents as rows. The document may be a map with string
+// keys, whose fields are returned sorted by name, or a struct (or pointer
+// to one), whose exported fields are named by their db, bson or json tag in
+// that order of preference, or otherwise by the field's name in lower case.
+// Fields tagged "-" are skipped.
+func Fields(doc any) ([]string, []any, error) {
+
+    v := reflect.ValueOf(doc)
+    for v.Kind() == reflect.Pointer {
+        if v.IsNil() {
+            return nil, nil, fmt.Errorf("backends: nil document")
+        }
+        v = v.Elem()
+    }
+
+    switch v.Kind() {
+
+    case reflect.Map:
+        if v.Type().Key().Kind() != reflect.String {
+            return nil, nil, fmt.Errorf("backends: %T: map keys must be strings", doc)
+        }
+        names := make([]string, 0, v.Len())
+        for _, k := range v.MapKeys() {
+            names = append(names, k.String())
+        }
+        sort.Strings(names)
+        values := make([]any, len(names))
+        for i, name := range names {
+            values[i] = v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key())).Interface()
+        }
+        return names, values, nil
+
+    case reflect.Struct:
+        t := v.Type()
+        var names []string
+        var values []any
+        for i := 0; i < t.NumField(); i++ {
+            f := t.Field(i)
+            if !f.IsExported() {
+                continue
+            }
+            name := fieldName(f)
+            if name == "-" {
+                continue
+            }
+            names = append(names, name)
+            values = append(values, v.Field(i).Interface())
+        }
+        return names, values, nil
+
+    }
+
+    return nil, nil, fmt.Errorf("backends: %T: documents must be structs or maps", doc)
+
+}
+
+// fieldName returns the name a struct field is stored under
+func fieldName(f reflect.StructField) string {
+    for _, key := range []string{"db", "bson", "json"} {
+        if tag, ok := f.Tag.Lookup(key); ok {
+            if name, _, _ := strings.Cut(tag, ","); name != "" {
+                return name
+            }
+        }
+    }
+    return strings.ToLower(f.Name)
+}
@@ -0,0 +1,257 @@
+// Package grpcapi implements the pool's Connector and Store for gRPC
+// services, so the pool can load-test a unary method as well as databases
+package grpcapi
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "log"
+    "sync"
+    "text/template"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/credentials"
+    "google.golang.org/grpc/credentials/insecure"
+    healthpb "google.golang.org/grpc/health/grpc_health_v1"
+    "google.golang.org/grpc/metadata"
+    "google.golang.org/grpc/status"
+    "google.golang.org/protobuf/encoding/protojson"
+    "google.golang.org/protobuf/reflect/protoreflect"
+    "google.golang.org/protobuf/types/dynamicpb"
+)
+
+// DefaultRequest is the request template used if the Connector's isn't
+// set, which sends the document's fields as the request message's
+const DefaultRequest = "{{json .Document}}"
+
+// Connector holds the details of the gRPC method a pool's workers call.
+// gRPC multiplexes calls over HTTP/2, so the Connector dials once and every
+// worker shares the same client connection.
+//
+// The method's request and response types are found using the server's
+// reflection service, unless its Descriptor is given, e.g. from generated
+// stubs. Each request is built by executing the Request template, a
+// text/template like the HTTP backend's, and parsing the result as the
+// protobuf JSON encoding of the request message.
+type Connector struct {
+    // Target is the address of the server, in any form grpc.NewClient
+    // accepts, such as localhost:50051 or dns:///service:443
+    Target string
+
+    // Method is the full name of the method to call, as
+    // package.Service/Method
+    Method string
+
+    // Descriptor describes the method, instead of looking it up with
+    // reflection
+    Descriptor protoreflect.MethodDescriptor
+
+    // Request is the template of each request (default DefaultRequest)
+    Request string
+
+    // Metadata holds headers, such as authorization, sent with every call
+    Metadata map[string]string
+
+    // TLS secures the connection if it's set. Otherwise it's plaintext.
+    TLS *backends.TLS
+
+    mu       sync.Mutex
+    conn     *grpc.ClientConn
+    method   protoreflect.MethodDescriptor
+    request  *template.Template
+    metadata metadata.MD
+}
+
+// Request is the data the request template is executed with. It's the
+// same as the HTTP backend's.
+type Request struct {
+    // Collection and Key are the Insert's
+    Collection string
+    Key        string
+
+    // Document is the Insert's document, flattened into a map of its
+    // fields named by their tags if it's a struct or map
+    Document any
+}
+
+// Connect returns a Store for the worker, dialing the server and looking
+// up the method first if this is the first worker to connect. The pool
+// takes care of retrying, with backoff, if the server can't be reached.
+func (c *Connector) Connect(ctx context.Context, workerId int) (pool.Store, error) {
+
+    if err := c.dial(ctx); err != nil {
+        return nil, err
+    }
+    s := &Store{c: c}
+    if err := s.Ping(ctx); err != nil {
+        return nil, err
+    }
+    return s, nil
+
+}
+
+// Close closes the shared connection once the pool has finished with it
+func (c *Connector) Close() error {
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if c.conn == nil {
+        return nil
+    }
+    err := c.conn.Close()
+    c.conn = nil
+    return err
+
+}
+
+// Dial creates the shared connection, parses the request template and
+// looks up the method the first time they're needed
+func (c *Connector) dial(ctx context.Context) error {
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if c.conn != nil {
+        return nil
+    }
+
+    text := c.Request
+    if text == "" {
+        text = DefaultRequest
+    }
+    request, err := template.New("request").Funcs(template.FuncMap{"json": toJSON}).Parse(text)
+    if err != nil {
+        return err
+    }
+
+    creds := insecure.NewCredentials()
+    if c.TLS != nil {
+        config, err := c.TLS.Config()
+        if err != nil {
+            return err
+        }
+        creds = credentials.NewTLS(config)
+    }
+
+    log.Printf("Connecting to grpc://%s to call %s", c.Target, c.Method)
+    conn, err := grpc.NewClient(c.Target, grpc.WithTransportCredentials(creds))
+    if err != nil {
+        return err
+    }
+
+    method := c.Descriptor
+    if method == nil {
+        if method, err = resolve(ctx, conn, c.Method); err != nil {
+            conn.Close()
+            return err
+        }
+    }
+    if method.IsStreamingClient() || method.IsStreamingServer() {
+        conn.Close()
+        return fmt.Errorf("grpc: %s is a streaming method, only unary methods can be called", method.FullName())
+    }
+
+    c.conn, c.method, c.request = conn, method, request
+    c.metadata = metadata.New(c.Metadata)
+    return nil
+
+}
+
+// Store is a worker's handle on the shared connection
+type Store struct {
+    c *Connector
+}
+
+// Exec performs a backends operation by calling the method. An Insert is
+// sent as the request rendered from it, and the response message is
+// returned.
+func (s *Store) Exec(ctx context.Context, op any) (any, error) {
+
+    switch op := op.(type) {
+    case backends.Insert:
+        data := Request{Collection: op.Collection, Key: op.Key, Document: op.Document}
+        if names, values, err := backends.Fields(op.Document); err == nil {
+            doc := make(map[string]any, len(names))
+            for i, name := range names {
+                doc[name] = values[i]
+            }
+            data.Document = doc
+        }
+
+        var body bytes.Buffer
+        if err := s.c.request.Execute(&body, data); err != nil {
+            return nil, err
+        }
+        req := dynamicpb.NewMessage(s.c.method.Input())
+        if err := protojson.Unmarshal(body.Bytes(), req); err != nil {
+            return nil, fmt.Errorf("grpc: %s: %w", s.c.method.Input().FullName(), err)
+        }
+
+        resp := dynamicpb.NewMessage(s.c.method.Output())
+        ctx = metadata.NewOutgoingContext(ctx, s.c.metadata)
+        if err := s.c.conn.Invoke(ctx, fullMethod(s.c.method), req, resp); err != nil {
+            return nil, err
+        }
+        return resp, nil
+    }
+
+    return nil, backends.Unsupported("grpc", op)
+
+}
+
+// Ping checks the server is serving using the standard health service.
+// Servers which don't implement it are assumed to be healthy if they
+// can be reached.
+func (s *Store) Ping(ctx context.Context) error {
+
+    _, err := healthpb.NewHealthClient(s.c.conn).Check(ctx, &healthpb.HealthCheckRequest{})
+    if status.Code(err) == codes.Unimplemented {
+        return nil
+    }
+    return err
+
+}
+
+// Close releases the worker's handle. The connection stays open for the
+// other workers until the Connector is closed.
+func (s *Store) Close() error {
+    return nil
+}
+
+// FullMethod returns the method's name as it's sent on the wire
+func fullMethod(method protoreflect.MethodDescriptor) string {
+    return "/" + string(method.Parent().FullName()) + "/" + string(method.Name())
+}
+
+// toJSON encodes a value for the template's json function
+func toJSON(v any) (string, error) {
+    b, err := json.Marshal(v)
+    return string(b), err
+}
+
+// Classify treats the server being unavailable as a lost connection, so
+// the worker waits for it to come back before the job is retried, and the
+// statuses of an overloaded server or a conflict as worth retrying. Other
+// statuses, such as an invalid argument, will never succeed. Anything else
+// falls back to the pool's default classification.
+func Classify(err error) pool.ErrorClass {
+
+    if s, ok := status.FromError(err); ok {
+        switch s.Code() {
+        case codes.Unavailable:
+            return pool.Disconnected
+        case codes.ResourceExhausted, codes.Aborted, codes.DeadlineExceeded:
+            return pool.Retryable
+        }
+        return pool.Fatal
+    }
+
+    return pool.DefaultClassifier(err)
+
+}
@@ -0,0 +1,100 @@
+package grpcapi
+
+import (
+    "context"
+    "fmt"
+    "strings"
+
+    "google.golang.org/grpc"
+    reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+    "google.golang.org/protobuf/proto"
+    "google.golang.org/protobuf/reflect/protodesc"
+    "google.golang.org/protobuf/reflect/protoreflect"
+    "google.golang.org/protobuf/reflect/protoregistry"
+    "google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Resolve looks up a method, named package.Service/Method, using the
+// server's reflection service
+func resolve(ctx context.Context, conn *grpc.ClientConn, name string) (protoreflect.MethodDescriptor, error) {
+
+    service, method, ok := strings.Cut(strings.TrimPrefix(name, "/"), "/")
+    if !ok {
+        return nil, fmt.Errorf("grpc: method %q should be package.Service/Method", name)
+    }
+
+    stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+    if err != nil {
+        return nil, err
+    }
+    defer stream.CloseSend()
+
+    // Fetch the file defining the service, then any of its dependencies
+    // the server didn't send along with it, which aren't compiled in
+    // here already
+    protos := map[string]*descriptorpb.FileDescriptorProto{}
+    request := &reflectionpb.ServerReflectionRequest{
+        MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service},
+    }
+    for request != nil {
+
+        if err := stream.Send(request); err != nil {
+            return nil, err
+        }
+        resp, err := stream.Recv()
+        if err != nil {
+            return nil, err
+        }
+        if e := resp.GetErrorResponse(); e != nil {
+            return nil, fmt.Errorf("grpc: reflection on %s: %s", service, e.GetErrorMessage())
+        }
+        for _, b := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+            fd := &descriptorpb.FileDescriptorProto{}
+            if err := proto.Unmarshal(b, fd); err != nil {
+                return nil, err
+            }
+            protos[fd.GetName()] = fd
+        }
+
+        request = nil
+        for _, fd := range protos {
+            for _, dep := range fd.GetDependency() {
+                if _, ok := protos[dep]; ok {
+                    continue
+                }
+                if known, err := protoregistry.GlobalFiles.FindFileByPath(dep); err == nil {
+                    protos[dep] = protodesc.ToFileDescriptorProto(known)
+                    continue
+                }
+                request = &reflectionpb.ServerReflectionRequest{
+                    MessageRequest: &reflectionpb.ServerReflectionRequest_FileByFilename{FileByFilename: dep},
+                }
+            }
+        }
+
+    }
+
+    set := &descriptorpb.FileDescriptorSet{}
+    for _, fd := range protos {
+        set.File = append(set.File, fd)
+    }
+    files, err := protodesc.NewFiles(set)
+    if err != nil {
+        return nil, err
+    }
+
+    desc, err := files.FindDescriptorByName(protoreflect.FullName(service))
+    if err != nil {
+        return nil, fmt.Errorf("grpc: service %s: %w", service, err)
+    }
+    sd, ok := desc.(protoreflect.ServiceDescriptor)
+    if !ok {
+        return nil, fmt.Errorf("grpc: %s is not a service", service)
+    }
+    md := sd.Methods().ByName(protoreflect.Name(method))
+    if md == nil {
+        return nil, fmt.Errorf("grpc: service %s has no method %s", service, method)
+    }
+    return md, nil
+
+}
@@ -0,0 +1,286 @@
+// Package httpapi implements the pool's Connector and Store for HTTP
+// endpoints, so the pool can load-test REST APIs as well as databases
+package httpapi
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "strings"
+    "sync"
+    "text/template"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+)
+
+// DefaultBody is the body template used if the Connector's isn't set,
+// which sends the document as JSON
+const DefaultBody = "{{json .Document}}"
+
+// Connector holds the details of the requests a pool's workers make. The
+// workers share one HTTP client, so connections are kept alive and reused
+// from one job to the next.
+//
+// The URL and Body are text/template templates, executed for each request
+// with a Request holding the operation's details, so that each job can be
+// sent somewhere different, e.g. "http://localhost:8080/{{.Collection}}",
+// with a body built from its document. The json function encodes a value
+// as JSON.
+type Connector struct {
+    // Method is the HTTP method to use (default POST)
+    Method string
+
+    // URL is the template of the URL to send each request to
+    URL string
+
+    // Body is the template of each request's body (default DefaultBody).
+    // Requests are sent without a body if it renders to nothing.
+    Body string
+
+    // Header holds headers to add to every request, such as
+    // Authorization. The Content-Type defaults to application/json.
+    Header http.Header
+
+    // PingURL is requested (with GET) to check the endpoint is reachable
+    // when a worker connects and during health checks. The endpoint isn't
+    // checked if it's empty.
+    PingURL string
+
+    // TLS secures the connections to https:// URLs if it's set
+    TLS *backends.TLS
+
+    // MaxConnections caps the number of connections open to each host.
+    // There's no limit if it's zero.
+    MaxConnections int
+
+    mu     sync.Mutex
+    client *http.Client
+    url    *template.Template
+    body   *template.Template
+}
+
+// Request is the data the URL and body templates are executed with
+type Request struct {
+    // Collection and Key are the Insert's
+    Collection string
+    Key        string
+
+    // Document is the Insert's document, flattened into a map of its
+    // fields named by their tags if it's a struct or map
+    Document any
+}
+
+// StatusError is returned when the endpoint responds with an HTTP error
+// status
+type StatusError struct {
+    Code int
+    Body string
+}
+
+// Error describes the status and the start of the response's body
+func (e *StatusError) Error() string {
+    return fmt.Sprintf("http: %d %s: %s", e.Code, http.StatusText(e.Code), e.Body)
+}
+
+// Connect returns a Store for the worker, creating the shared client and
+// parsing the templates first if this is the first worker to connect
+func (c *Connector) Connect(ctx context.Context, workerId int) (pool.Store, error) {
+
+    if err := c.dial(); err != nil {
+        return nil, err
+    }
+    s := &Store{c: c}
+    if err := s.Ping(ctx); err != nil {
+        return nil, err
+    }
+    return s, nil
+
+}
+
+// Close closes the shared client's idle connections once the pool has
+// finished with it
+func (c *Connector) Close() error {
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if c.client != nil {
+        c.client.CloseIdleConnections()
+        c.client = nil
+    }
+    return nil
+
+}
+
+// Dial creates the shared client and parses the templates the first time
+// they're needed
+func (c *Connector) dial() error {
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if c.client != nil {
+        return nil
+    }
+
+    funcs := template.FuncMap{"json": toJSON}
+    u, err := template.New("url").Funcs(funcs).Parse(c.URL)
+    if err != nil {
+        return err
+    }
+    body := c.Body
+    if body == "" {
+        body = DefaultBody
+    }
+    b, err := template.New("body").Funcs(funcs).Parse(body)
+    if err != nil {
+        return err
+    }
+
+    transport := http.DefaultTransport.(*http.Transport).Clone()
+    transport.MaxConnsPerHost = c.MaxConnections
+    transport.MaxIdleConnsPerHost = 100
+    if c.TLS != nil {
+        config, err := c.TLS.Config()
+        if err != nil {
+            return err
+        }
+        transport.TLSClientConfig = config
+    }
+
+    log.Printf("Sending %s requests to %s", c.method(), c.URL)
+    c.url, c.body = u, b
+    c.client = &http.Client{Transport: transport}
+    return nil
+
+}
+
+// Method returns the HTTP method to use
+func (c *Connector) method() string {
+    if c.Method == "" {
+        return http.MethodPost
+    }
+    return strings.ToUpper(c.Method)
+}
+
+// Store is a worker's handle on the shared client
+type Store struct {
+    c *Connector
+}
+
+// Exec performs a backends operation by making an HTTP request. An Insert
+// is sent to the rendered URL with the rendered body, and the response's
+// body is returned if it has a 2xx status.
+func (s *Store) Exec(ctx context.Context, op any) (any, error) {
+
+    switch op := op.(type) {
+    case backends.Insert:
+        data := Request{Collection: op.Collection, Key: op.Key, Document: op.Document}
+        if names, values, err := backends.Fields(op.Document); err == nil {
+            doc := make(map[string]any, len(names))
+            for i, name := range names {
+                doc[name] = values[i]
+            }
+            data.Document = doc
+        }
+
+        var u, body bytes.Buffer
+        if err := s.c.url.Execute(&u, data); err != nil {
+            return nil, err
+        }
+        if err := s.c.body.Execute(&body, data); err != nil {
+            return nil, err
+        }
+        var reader io.Reader
+        if body.Len() > 0 {
+            reader = &body
+        }
+        return s.do(ctx, s.c.method(), u.String(), reader)
+    }
+
+    return nil, backends.Unsupported("http", op)
+
+}
+
+// Do sends a request with the Connector's headers, and returns the
+// response's body if it has a 2xx status
+func (s *Store) do(ctx context.Context, method string, url string, body io.Reader) ([]byte, error) {
+
+    req, err := http.NewRequestWithContext(ctx, method, url, body)
+    if err != nil {
+        return nil, err
+    }
+    for name, values := range s.c.Header {
+        req.Header[name] = values
+    }
+    if body != nil && req.Header.Get("Content-Type") == "" {
+        req.Header.Set("Content-Type", "application/json")
+    }
+
+    resp, err := s.c.client.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    data, err := io.ReadAll(resp.Body)
+    if err != nil {
+        return nil, err
+    }
+    if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+        if len(data) > 1024 {
+            data = data[:1024]
+        }
+        return nil, &StatusError{Code: resp.StatusCode, Body: strings.TrimSpace(string(data))}
+    }
+    return data, nil
+
+}
+
+// Ping requests the PingURL, if there is one
+func (s *Store) Ping(ctx context.Context) error {
+    if s.c.PingURL == "" {
+        return nil
+    }
+    _, err := s.do(ctx, http.MethodGet, s.c.PingURL, nil)
+    return err
+}
+
+// Close releases the worker's handle. The shared client's connections
+// stay open for the other workers until the Connector is closed.
+func (s *Store) Close() error {
+    return nil
+}
+
+// toJSON encodes a value for the templates' json function
+func toJSON(v any) (string, error) {
+    b, err := json.Marshal(v)
+    return string(b), err
+}
+
+// Classify treats the statuses of an overloaded or unavailable service,
+// 408, 429 and any 5xx, as worth retrying, and other error statuses, such
+// as a malformed request, as fatal. Anything else falls back to the pool's
+// default classification.
+func Classify(err error) pool.ErrorClass {
+
+    var statusErr *StatusError
+    if errors.As(err, &statusErr) {
+        switch {
+        case statusErr.Code == http.StatusRequestTimeout,
+            statusErr.Code == http.StatusTooManyRequests,
+            statusErr.Code >= 500:
+            return pool.Retryable
+        }
+        return pool.Fatal
+    }
+
+    return pool.DefaultClassifier(err)
+
+}
@@ -0,0 +1,287 @@
+// Package kafka implements the pool's Connector and Store for Apache Kafka,
+// publishing each document as a message
+package kafka
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+    kafkago "github.com/segmentio/kafka-go"
+)
+
+// DefaultLinger is how long the producer waits for more messages to
+// batch with one it has been given if the Connector's Linger isn't set
+const DefaultLinger = 5 * time.Millisecond
+
+// Connector holds the details of the Kafka cluster a pool's workers
+// publish to. The producer is safe for concurrent use and batches the
+// messages given to it by all of the workers, so the Connector creates it
+// once and every worker shares it.
+type Connector struct {
+    // Brokers are the host:port addresses of the brokers to bootstrap from
+    Brokers []string
+
+    // Topic is the topic every message is published to. If it's empty
+    // each message goes to the topic named by its Insert's collection.
+    Topic string
+
+    // Partitioner chooses the partition each message is published to:
+    // "hash" (of the message's key, the default), "murmur2" (the Java
+    // client's hash), "crc32" (librdkafka's), "round-robin" or
+    // "least-bytes"
+    Partitioner string
+
+    // Acks is the acknowledgement required before a message is considered
+    // published: "none", "one" (the leader) or "all" (every in-sync
+    // replica, the default)
+    Acks string
+
+    // Linger is how long to wait for more messages to fill a batch
+    // (default DefaultLinger)
+    Linger time.Duration
+
+    // CreateTopics creates topics which don't exist when a message is
+    // published to them
+    CreateTopics bool
+
+    // TLS secures the connections if it's set
+    TLS *backends.TLS
+
+    mu        sync.Mutex
+    transport *kafkago.Transport
+    writer    *kafkago.Writer
+    client    *kafkago.Client
+}
+
+// Connect returns a Store for the worker, creating the shared producer
+// first if this is the first worker to connect. The pool takes care of
+// retrying, with backoff, if the brokers can't be reached.
+func (c *Connector) Connect(ctx context.Context, workerId int) (pool.Store, error) {
+
+    writer, client, err := c.dial()
+    if err != nil {
+        return nil, err
+    }
+    s := &Store{writer: writer, client: client, topic: c.Topic}
+    if err := s.Ping(ctx); err != nil {
+        return nil, err
+    }
+    return s, nil
+
+}
+
+// Close flushes any messages still waiting to be sent and closes the
+// shared producer once the pool has finished with it
+func (c *Connector) Close() error {
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if c.writer == nil {
+        return nil
+    }
+    err := c.writer.Close()
+    c.transport.CloseIdleConnections()
+    c.writer, c.client, c.transport = nil, nil, nil
+    return err
+
+}
+
+// Dial creates the shared producer the first time it's needed
+func (c *Connector) dial() (*kafkago.Writer, *kafkago.Client, error) {
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if c.writer != nil {
+        return c.writer, c.client, nil
+    }
+    if len(c.Brokers) == 0 {
+        return nil, nil, errors.New("kafka: no brokers to connect to")
+    }
+
+    balancer, err := partitioner(c.Partitioner)
+    if err != nil {
+        return nil, nil, err
+    }
+    acks, err := requiredAcks(c.Acks)
+    if err != nil {
+        return nil, nil, err
+    }
+    linger := c.Linger
+    if linger <= 0 {
+        linger = DefaultLinger
+    }
+
+    transport := &kafkago.Transport{}
+    if c.TLS != nil {
+        config, err := c.TLS.Config()
+        if err != nil {
+            return nil, nil, err
+        }
+        transport.TLS = config
+    }
+
+    log.Printf("Connecting to kafka://%s", strings.Join(c.Brokers, ","))
+    addr := kafkago.TCP(c.Brokers...)
+    c.transport = transport
+    c.writer = &kafkago.Writer{
+        Addr:                   addr,
+        Balancer:               balancer,
+        RequiredAcks:           acks,
+        BatchTimeout:           linger,
+        AllowAutoTopicCreation: c.CreateTopics,
+        Transport:              transport,
+    }
+    c.client = &kafkago.Client{Addr: addr, Transport: transport}
+    return c.writer, c.client, nil
+
+}
+
+// Partitioner returns the balancer for the named partitioner
+func partitioner(name string) (kafkago.Balancer, error) {
+    switch name {
+    case "", "hash":
+        return &kafkago.Hash{}, nil
+    case "murmur2":
+        return kafkago.Murmur2Balancer{}, nil
+    case "crc32":
+        return kafkago.CRC32Balancer{}, nil
+    case "round-robin":
+        return &kafkago.RoundRobin{}, nil
+    case "least-bytes":
+        return &kafkago.LeastBytes{}, nil
+    }
+    return nil, fmt.Errorf("kafka: unknown partitioner %q", name)
+}
+
+// RequiredAcks returns the acknowledgement for the named setting
+func requiredAcks(name string) (kafkago.RequiredAcks, error) {
+    switch name {
+    case "", "all":
+        return kafkago.RequireAll, nil
+    case "one":
+        return kafkago.RequireOne, nil
+    case "none":
+        return kafkago.RequireNone, nil
+    }
+    return 0, fmt.Errorf("kafka: unknown acks %q, expected none, one or all", name)
+}
+
+// Store is a worker's handle on the shared producer
+type Store struct {
+    writer *kafkago.Writer
+    client *kafkago.Client
+    topic  string
+}
+
+// Exec performs a backends operation against Kafka. An Insert publishes
+// the document, encoded as JSON, keyed by the Insert's Key, and an
+// InsertMany publishes its documents together. Both wait until the
+// messages have been acknowledged.
+func (s *Store) Exec(ctx context.Context, op any) (any, error) {
+
+    switch op := op.(type) {
+    case backends.Insert:
+        msg, err := s.message(op.Collection, op.Key, op.Document)
+        if err != nil {
+            return nil, err
+        }
+        return nil, s.writer.WriteMessages(ctx, msg)
+    case backends.InsertMany:
+        msgs := make([]kafkago.Message, len(op.Documents))
+        for i, doc := range op.Documents {
+            var err error
+            if msgs[i], err = s.message(op.Collection, "", doc); err != nil {
+                return nil, err
+            }
+        }
+        return nil, s.writer.WriteMessages(ctx, msgs...)
+    }
+
+    return nil, backends.Unsupported("kafka", op)
+
+}
+
+// Message encodes a document as a message for the collection's topic
+func (s *Store) message(collection string, key string, doc any) (kafkago.Message, error) {
+
+    names, values, err := backends.Fields(doc)
+    if err != nil {
+        return kafkago.Message{}, err
+    }
+    fields := make(map[string]any, len(names))
+    for i, name := range names {
+        fields[name] = values[i]
+    }
+    value, err := json.Marshal(fields)
+    if err != nil {
+        return kafkago.Message{}, err
+    }
+
+    topic := s.topic
+    if topic == "" {
+        topic = collection
+    }
+    msg := kafkago.Message{Topic: topic, Value: value}
+    if key != "" {
+        msg.Key = []byte(key)
+    }
+    return msg, nil
+
+}
+
+// Ping checks the cluster's metadata can be fetched from the brokers
+func (s *Store) Ping(ctx context.Context) error {
+    _, err := s.client.Metadata(ctx, &kafkago.MetadataRequest{})
+    return err
+}
+
+// Close releases the worker's handle. The producer stays open for the
+// other workers until the Connector is closed.
+func (s *Store) Close() error {
+    return nil
+}
+
+// Classify treats a partition's leader moving or being unavailable as a
+// lost connection, so the worker checks the brokers can be reached before
+// the job is requeued, and Kafka's other temporary errors, such as too few
+// in-sync replicas, as worth retrying. Any other Kafka error, such as a
+// message which is too large, will never succeed. Anything else falls back
+// to the pool's default classification.
+func Classify(err error) pool.ErrorClass {
+
+    // A batch fails with the errors of each of its messages
+    var writeErrs kafkago.WriteErrors
+    if errors.As(err, &writeErrs) {
+        for _, err := range writeErrs {
+            if err != nil {
+                return Classify(err)
+            }
+        }
+    }
+
+    var kafkaErr kafkago.Error
+    if errors.As(err, &kafkaErr) {
+        switch kafkaErr {
+        case kafkago.LeaderNotAvailable, kafkago.NotLeaderForPartition,
+            kafkago.BrokerNotAvailable, kafkago.NetworkException:
+            return pool.Disconnected
+        }
+        if kafkaErr.Temporary() {
+            return pool.Retryable
+        }
+        return pool.Fatal
+    }
+
+    return pool.DefaultClassifier(err)
+
+}
@@ -0,0 +1,94 @@
+package mongo
+
+import (
+    "context"
+    "time"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "go.mongodb.org/mongo-driver/bson"
+)
+
+// Aggregate runs the pipeline by explaining it with executionStats
+// verbosity, which executes it in full on the server and reports how long
+// that took, without sending the results back
+func (s *Store) aggregate(ctx context.Context, op backends.Aggregate) (backends.AggregateResult, error) {
+
+    pipeline := make(bson.A, len(op.Pipeline))
+    for i, stage := range op.Pipeline {
+        pipeline[i] = bson.M(stage)
+    }
+    cmd := bson.D{
+        {Key: "explain", Value: bson.D{
+            {Key: "aggregate", Value: op.Collection},
+            {Key: "pipeline", Value: pipeline},
+            {Key: "cursor", Value: bson.D{}},
+        }},
+        {Key: "verbosity", Value: "executionStats"},
+    }
+
+    var explain bson.M
+    if err := s.db.RunCommand(ctx, cmd).Decode(&explain); err != nil {
+        return backends.AggregateResult{}, err
+    }
+
+    // Pipelines which can't be pushed down to the query layer only
+    // report an estimate for each stage
+    ms, ok := stat(explain, "executionTimeMillis")
+    if !ok {
+        ms, _ = stat(explain, "executionTimeMillisEstimate")
+    }
+    return backends.AggregateResult{ServerTime: time.Duration(ms * float64(time.Millisecond))}, nil
+
+}
+
+// Stat finds the shallowest field with the given name in an explain's
+// output, whose shape depends on the server's version, the pipeline's
+// stages and whether the collection is sharded. If there are several at
+// that depth, one for each shard, the largest is returned.
+func stat(explain any, name string) (float64, bool) {
+
+    level := []any{explain}
+    for len(level) > 0 {
+        var next []any
+        found, largest := false, 0.0
+        for _, v := range level {
+            switch v := v.(type) {
+            case bson.M:
+                for key, value := range v {
+                    if n, ok := number(value); ok && key == name && (!found || n > largest) {
+                        found, largest = true, n
+                    }
+                    next = append(next, value)
+                }
+            case bson.D:
+                for _, e := range v {
+                    if n, ok := number(e.Value); ok && e.Key == name && (!found || n > largest) {
+                        found, largest = true, n
+                    }
+                    next = append(next, e.Value)
+                }
+            case bson.A:
+                next = append(next, v...)
+            }
+        }
+        if found {
+            return largest, true
+        }
+        level = next
+    }
+    return 0, false
+
+}
+
+// Number converts any of the numeric types BSON decodes to a float64
+func number(v any) (float64, bool) {
+    switch v := v.(type) {
+    case int32:
+        return float64(v), true
+    case int64:
+        return float64(v), true
+    case float64:
+        return v, true
+    }
+    return 0, false
+}
@@ -0,0 +1,51 @@
+package mongo
+
+import (
+    "errors"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+    driver "go.mongodb.org/mongo-driver/mongo"
+)
+
+// Classify recognises the driver errors caused by losing the connection or
+// the primary stepping down, so those jobs are retried after reconnecting,
+// transient write and transaction failures which are worth retrying, and
+// duplicate keys which will never succeed. Anything else falls back to the
+// pool's default classification.
+func Classify(err error) pool.ErrorClass {
+
+    if driver.IsDuplicateKeyError(err) {
+        return pool.Fatal
+    }
+
+    if driver.IsNetworkError(err) || errors.Is(err, driver.ErrClientDisconnected) {
+        return pool.Disconnected
+    }
+
+    var server driver.ServerError
+    if errors.As(err, &server) {
+        for _, code := range []int{91, 189, 10107, 11600, 11602, 13435, 13436} {
+            // Shutting down, stepping down, not master or node recovering
+            if server.HasErrorCode(code) {
+                return pool.Disconnected
+            }
+        }
+        if server.HasErrorLabel("RetryableWriteError") {
+            return pool.Retryable
+        }
+
+        // A transaction which was still failing when the driver gave up
+        // retrying it can be tried again from the start
+        if server.HasErrorLabel("TransientTransactionError") || server.HasErrorLabel("UnknownTransactionCommitResult") {
+            return pool.Retryable
+        }
+    }
+
+    // Includes the driver's own timeouts, e.g. server selection
+    if driver.IsTimeout(err) {
+        return pool.Retryable
+    }
+
+    return pool.DefaultClassifier(err)
+
+}
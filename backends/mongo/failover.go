@@ -0,0 +1,104 @@
+package mongo
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "strings"
+)
+
+// target is the cluster the Connector is currently connecting to
+type target struct {
+    uri      string
+    fallback bool
+}
+
+// Target returns the cluster to connect to
+func (c *Connector) target() target {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.host()
+}
+
+// Host returns the cluster to connect to, which is the Host (or URI) until
+// the Connector fails over to one of its FallbackHosts. c.mu must be held.
+func (c *Connector) host() target {
+
+    if c.current > 0 {
+        return target{uri: uri(c.FallbackHosts[c.current-1]), fallback: true}
+    }
+    if c.URI != "" {
+        return target{uri: c.URI}
+    }
+    return target{uri: uri(c.Host)}
+
+}
+
+// Failed records a failed attempt to connect, failing over to the next of
+// the FallbackHosts once there have been FailoverAfter in a row
+func (c *Connector) failed() {
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if len(c.FallbackHosts) == 0 {
+        return
+    }
+    after := c.FailoverAfter
+    if after <= 0 {
+        after = 3
+    }
+    c.failures++
+    if c.failures < after {
+        return
+    }
+
+    // Disconnect the shared client, so that any workers still using it
+    // reconnect to the new host
+    c.failures = 0
+    c.current = (c.current + 1) % (len(c.FallbackHosts) + 1)
+    if c.client != nil {
+        go c.client.Disconnect(context.Background())
+        c.client = nil
+    }
+    log.Printf("Failing over to %s after %d failed attempts to connect", redact(c.host().uri), after)
+
+}
+
+// Connected resets the count of failed attempts to connect
+func (c *Connector) connected() {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.failures = 0
+}
+
+// Uri turns a host or seed list into a connection string, leaving
+// anything which is already a connection string as it is
+func uri(hosts string) string {
+
+    if strings.Contains(hosts, "://") {
+        return hosts
+    }
+    seeds := strings.Split(hosts, ",")
+    for i := range seeds {
+        seeds[i] = strings.TrimSpace(seeds[i])
+    }
+    return fmt.Sprintf("mongodb://%s", strings.Join(seeds, ","))
+
+}
+
+// Redact strips any credentials from a connection string so it can be
+// logged
+func redact(uri string) string {
+    scheme, rest, ok := strings.Cut(uri, "://")
+    if !ok {
+        return uri
+    }
+    if at := strings.LastIndex(rest, "@"); at >= 0 {
+        rest = rest[at+1:]
+    }
+    if q := strings.Index(rest, "?"); q >= 0 {
+        rest = rest[:q]
+    }
+    return scheme + "://" + rest
+}
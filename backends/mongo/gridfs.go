@@ -0,0 +1,54 @@
+package mongo
+
+import (
+    "context"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "go.mongodb.org/mongo-driver/mongo/gridfs"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Upload streams the object into the GridFS bucket named by its collection,
+// as a file named by its key, a chunk at a time. If the upload fails the
+// chunks already written are removed.
+func (s *Store) upload(ctx context.Context, op backends.PutObject) error {
+
+    bucket, err := s.bucket(op.Collection)
+    if err != nil {
+        return err
+    }
+
+    // GridFS takes a deadline rather than a context, which is zero (no
+    // deadline) if the job has no timeout
+    deadline, _ := ctx.Deadline()
+    if err := bucket.SetWriteDeadline(deadline); err != nil {
+        return err
+    }
+    _, err = bucket.UploadFromStream(op.Key, op.Body)
+    return err
+
+}
+
+// Bucket returns the worker's handle on the named GridFS bucket, opening it
+// the first time it's used so the bucket's indexes are only checked once
+func (s *Store) bucket(name string) (*gridfs.Bucket, error) {
+
+    if bucket, ok := s.buckets[name]; ok {
+        return bucket, nil
+    }
+
+    opts := options.GridFSBucket().SetName(name)
+    if s.chunkSize > 0 {
+        opts.SetChunkSizeBytes(s.chunkSize)
+    }
+    bucket, err := gridfs.NewBucket(s.db, opts)
+    if err != nil {
+        return nil, err
+    }
+    if s.buckets == nil {
+        s.buckets = map[string]*gridfs.Bucket{}
+    }
+    s.buckets[name] = bucket
+    return bucket, nil
+
+}
@@ -0,0 +1,434 @@
+// Package mongo implements the pool's Connector and Store for MongoDB,
+// using the official MongoDB Go driver
+package mongo
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+    "github.com/PaulMaddox/golang-db-pool-pattern/secrets"
+    "go.mongodb.org/mongo-driver/bson"
+    driver "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/gridfs"
+    "go.mongodb.org/mongo-driver/mongo/options"
+    "go.mongodb.org/mongo-driver/mongo/readpref"
+    "go.mongodb.org/mongo-driver/mongo/writeconcern"
+    "go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+)
+
+// SessionMode chooses how the workers' connections are set up
+type SessionMode int
+
+const (
+    // Shared dials once and every worker shares the same client, whose
+    // operations are multiplexed over the driver's connection pool, rather
+    // than each setting up its own view of the cluster
+    Shared SessionMode = iota
+
+    // PerWorker gives each worker a client of its own with a single
+    // dedicated connection
+    PerWorker
+)
+
+// String returns the name of the mode
+func (m SessionMode) String() string {
+    switch m {
+    case Shared:
+        return "shared"
+    case PerWorker:
+        return "per-worker"
+    }
+    return fmt.Sprintf("SessionMode(%d)", int(m))
+}
+
+// Connector holds the details of the MongoDB database a pool's workers
+// connect to, so that several pools can run against different databases
+// in the same process
+type Connector struct {
+    // URI is a standard mongodb:// or mongodb+srv:// connection string,
+    // giving access to all of the driver's options. Host is ignored if
+    // it's set, and the other fields override the URI's settings.
+    URI string
+
+    // Host is a single host or a comma separated seed list of replica set
+    // members, each with an optional :port
+    Host string
+
+    // Database is the database to use, which defaults to the one named in
+    // the URI, or "test" if there isn't one
+    Database string
+
+    // ReplicaSet names the replica set the seeds belong to, so that the
+    // driver discovers the other members and follows the primary if it
+    // steps down
+    ReplicaSet string
+
+    // SessionMode chooses between one client shared by all of the workers
+    // (the default) and a dedicated client for each
+    SessionMode SessionMode
+
+    // MaxConnections caps the size of each client's connection pool, which
+    // its operations are multiplexed across. If it's zero the driver's
+    // default (100) is used for a shared client, and 1 for a worker's own.
+    MaxConnections uint64
+
+    // Username and Password authenticate against AuthDatabase, which
+    // defaults to "admin", using AuthMechanism, which defaults to the one
+    // negotiated with the server. No authentication is attempted without
+    // a Username or AuthMechanism.
+    Username      string
+    Password      string
+    AuthDatabase  string
+    AuthMechanism string
+
+    // PasswordProvider looks up the password each time a client is
+    // created, instead of Password, so it never needs to be on the
+    // command line
+    PasswordProvider secrets.Provider
+
+    // DisableRetryWrites turns off the driver's retryable writes, for
+    // servers which don't support them
+    DisableRetryWrites bool
+
+    // TLS secures the connections if it's set
+    TLS *backends.TLS
+
+    // DialTimeout limits how long opening a connection may take,
+    // SocketTimeout how long a read or write on one may block, and
+    // ServerSelectionTimeout how long an operation waits for a suitable
+    // server, e.g. a new primary. The driver's defaults are used for any
+    // which are zero.
+    DialTimeout            time.Duration
+    SocketTimeout          time.Duration
+    ServerSelectionTimeout time.Duration
+
+    // WriteConcern sets the durability of writes, instead of leaving it
+    // to the server's (or URI's) default
+    WriteConcern *WriteConcern
+
+    // ReadPreference is the name of the read preference mode, such as
+    // "primary" or "secondaryPreferred", to use instead of the default
+    ReadPreference string
+
+    // ChunkSize is the size of the chunks files are split into when
+    // they're written to GridFS, which defaults to 255KiB. Files are
+    // streamed a chunk at a time, so it bounds the memory each upload uses.
+    ChunkSize int32
+
+    // FallbackHosts are standby clusters, each a host, seed list or
+    // connection string, which are failed over to in turn once
+    // FailoverAfter attempts to connect in a row have failed (default 3)
+    FallbackHosts []string
+    FailoverAfter int
+
+    mu       sync.Mutex
+    client   *driver.Client
+    database string
+    current  int
+    failures int
+}
+
+// Connect returns a Store for the worker, dialing the database first if
+// this is the first worker to connect to a shared client. The pool takes
+// care of retrying, with backoff, if the server can't be reached.
+func (c *Connector) Connect(ctx context.Context, workerId int) (pool.Store, error) {
+
+    var s *Store
+    if c.SessionMode == PerWorker {
+        client, database, err := c.newClient(ctx, c.target(), 1)
+        if err != nil {
+            return nil, err
+        }
+        s = &Store{client: client, db: client.Database(database), owned: true, chunkSize: c.ChunkSize}
+    } else {
+        client, database, err := c.dial(ctx)
+        if err != nil {
+            return nil, err
+        }
+        s = &Store{client: client, db: client.Database(database), chunkSize: c.ChunkSize}
+    }
+
+    // The driver connects lazily, so make sure the server is reachable
+    // before handing the worker its store
+    if err := s.Ping(ctx); err != nil {
+        s.Close()
+        if ctx.Err() == nil {
+            c.failed()
+        }
+        return nil, err
+    }
+
+    c.connected()
+    return s, nil
+
+}
+
+// Close disconnects the shared client once the pool has finished with it
+func (c *Connector) Close() error {
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if c.client == nil {
+        return nil
+    }
+    err := c.client.Disconnect(context.Background())
+    c.client = nil
+    return err
+
+}
+
+// Dial creates the shared client the first time it's needed, and returns
+// it along with the name of the database to use
+func (c *Connector) dial(ctx context.Context) (*driver.Client, string, error) {
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if c.client != nil {
+        return c.client, c.database, nil
+    }
+
+    client, database, err := c.newClient(ctx, c.host(), 0)
+    if err != nil {
+        return nil, "", err
+    }
+    c.client = client
+    c.database = database
+    return client, database, nil
+
+}
+
+// NewClient creates a client for the given target (from host) with the
+// Connector's settings, and returns it along with the name of the database
+// to use. The size of its connection pool is poolSize unless MaxConnections
+// is set, or the driver's default if both are zero.
+func (c *Connector) newClient(ctx context.Context, target target, poolSize uint64) (*driver.Client, string, error) {
+
+    uri := target.uri
+
+    // Parse the URI ourselves too, to find its database and so we can log
+    // where we're connecting without giving away any password it contains
+    cs, err := connstring.ParseAndValidate(uri)
+    if err != nil {
+        return nil, "", err
+    }
+    database := c.Database
+    if database == "" {
+        database = cs.Database
+    }
+    if database == "" {
+        database = "test"
+    }
+
+    log.Printf("Connecting to %s://%s/%s", cs.Scheme, strings.Join(cs.Hosts, ","), database)
+    opts := options.Client().ApplyURI(uri)
+    if c.ReplicaSet != "" && !target.fallback {
+        opts.SetReplicaSet(c.ReplicaSet)
+    }
+    if c.MaxConnections > 0 {
+        poolSize = c.MaxConnections
+    }
+    if poolSize > 0 {
+        opts.SetMaxPoolSize(poolSize)
+    }
+    if c.Username != "" || c.AuthMechanism != "" {
+        password := c.Password
+        if c.PasswordProvider != nil {
+            password, err = c.PasswordProvider.Secret(ctx)
+            if err != nil {
+                return nil, "", err
+            }
+        }
+        opts.SetAuth(options.Credential{
+            Username:      c.Username,
+            Password:      password,
+            AuthSource:    c.AuthDatabase,
+            AuthMechanism: c.AuthMechanism,
+        })
+    }
+    if c.DisableRetryWrites {
+        opts.SetRetryWrites(false)
+    }
+    if c.TLS != nil {
+        config, err := c.TLS.Config()
+        if err != nil {
+            return nil, "", err
+        }
+        opts.SetTLSConfig(config)
+    }
+    if c.DialTimeout > 0 {
+        opts.SetConnectTimeout(c.DialTimeout)
+    }
+    if c.SocketTimeout > 0 {
+        opts.SetSocketTimeout(c.SocketTimeout)
+    }
+    if c.ServerSelectionTimeout > 0 {
+        opts.SetServerSelectionTimeout(c.ServerSelectionTimeout)
+    }
+    if c.WriteConcern != nil {
+        opts.SetWriteConcern(c.WriteConcern.driver())
+    }
+    if c.ReadPreference != "" {
+        mode, err := readpref.ModeFromString(c.ReadPreference)
+        if err != nil {
+            return nil, "", err
+        }
+        rp, err := readpref.New(mode)
+        if err != nil {
+            return nil, "", err
+        }
+        opts.SetReadPreference(rp)
+    }
+    client, err := driver.Connect(ctx, opts)
+    if err != nil {
+        return nil, "", err
+    }
+    return client, database, nil
+
+}
+
+// WriteConcern is the acknowledgement MongoDB gives writes before they
+// are considered successful
+type WriteConcern struct {
+    // W is the number of members which must acknowledge each write, or a
+    // tag such as "majority"
+    W string
+
+    // Journal requires writes to reach the on-disk journal
+    Journal bool
+
+    // Timeout limits how long to wait for W members to acknowledge
+    Timeout time.Duration
+}
+
+// Driver converts the write concern to the driver's representation
+func (w *WriteConcern) driver() *writeconcern.WriteConcern {
+
+    wc := &writeconcern.WriteConcern{WTimeout: w.Timeout}
+    if n, err := strconv.Atoi(w.W); err == nil {
+        wc.W = n
+    } else if w.W != "" {
+        wc.W = w.W
+    }
+    if w.Journal {
+        wc.Journal = &w.Journal
+    }
+    return wc
+
+}
+
+// Store is a worker's handle on its client, which may be shared
+type Store struct {
+    client *driver.Client
+    db     *driver.Database
+    owned  bool
+
+    chunkSize int32
+    buckets   map[string]*gridfs.Bucket
+}
+
+// Exec performs a backends operation against the database
+func (s *Store) Exec(ctx context.Context, op any) (any, error) {
+
+    switch op := op.(type) {
+    case backends.Insert:
+        _, err := s.db.Collection(op.Collection).InsertOne(ctx, op.Document)
+        return nil, err
+    case backends.InsertMany:
+        // Unordered, so one bad document doesn't stop the rest being
+        // inserted, and the write errors say which ones failed
+        opts := options.InsertMany().SetOrdered(false)
+        _, err := s.db.Collection(op.Collection).InsertMany(ctx, op.Documents, opts)
+        var bulk driver.BulkWriteException
+        if errors.As(err, &bulk) && bulk.WriteConcernError == nil && len(bulk.WriteErrors) > 0 {
+            failed := &backends.BulkError{Errors: map[int]error{}}
+            for _, we := range bulk.WriteErrors {
+                failed.Errors[we.Index] = we.WriteError
+            }
+            return nil, failed
+        }
+        return nil, err
+    case backends.Upsert:
+        opts := options.Replace().SetUpsert(true)
+        _, err := s.db.Collection(op.Collection).ReplaceOne(ctx, bson.M(op.Filter), op.Document, opts)
+        return nil, err
+    case backends.Count:
+        return s.db.Collection(op.Collection).CountDocuments(ctx, bson.M{})
+    case backends.Aggregate:
+        return s.aggregate(ctx, op)
+    case backends.PutObject:
+        return nil, s.upload(ctx, op)
+    case backends.Transaction:
+        return nil, s.transaction(ctx, op)
+    case backends.EnsureIndex:
+        keys := bson.D{}
+        for _, field := range op.Fields {
+            order := 1
+            if field.Descending {
+                order = -1
+            }
+            keys = append(keys, bson.E{Key: field.Name, Value: order})
+        }
+        opts := options.Index().SetUnique(op.Unique)
+        if op.Name != "" {
+            opts.SetName(op.Name)
+        }
+        // Creating an index identical to an existing one does nothing
+        _, err := s.db.Collection(op.Collection).Indexes().CreateOne(ctx, driver.IndexModel{Keys: keys, Options: opts})
+        return nil, err
+    case backends.Find:
+        var doc bson.M
+        err := s.db.Collection(op.Collection).FindOne(ctx, bson.M(op.Filter)).Decode(&doc)
+        if errors.Is(err, driver.ErrNoDocuments) {
+            return nil, backends.ErrNotFound
+        }
+        if err != nil {
+            return nil, err
+        }
+        return map[string]any(doc), nil
+    case backends.Update:
+        res, err := s.db.Collection(op.Collection).UpdateOne(ctx, bson.M(op.Filter), bson.M{"$set": op.Set})
+        if err != nil {
+            return nil, err
+        }
+        if res.MatchedCount == 0 {
+            return nil, backends.ErrNotFound
+        }
+        return nil, nil
+    case backends.Delete:
+        res, err := s.db.Collection(op.Collection).DeleteOne(ctx, bson.M(op.Filter))
+        if err != nil {
+            return nil, err
+        }
+        if res.DeletedCount == 0 {
+            return nil, backends.ErrNotFound
+        }
+        return nil, nil
+    }
+
+    return nil, backends.Unsupported("mongo", op)
+
+}
+
+// Ping checks the primary is still reachable
+func (s *Store) Ping(ctx context.Context) error {
+    return s.client.Ping(ctx, readpref.Primary())
+}
+
+// Close disconnects the worker's own client. A shared client stays
+// connected for the other workers until the Connector is closed.
+func (s *Store) Close() error {
+    if !s.owned {
+        return nil
+    }
+    return s.client.Disconnect(context.Background())
+}
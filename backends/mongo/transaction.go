@@ -0,0 +1,33 @@
+package mongo
+
+import (
+    "context"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    driver "go.mongodb.org/mongo-driver/mongo"
+)
+
+// Transaction performs the operations in a multi-document transaction with
+// the driver's WithTransaction, which runs the whole transaction again
+// while it fails with a TransientTransactionError, and retries the commit
+// while its outcome is unknown, until the job's context is done.
+// Transactions need a replica set or sharded cluster.
+func (s *Store) transaction(ctx context.Context, op backends.Transaction) error {
+
+    session, err := s.client.StartSession()
+    if err != nil {
+        return err
+    }
+    defer session.EndSession(context.WithoutCancel(ctx))
+
+    _, err = session.WithTransaction(ctx, func(sc driver.SessionContext) (any, error) {
+        for _, o := range op.Ops {
+            if _, err := s.Exec(sc, o); err != nil {
+                return nil, err
+            }
+        }
+        return nil, nil
+    })
+    return err
+
+}
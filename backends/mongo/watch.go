@@ -0,0 +1,169 @@
+package mongo
+
+import (
+    "context"
+    "errors"
+    "log"
+    "time"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    driver "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Change is an event from a change stream
+type Change struct {
+    // ID is the event's resume token, which is unique to the event
+    ID string
+
+    // Operation is the type of change, such as insert, update, replace
+    // or delete
+    Operation  string
+    Collection string
+
+    // Key is the _id of the document which changed, and Document the
+    // document as it is after the change, or nil if it was deleted
+    Key      any
+    Document map[string]any
+
+    // Time is when the change was made on the server
+    Time time.Time
+}
+
+// errStreamClosed is the reason a change stream is reopened after the
+// server closes it, e.g. after invalidating it
+var errStreamClosed = errors.New("change stream closed")
+
+// event is a change stream event as the server sends it
+type event struct {
+    ID        bson.Raw `bson:"_id"`
+    Operation string   `bson:"operationType"`
+    Namespace struct {
+        Collection string `bson:"coll"`
+    } `bson:"ns"`
+    DocumentKey  bson.M              `bson:"documentKey"`
+    FullDocument bson.M              `bson:"fullDocument"`
+    ClusterTime  primitive.Timestamp `bson:"clusterTime"`
+}
+
+// Watcher follows the change stream of a collection, or of the whole
+// database if Collection is empty. If the stream is interrupted it's
+// reopened after the last event delivered, backing off between attempts,
+// so that no changes are missed or delivered twice while it was down.
+// Change streams need a replica set or sharded cluster.
+type Watcher struct {
+    Connector  *Connector
+    Collection string
+    Backoff    pool.Backoff
+
+    token      bson.Raw
+    startAfter bool
+}
+
+// Watch delivers each change to fn, in the order they were made, until
+// the context is done or fn returns an error, which is returned
+func (w *Watcher) Watch(ctx context.Context, fn func(Change) error) error {
+
+    for attempt := 1; ; attempt++ {
+
+        delivered, err := w.follow(ctx, fn)
+        if ctx.Err() != nil {
+            return nil
+        }
+        var stop stopError
+        if errors.As(err, &stop) {
+            return stop.err
+        }
+        if delivered {
+            attempt = 1
+        }
+
+        delay := w.Backoff.Delay(attempt)
+        log.Printf("Change stream interrupted, resuming in %s (%s)", delay, err)
+        select {
+        case <-time.After(delay):
+        case <-ctx.Done():
+            return nil
+        }
+
+    }
+
+}
+
+// stopError carries an error from the function changes are delivered to,
+// which stops the Watcher rather than reopening the stream
+type stopError struct {
+    err error
+}
+
+// Error returns the function's error message
+func (e stopError) Error() string {
+    return e.err.Error()
+}
+
+// Follow opens the change stream, resuming after the last event delivered
+// if there was one, and delivers its events until it fails. It reports
+// whether any events were delivered, so Watch knows it was back up.
+func (w *Watcher) follow(ctx context.Context, fn func(Change) error) (bool, error) {
+
+    client, database, err := w.Connector.dial(ctx)
+    if err != nil {
+        return false, err
+    }
+
+    opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+    if w.token != nil && w.startAfter {
+        opts.SetStartAfter(w.token)
+    } else if w.token != nil {
+        opts.SetResumeAfter(w.token)
+    }
+    var stream *driver.ChangeStream
+    if w.Collection == "" {
+        stream, err = client.Database(database).Watch(ctx, driver.Pipeline{}, opts)
+    } else {
+        stream, err = client.Database(database).Collection(w.Collection).Watch(ctx, driver.Pipeline{}, opts)
+    }
+    if err != nil {
+        return false, err
+    }
+    defer stream.Close(context.WithoutCancel(ctx))
+
+    delivered := false
+    for stream.Next(ctx) {
+
+        var e event
+        if err := stream.Decode(&e); err != nil {
+            return delivered, err
+        }
+
+        // An invalidate event ends the stream, e.g. when the collection
+        // is dropped, and it can only be started again after it
+        if e.Operation == "invalidate" {
+            w.token, w.startAfter = stream.ResumeToken(), true
+            continue
+        }
+
+        id, _ := e.ID.Lookup("_data").StringValueOK()
+        change := Change{
+            ID:         id,
+            Operation:  e.Operation,
+            Collection: e.Namespace.Collection,
+            Key:        e.DocumentKey["_id"],
+            Document:   e.FullDocument,
+            Time:       time.Unix(int64(e.ClusterTime.T), 0),
+        }
+        if err := fn(change); err != nil {
+            return delivered, stopError{err}
+        }
+        w.token, w.startAfter = stream.ResumeToken(), false
+        delivered = true
+
+    }
+    if err := stream.Err(); err != nil {
+        return delivered, err
+    }
+    return delivered, errStreamClosed
+
+}
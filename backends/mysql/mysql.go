@@ -0,0 +1,103 @@
+// Package mysql implements the pool's Connector and Store for MySQL and
+// MariaDB, using the go-sql-driver driver through database/sql
+package mysql
+
+import (
+    "context"
+    "database/sql/driver"
+    "errors"
+    "slices"
+    "strings"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends/sqldb"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+    "github.com/go-sql-driver/mysql"
+)
+
+// Dialect is MySQL's flavour of SQL
+var Dialect = sqldb.Dialect{
+    Name: "mysql",
+    Placeholder: func(n int) string {
+        return "?"
+    },
+    Quote:    quote,
+    Upsert:   upsert,
+    Classify: Classify,
+    IndexExists: func(err error) bool {
+        // Duplicate key name
+        var myErr *mysql.MySQLError
+        return errors.As(err, &myErr) && myErr.Number == 1061
+    },
+}
+
+// Quote quotes an identifier
+func quote(name string) string {
+    return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// Upsert adds an ON DUPLICATE KEY UPDATE clause to an INSERT, updating the
+// columns other than the keys. MySQL uses whichever unique index the row
+// conflicts on, rather than the keys given.
+func upsert(insert string, columns []string, keys []string) string {
+
+    var set []string
+    for _, column := range columns {
+        if !slices.Contains(keys, column) {
+            set = append(set, quote(column)+" = VALUES("+quote(column)+")")
+        }
+    }
+    if len(set) == 0 {
+        // Nothing to update, but the duplicate still mustn't fail
+        set = append(set, quote(keys[0])+" = "+quote(keys[0]))
+    }
+    return insert + " ON DUPLICATE KEY UPDATE " + strings.Join(set, ", ")
+
+}
+
+// NewConnector returns a Connector for the database at dsn, in the
+// driver's user:password@tcp(host:port)/database?param=value format. The
+// clientFoundRows parameter is set, so that an update which matches a row
+// without changing it isn't mistaken for one which matched nothing.
+func NewConnector(dsn string) *sqldb.Connector {
+    if config, err := mysql.ParseDSN(dsn); err == nil {
+        config.ClientFoundRows = true
+        dsn = config.FormatDSN()
+    }
+    return &sqldb.Connector{Driver: "mysql", DSN: dsn, Dialect: Dialect}
+}
+
+// Classify recognises the MySQL errors caused by losing the connection or
+// the server shutting down or going read-only on failover, so those jobs
+// are retried after reconnecting, deadlocks and lock timeouts which are
+// worth retrying, and duplicate keys which will never succeed. Anything
+// else falls back to the pool's default classification.
+func Classify(err error) pool.ErrorClass {
+
+    if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) {
+        return pool.Disconnected
+    }
+
+    var myErr *mysql.MySQLError
+    if errors.As(err, &myErr) {
+        switch myErr.Number {
+        case 1053, 1290, 2006, 2013:
+            // Server shutdown, read-only, server gone away, lost connection
+            return pool.Disconnected
+        case 1205, 1213:
+            // Lock wait timeout, deadlock
+            return pool.Retryable
+        case 1062:
+            // Duplicate entry
+            return pool.Fatal
+        }
+    }
+
+    // The connection is unusable once a query on it has been cancelled
+    // part way through
+    if errors.Is(err, context.DeadlineExceeded) {
+        return pool.Disconnected
+    }
+
+    return pool.DefaultClassifier(err)
+
+}
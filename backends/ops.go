@@ -0,0 +1,161 @@
+// Package backends defines the operations which jobs ask a pool.Store to
+// perform, so the same jobs can run against any of the databases
+// implemented in its subpackages.
+package backends
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "sort"
+    "time"
+)
+
+// ErrUnsupported is returned by a Store asked to perform an operation it
+// doesn't implement
+var ErrUnsupported = errors.New("operation not supported by this backend")
+
+// ErrNotFound is returned by a Store when the document an operation looks
+// up doesn't exist
+var ErrNotFound = errors.New("document not found")
+
+// Insert adds a document to a collection (or table)
+type Insert struct {
+    Collection string
+    Document   any
+
+    // Key identifies the document in key-value stores, which generate a
+    // key for it if it's empty. Other backends ignore it.
+    Key string
+}
+
+// InsertMany adds several documents to a collection (or table) in as few
+// requests as the backend allows
+type InsertMany struct {
+    Collection string
+    Documents  []any
+}
+
+// BulkError is returned by an InsertMany which inserted some but not all of
+// its documents, giving the error for each which wasn't by its index in
+// Documents. Backends which insert all or none of them return the error on
+// its own.
+type BulkError struct {
+    Errors map[int]error
+}
+
+// Error describes the first of the documents which failed
+func (e *BulkError) Error() string {
+    errs := e.Unwrap()
+    return fmt.Sprintf("%d documents were not inserted, the first with: %s", len(errs), errs[0])
+}
+
+// Unwrap returns the errors in the order of the documents, so that they
+// can be classified with errors.Is and errors.As
+func (e *BulkError) Unwrap() []error {
+
+    indexes := make([]int, 0, len(e.Errors))
+    for i := range e.Errors {
+        indexes = append(indexes, i)
+    }
+    sort.Ints(indexes)
+
+    errs := make([]error, len(indexes))
+    for n, i := range indexes {
+        errs[n] = e.Errors[i]
+    }
+    return errs
+
+}
+
+// Find looks up a single document in a collection (or table), and returns
+// it as a map[string]any of its fields, or ErrNotFound. Backends which can
+// query by field match every field in Filter, while key-value stores look
+// the document up by the Key it was inserted with.
+type Find struct {
+    Collection string
+    Key        string
+    Filter     map[string]any
+}
+
+// Update sets fields of a single existing document, found the same way as
+// by Find, and returns ErrNotFound if there isn't one
+type Update struct {
+    Collection string
+    Key        string
+    Filter     map[string]any
+    Set        map[string]any
+}
+
+// Delete removes a single document, found the same way as by Find, and
+// returns ErrNotFound if there isn't one
+type Delete struct {
+    Collection string
+    Key        string
+    Filter     map[string]any
+}
+
+// Upsert replaces a single document, found the same way as by Find, or
+// inserts it if there isn't one, so that repeating it is idempotent
+type Upsert struct {
+    Collection string
+    Key        string
+    Filter     map[string]any
+    Document   any
+}
+
+// Count returns the number of documents in a collection (or table), as an
+// int64
+type Count struct {
+    Collection string
+}
+
+// Aggregate runs an aggregation pipeline, a list of stages such as $match
+// and $group, over a collection and returns an AggregateResult
+type Aggregate struct {
+    Collection string
+    Pipeline   []map[string]any
+}
+
+// AggregateResult reports how an Aggregate went
+type AggregateResult struct {
+    // ServerTime is how long the server spent executing the pipeline,
+    // as opposed to the round trip the job measures
+    ServerTime time.Duration
+}
+
+// Transaction performs several operations atomically, so that either all
+// of them take effect or none do
+type Transaction struct {
+    Ops []any
+}
+
+// EnsureIndex creates an index on a collection (or table), unless there's
+// already one with the same name
+type EnsureIndex struct {
+    Collection string
+    Fields     []IndexField
+    Unique     bool
+
+    // Name is the index's name, which the backend chooses if it's empty
+    Name string
+}
+
+// IndexField is one of the fields an index is ordered by
+type IndexField struct {
+    Name       string
+    Descending bool
+}
+
+// PutObject stores a blob, read from Body, under a key in a collection (or
+// bucket prefix), for object stores. Key is generated if it's empty.
+type PutObject struct {
+    Collection string
+    Key        string
+    Body       io.Reader
+}
+
+// Unsupported reports that op can't be performed by the named backend
+func Unsupported(backend string, op any) error {
+    return fmt.Errorf("%s: %T: %w", backend, op, ErrUnsupported)
+}
@@ -0,0 +1,104 @@
+// Package postgres implements the pool's Connector and Store for
+// PostgreSQL, using the pgx driver through database/sql
+package postgres
+
+import (
+    "context"
+    "database/sql/driver"
+    "errors"
+    "slices"
+    "strconv"
+    "strings"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends/sqldb"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+    "github.com/jackc/pgx/v5/pgconn"
+    _ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// Dialect is PostgreSQL's flavour of SQL
+var Dialect = sqldb.Dialect{
+    Name: "postgres",
+    Placeholder: func(n int) string {
+        return "$" + strconv.Itoa(n)
+    },
+    Quote:    quote,
+    Upsert:   upsert,
+    Classify: Classify,
+    IndexExists: func(err error) bool {
+        // Duplicate table, which covers any relation including an index
+        var pgErr *pgconn.PgError
+        return errors.As(err, &pgErr) && pgErr.Code == "42P07"
+    },
+}
+
+// Quote quotes an identifier
+func quote(name string) string {
+    return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// Upsert adds an ON CONFLICT clause to an INSERT, updating the columns
+// other than the keys
+func upsert(insert string, columns []string, keys []string) string {
+
+    quoted := make([]string, len(keys))
+    for i, key := range keys {
+        quoted[i] = quote(key)
+    }
+    var set []string
+    for _, column := range columns {
+        if !slices.Contains(keys, column) {
+            set = append(set, quote(column)+" = EXCLUDED."+quote(column))
+        }
+    }
+    if len(set) == 0 {
+        return insert + " ON CONFLICT (" + strings.Join(quoted, ", ") + ") DO NOTHING"
+    }
+    return insert + " ON CONFLICT (" + strings.Join(quoted, ", ") + ") DO UPDATE SET " + strings.Join(set, ", ")
+
+}
+
+// NewConnector returns a Connector for the database at dsn, which may be a
+// postgres:// URL or a list of key=value settings
+func NewConnector(dsn string) *sqldb.Connector {
+    return &sqldb.Connector{Driver: "pgx", DSN: dsn, Dialect: Dialect}
+}
+
+// Classify recognises the PostgreSQL errors caused by losing the
+// connection or the server shutting down, so those jobs are retried after
+// reconnecting, serialization failures and deadlocks which are worth
+// retrying, and constraint violations which will never succeed. Anything
+// else falls back to the pool's default classification.
+func Classify(err error) pool.ErrorClass {
+
+    if errors.Is(err, driver.ErrBadConn) {
+        return pool.Disconnected
+    }
+
+    var pgErr *pgconn.PgError
+    if errors.As(err, &pgErr) {
+        switch {
+        case strings.HasPrefix(pgErr.Code, "08"):
+            // Connection exception
+            return pool.Disconnected
+        case pgErr.Code == "57P01", pgErr.Code == "57P02", pgErr.Code == "57P03":
+            // Admin shutdown, crash shutdown, cannot connect now
+            return pool.Disconnected
+        case pgErr.Code == "40001", pgErr.Code == "40P01":
+            // Serialization failure, deadlock detected
+            return pool.Retryable
+        case strings.HasPrefix(pgErr.Code, "23"):
+            // Integrity constraint violation
+            return pool.Fatal
+        }
+    }
+
+    // The connection is unusable once a query on it has been cancelled
+    // part way through
+    if errors.Is(err, context.DeadlineExceeded) {
+        return pool.Disconnected
+    }
+
+    return pool.DefaultClassifier(err)
+
+}
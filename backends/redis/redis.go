@@ -0,0 +1,281 @@
+// Package redis implements the pool's Connector and Store for Redis, either
+// a single server or a cluster
+package redis
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "log"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+    goredis "github.com/redis/go-redis/v9"
+)
+
+// Connector holds the details of the Redis servers a pool's workers
+// connect to. The client manages its own pool of connections, so the
+// Connector dials once and every worker shares the same client.
+type Connector struct {
+    // Addrs is a single host:port, or the seed nodes of a cluster
+    Addrs []string
+
+    // Password and DB select the credentials and (outside a cluster)
+    // database number to use
+    Password string
+    DB       int
+
+    // Strings stores each document as a JSON string with SET, rather than
+    // as a hash of its fields with HSET
+    Strings bool
+
+    // TTL expires the keys written after the given time, if it's set
+    TTL time.Duration
+
+    // MaxConnections caps the size of the client's connection pool. The
+    // client's default (10 per CPU) is used if it's zero.
+    MaxConnections int
+
+    mu     sync.Mutex
+    client goredis.UniversalClient
+}
+
+// Connect returns a Store for the worker, creating the shared client first
+// if this is the first worker to connect. The pool takes care of retrying,
+// with backoff, if the servers can't be reached.
+func (c *Connector) Connect(ctx context.Context, workerId int) (pool.Store, error) {
+
+    s := &Store{client: c.dial(), strings: c.Strings, ttl: c.TTL}
+    if err := s.Ping(ctx); err != nil {
+        return nil, err
+    }
+    return s, nil
+
+}
+
+// Close closes the shared client once the pool has finished with it
+func (c *Connector) Close() error {
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if c.client == nil {
+        return nil
+    }
+    err := c.client.Close()
+    c.client = nil
+    return err
+
+}
+
+// Dial creates the shared client the first time it's needed. Connections
+// are only made once it's used.
+func (c *Connector) dial() goredis.UniversalClient {
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if c.client == nil {
+        log.Printf("Connecting to redis://%s/%d", strings.Join(c.Addrs, ","), c.DB)
+        c.client = goredis.NewUniversalClient(&goredis.UniversalOptions{
+            Addrs:    c.Addrs,
+            Password: c.Password,
+            DB:       c.DB,
+            PoolSize: c.MaxConnections,
+        })
+    }
+    return c.client
+
+}
+
+// updateHash sets fields of a hash if it exists, returning 0 if it doesn't
+var updateHash = goredis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+    return 0
+end
+redis.call("HSET", KEYS[1], unpack(ARGV))
+return 1
+`)
+
+// updateJSON sets fields of a JSON string if it exists, keeping its TTL,
+// and returns 0 if it doesn't
+var updateJSON = goredis.NewScript(`
+local value = redis.call("GET", KEYS[1])
+if not value then
+    return 0
+end
+local doc = cjson.decode(value)
+for i = 1, #ARGV, 2 do
+    doc[ARGV[i]] = ARGV[i + 1]
+end
+redis.call("SET", KEYS[1], cjson.encode(doc), "KEEPTTL")
+return 1
+`)
+
+// Store is a worker's handle on the shared client
+type Store struct {
+    client  goredis.UniversalClient
+    strings bool
+    ttl     time.Duration
+}
+
+// Exec performs a backends operation against Redis. An Insert writes the
+// document under the key <collection>:<key>, generating a random key if
+// the Insert has none, and adds the key to the <collection> set, in a
+// single pipeline. A Find reads the document back by its key, an Update
+// sets its fields if it exists, atomically with a script, and a Delete
+// removes it and its key from the set.
+func (s *Store) Exec(ctx context.Context, op any) (any, error) {
+
+    switch op := op.(type) {
+    case backends.Insert:
+        id := op.Key
+        if id == "" {
+            id = randomKey()
+        }
+        return nil, s.write(ctx, s.client.Pipeline(), op.Collection, id, op.Document)
+    case backends.Upsert:
+        // Delete any existing key first, so a hash doesn't keep fields the
+        // new document doesn't have, all in one transaction
+        pipe := s.client.TxPipeline()
+        pipe.Del(ctx, op.Collection+":"+op.Key)
+        return nil, s.write(ctx, pipe, op.Collection, op.Key, op.Document)
+    case backends.Find:
+        key := op.Collection + ":" + op.Key
+        doc := map[string]any{}
+        if s.strings {
+            value, err := s.client.Get(ctx, key).Bytes()
+            if errors.Is(err, goredis.Nil) {
+                return nil, backends.ErrNotFound
+            }
+            if err != nil {
+                return nil, err
+            }
+            return doc, json.Unmarshal(value, &doc)
+        }
+        fields, err := s.client.HGetAll(ctx, key).Result()
+        if err != nil {
+            return nil, err
+        }
+        if len(fields) == 0 {
+            return nil, backends.ErrNotFound
+        }
+        for name, value := range fields {
+            doc[name] = value
+        }
+        return doc, nil
+    case backends.Update:
+        names, values, err := backends.Fields(op.Set)
+        if err != nil {
+            return nil, err
+        }
+        args := make([]any, 0, 2*len(names))
+        for i, name := range names {
+            args = append(args, name, values[i])
+        }
+        script := updateHash
+        if s.strings {
+            script = updateJSON
+        }
+        found, err := script.Run(ctx, s.client, []string{op.Collection + ":" + op.Key}, args...).Int()
+        if err != nil {
+            return nil, err
+        }
+        if found == 0 {
+            return nil, backends.ErrNotFound
+        }
+        return nil, nil
+    case backends.Delete:
+        pipe := s.client.TxPipeline()
+        deleted := pipe.Del(ctx, op.Collection+":"+op.Key)
+        pipe.SRem(ctx, op.Collection, op.Key)
+        if _, err := pipe.Exec(ctx); err != nil {
+            return nil, err
+        }
+        if deleted.Val() == 0 {
+            return nil, backends.ErrNotFound
+        }
+        return nil, nil
+    }
+
+    return nil, backends.Unsupported("redis", op)
+
+}
+
+// Write adds the commands storing the document under the id to the pipe,
+// and executes them
+func (s *Store) write(ctx context.Context, pipe goredis.Pipeliner, collection, id string, doc any) error {
+
+    key := collection + ":" + id
+    if s.strings {
+        value, err := json.Marshal(doc)
+        if err != nil {
+            return err
+        }
+        pipe.Set(ctx, key, value, s.ttl)
+    } else {
+        names, values, err := backends.Fields(doc)
+        if err != nil {
+            return err
+        }
+        fields := make([]any, 0, 2*len(names))
+        for i, name := range names {
+            fields = append(fields, name, values[i])
+        }
+        pipe.HSet(ctx, key, fields...)
+        if s.ttl > 0 {
+            pipe.Expire(ctx, key, s.ttl)
+        }
+    }
+    pipe.SAdd(ctx, collection, id)
+    _, err := pipe.Exec(ctx)
+    return err
+
+}
+
+// Ping checks the servers are still reachable
+func (s *Store) Ping(ctx context.Context) error {
+    return s.client.Ping(ctx).Err()
+}
+
+// Close releases the worker's handle. The client itself stays connected
+// for the other workers until the Connector is closed.
+func (s *Store) Close() error {
+    return nil
+}
+
+// Classify recognises the Redis errors caused by the client being closed
+// or a server loading, failing over or the cluster being reconfigured, so
+// those jobs are retried after reconnecting. Anything else falls back to
+// the pool's default classification.
+func Classify(err error) pool.ErrorClass {
+
+    if errors.Is(err, goredis.ErrClosed) {
+        return pool.Disconnected
+    }
+
+    var redisErr goredis.Error
+    if errors.As(err, &redisErr) {
+        switch prefix, _, _ := strings.Cut(redisErr.Error(), " "); prefix {
+        case "LOADING", "READONLY", "MASTERDOWN", "CLUSTERDOWN":
+            return pool.Disconnected
+        case "TRYAGAIN", "BUSY":
+            return pool.Retryable
+        }
+    }
+
+    return pool.DefaultClassifier(err)
+
+}
+
+// RandomKey generates a key for a document which doesn't have one
+func randomKey() string {
+    var b [16]byte
+    rand.Read(b[:])
+    return hex.EncodeToString(b[:])
+}
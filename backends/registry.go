@@ -0,0 +1,74 @@
+package backends
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+    "sync"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+)
+
+// Backend is a database (or other target) the pool can be pointed at,
+// which is closed once the workers have finished with it
+type Backend interface {
+    pool.Connector
+    Close() error
+}
+
+// Factory configures a backend, typically from flags or the environment,
+// and returns it along with the classifier for its errors
+type Factory func() (Backend, pool.ErrorClassifier, error)
+
+var (
+    registryMu sync.RWMutex
+    registry   = map[string]Factory{}
+)
+
+// Register makes a backend available by name to Open, so that new targets,
+// including third parties' own, can be added without changing the code
+// which chooses between them. It's usually called from an init function,
+// and panics if the name is already registered.
+func Register(name string, factory Factory) {
+
+    registryMu.Lock()
+    defer registryMu.Unlock()
+
+    if factory == nil {
+        panic("backends: Register factory is nil for " + name)
+    }
+    if _, ok := registry[name]; ok {
+        panic("backends: Register called twice for " + name)
+    }
+    registry[name] = factory
+
+}
+
+// Open configures the named backend using its registered Factory
+func Open(name string) (Backend, pool.ErrorClassifier, error) {
+
+    registryMu.RLock()
+    factory, ok := registry[name]
+    registryMu.RUnlock()
+
+    if !ok {
+        return nil, nil, fmt.Errorf("backends: unknown backend %q, expected one of %s", name, strings.Join(Names(), ", "))
+    }
+    return factory()
+
+}
+
+// Names returns the names of the registered backends, sorted
+func Names() []string {
+
+    registryMu.RLock()
+    defer registryMu.RUnlock()
+
+    names := make([]string, 0, len(registry))
+    for name := range registry {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+
+}
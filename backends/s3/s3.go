@@ -0,0 +1,200 @@
+// Package s3 implements the pool's Connector and Store for Amazon S3 and
+// S3-compatible object stores, uploading an object per operation
+package s3
+
+import (
+    "bytes"
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "log"
+    "path"
+    "sync"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+    "github.com/aws/aws-sdk-go-v2/aws"
+    "github.com/aws/aws-sdk-go-v2/config"
+    "github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+    "github.com/aws/aws-sdk-go-v2/service/s3"
+    "github.com/aws/smithy-go"
+)
+
+// Connector holds the details of the bucket a pool's workers upload to.
+// The SDK's client is safe for concurrent use and pools its own
+// connections, so every worker shares the same one. Credentials and the
+// region are found in the usual places, such as the environment.
+//
+// Objects larger than PartSize are uploaded in parts, several at once.
+type Connector struct {
+    // Bucket is the bucket objects are uploaded to, which must exist
+    Bucket string
+
+    // Region overrides the region found in the environment
+    Region string
+
+    // Endpoint overrides the service's endpoint, for S3-compatible stores
+    // such as MinIO, and PathStyle addresses the bucket in the path
+    // rather than the host name, which most of them need
+    Endpoint  string
+    PathStyle bool
+
+    // PartSize is the size of the parts of a multipart upload, which is
+    // used for objects larger than it, and must be at least 5MiB
+    // (default manager.DefaultUploadPartSize)
+    PartSize int64
+
+    mu       sync.Mutex
+    client   *s3.Client
+    uploader *manager.Uploader
+}
+
+// Connect returns a Store for the worker, creating the shared client first
+// if this is the first worker to connect
+func (c *Connector) Connect(ctx context.Context, workerId int) (pool.Store, error) {
+
+    client, uploader, err := c.dial(ctx)
+    if err != nil {
+        return nil, err
+    }
+    s := &Store{client: client, uploader: uploader, bucket: c.Bucket}
+    if err := s.Ping(ctx); err != nil {
+        return nil, err
+    }
+    return s, nil
+
+}
+
+// Close releases the shared client. The SDK's client needs no cleaning up.
+func (c *Connector) Close() error {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.client, c.uploader = nil, nil
+    return nil
+}
+
+// Dial creates the shared client the first time it's needed
+func (c *Connector) dial(ctx context.Context) (*s3.Client, *manager.Uploader, error) {
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if c.client != nil {
+        return c.client, c.uploader, nil
+    }
+
+    var opts []func(*config.LoadOptions) error
+    if c.Region != "" {
+        opts = append(opts, config.WithRegion(c.Region))
+    }
+    cfg, err := config.LoadDefaultConfig(ctx, opts...)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    log.Printf("Connecting to s3://%s in %s", c.Bucket, cfg.Region)
+    c.client = s3.NewFromConfig(cfg, func(o *s3.Options) {
+        if c.Endpoint != "" {
+            o.BaseEndpoint = aws.String(c.Endpoint)
+        }
+        o.UsePathStyle = c.PathStyle
+    })
+    c.uploader = manager.NewUploader(c.client, func(u *manager.Uploader) {
+        if c.PartSize > 0 {
+            u.PartSize = c.PartSize
+        }
+    })
+    return c.client, c.uploader, nil
+
+}
+
+// Store is a worker's handle on the shared client
+type Store struct {
+    client   *s3.Client
+    uploader *manager.Uploader
+    bucket   string
+}
+
+// Exec performs a backends operation against the bucket. An Insert uploads
+// the document, encoded as JSON, as <collection>/<key>.json, generating a
+// random key if the Insert has none, and a PutObject uploads its body as
+// <collection>/<key>, in parts if it's large.
+func (s *Store) Exec(ctx context.Context, op any) (any, error) {
+
+    switch op := op.(type) {
+    case backends.Insert:
+        names, values, err := backends.Fields(op.Document)
+        if err != nil {
+            return nil, err
+        }
+        fields := make(map[string]any, len(names))
+        for i, name := range names {
+            fields[name] = values[i]
+        }
+        body, err := json.Marshal(fields)
+        if err != nil {
+            return nil, err
+        }
+        _, err = s.uploader.Upload(ctx, &s3.PutObjectInput{
+            Bucket:      aws.String(s.bucket),
+            Key:         aws.String(key(op.Collection, op.Key) + ".json"),
+            Body:        bytes.NewReader(body),
+            ContentType: aws.String("application/json"),
+        })
+        return nil, err
+    case backends.PutObject:
+        _, err := s.uploader.Upload(ctx, &s3.PutObjectInput{
+            Bucket: aws.String(s.bucket),
+            Key:    aws.String(key(op.Collection, op.Key)),
+            Body:   op.Body,
+        })
+        return nil, err
+    }
+
+    return nil, backends.Unsupported("s3", op)
+
+}
+
+// Ping checks the bucket can be reached with the credentials provided
+func (s *Store) Ping(ctx context.Context) error {
+    _, err := s.client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(s.bucket)})
+    return err
+}
+
+// Close releases the worker's handle
+func (s *Store) Close() error {
+    return nil
+}
+
+// Key returns the name of an object in a collection, generating a random
+// one if id is empty
+func key(collection string, id string) string {
+    if id == "" {
+        var b [16]byte
+        rand.Read(b[:])
+        id = hex.EncodeToString(b[:])
+    }
+    return path.Join(collection, id)
+}
+
+// Classify recognises S3 asking for requests to slow down, and its
+// transient server errors, as worth retrying once the SDK's own retries
+// have given up. Other S3 errors, such as a missing bucket or being
+// denied access, will never succeed. Anything else falls back to the
+// pool's default classification.
+func Classify(err error) pool.ErrorClass {
+
+    var apiErr smithy.APIError
+    if errors.As(err, &apiErr) {
+        switch apiErr.ErrorCode() {
+        case "SlowDown", "RequestTimeout", "InternalError", "ServiceUnavailable":
+            return pool.Retryable
+        }
+        return pool.Fatal
+    }
+
+    return pool.DefaultClassifier(err)
+
+}
@@ -0,0 +1,695 @@
+// Package sqldb implements the pool's Connector and Store on top of
+// database/sql, for the SQL backends to share. Each backend supplies the
+// driver and its Dialect.
+package sqldb
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "slices"
+    "strings"
+    "sync"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+)
+
+// Dialect describes how a database's SQL differs from the others
+type Dialect struct {
+    // Name identifies the backend in errors
+    Name string
+
+    // Placeholder returns the placeholder for the n'th parameter of a
+    // statement, counting from 1, e.g. $1 or ?
+    Placeholder func(n int) string
+
+    // Quote quotes an identifier, such as a table or column name
+    Quote func(name string) string
+
+    // Upsert turns an INSERT of the columns into one which updates the
+    // existing row if one with the same keys exists, which relies on the
+    // keys having a unique index. Upserts aren't supported if it's nil.
+    Upsert func(insert string, columns []string, keys []string) string
+
+    // IndexExists reports whether an error creating an index is because
+    // there's already one with the same name
+    IndexExists func(err error) bool
+
+    // Classify classifies the database's errors, so that statements held
+    // in a transaction which fail in a way that will never succeed aren't
+    // replayed. The pool's DefaultClassifier is used if it's nil.
+    Classify pool.ErrorClassifier
+}
+
+// Connector opens a database/sql pool once, which the workers share, and
+// gives each worker a dedicated connection from it
+type Connector struct {
+    // Driver and DSN are passed to sql.Open
+    Driver  string
+    DSN     string
+    Dialect Dialect
+
+    // MaxConnections caps the number of open connections, which also caps
+    // the number of workers which can be connected at once. There's no
+    // limit if it's zero.
+    MaxConnections int
+
+    // Schema statements, such as CREATE TABLE IF NOT EXISTS, are run once
+    // when the database is first opened
+    Schema []string
+
+    // TxSize wraps every TxSize operations a worker performs in one
+    // transaction, as bulk loads usually are, rather than each being
+    // committed on its own. See Store.Exec.
+    TxSize int
+
+    mu sync.Mutex
+    db *sql.DB
+
+    // parked holds the statements each worker's Store couldn't commit when
+    // it was closed, until the worker reconnects
+    parked map[int][]call
+
+    // dropped holds an error for the statements the workers' Stores gave
+    // up on after the jobs which executed them had succeeded
+    dropped []error
+}
+
+// Connect returns a Store holding a dedicated connection for the worker.
+// The pool takes care of retrying, with backoff, if the database can't be
+// reached.
+func (c *Connector) Connect(ctx context.Context, workerId int) (pool.Store, error) {
+
+    db, err := c.open(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    conn, err := db.Conn(ctx)
+    if err != nil {
+        return nil, err
+    }
+    if err := conn.PingContext(ctx); err != nil {
+        conn.Close()
+        return nil, err
+    }
+
+    // Take up the statements the worker's last Store couldn't commit, to be
+    // replayed in its next transaction
+    c.mu.Lock()
+    pending := c.parked[workerId]
+    delete(c.parked, workerId)
+    c.mu.Unlock()
+
+    return &Store{
+        connector: c,
+        worker:    workerId,
+        conn:      conn,
+        dialect:   c.Dialect,
+        stmts:     make(map[string]*sql.Stmt),
+        txSize:    c.TxSize,
+        pending:   pending,
+    }, nil
+
+}
+
+// Close commits the statements the workers' Stores couldn't, and then
+// closes the shared pool once the workers have finished with it. An error
+// is returned for each worker's statements which still can't be committed,
+// as the jobs which executed them have already succeeded.
+func (c *Connector) Close() error {
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    errs := c.dropped
+    c.dropped = nil
+    for workerId, pending := range c.parked {
+        if err := c.commit(pending); err != nil {
+            errs = append(errs, fmt.Errorf("%s: %d statements executed by worker %d were never committed: %w", c.Dialect.Name, len(pending), workerId, err))
+        }
+    }
+    c.parked = nil
+
+    if c.db != nil {
+        errs = append(errs, c.db.Close())
+        c.db = nil
+    }
+    return errors.Join(errs...)
+
+}
+
+// Park keeps the statements a worker's Store couldn't commit until the
+// worker reconnects, or the Connector is closed
+func (c *Connector) park(workerId int, pending []call) {
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if c.parked == nil {
+        c.parked = map[int][]call{}
+    }
+    c.parked[workerId] = append(c.parked[workerId], pending...)
+
+}
+
+// Drop records the error for statements a worker's Store gave up on after
+// the jobs which executed them had succeeded, to be returned when the
+// Connector is closed
+func (c *Connector) drop(err error) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.dropped = append(c.dropped, err)
+}
+
+// Commit executes statements in one transaction on the shared pool. The
+// caller holds c.mu.
+func (c *Connector) commit(pending []call) error {
+
+    if c.db == nil {
+        return errors.New("the database was never opened")
+    }
+    tx, err := c.db.Begin()
+    if err != nil {
+        return err
+    }
+    for _, call := range pending {
+        if _, err := tx.Exec(call.query, call.args...); err != nil {
+            tx.Rollback()
+            return err
+        }
+    }
+    return tx.Commit()
+
+}
+
+// Open opens the shared pool and sets up the schema the first time it's
+// needed
+func (c *Connector) open(ctx context.Context) (*sql.DB, error) {
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if c.db != nil {
+        return c.db, nil
+    }
+
+    db, err := sql.Open(c.Driver, c.DSN)
+    if err != nil {
+        return nil, err
+    }
+    db.SetMaxOpenConns(c.MaxConnections)
+    for _, stmt := range c.Schema {
+        if _, err := db.ExecContext(ctx, stmt); err != nil {
+            db.Close()
+            return nil, err
+        }
+    }
+
+    c.db = db
+    return db, nil
+
+}
+
+// Store is a worker's connection to the database, with the statements it
+// has prepared on it and any transaction it has open
+type Store struct {
+    connector *Connector
+    worker    int
+    conn      *sql.Conn
+    dialect   Dialect
+    stmts     map[string]*sql.Stmt
+
+    txSize  int
+    tx      *sql.Tx
+    pending []call
+}
+
+// call is a statement executed in the open transaction, kept so that it
+// can be replayed if the transaction is rolled back, on the worker's next
+// connection if need be
+type call struct {
+    query string
+    args  []any
+}
+
+// Exec performs a backends operation against the database. An InsertMany
+// is a single INSERT of all of its rows, which succeeds or fails as a
+// whole. An Update or Delete which affects no rows returns
+// backends.ErrNotFound.
+//
+// If the Connector's TxSize is more than 1, every operation but a Count or
+// an EnsureIndex is executed in a transaction which is committed once it
+// holds TxSize of them, or when the Store is closed, and they succeed
+// before they're committed. If an operation or the commit fails, the
+// transaction is rolled back and its error returned, so the pool requeues
+// the operation's job, while the operations before it in the transaction
+// are replayed at the start of the next one. If replaying or committing
+// them fails with an error the Dialect classifies as Fatal they're dropped
+// instead, so they can't hold up the worker's later operations, and
+// returned as an error when the Connector is closed, as their jobs have
+// already succeeded. Operations still uncommitted when the Store is closed, such as when the worker is reconnecting after
+// losing the database, are kept on the Connector and replayed on the
+// worker's next connection, or committed when the Connector is closed.
+func (s *Store) Exec(ctx context.Context, op any) (any, error) {
+
+    switch op := op.(type) {
+    case backends.Insert:
+        columns, values, err := backends.Fields(op.Document)
+        if err != nil {
+            return nil, err
+        }
+        _, err = s.exec(ctx, s.insert(op.Collection, columns, 1), values)
+        return nil, err
+    case backends.InsertMany:
+        if len(op.Documents) == 0 {
+            return nil, nil
+        }
+        columns, _, err := backends.Fields(op.Documents[0])
+        if err != nil {
+            return nil, err
+        }
+        values := make([]any, 0, len(columns)*len(op.Documents))
+        for _, doc := range op.Documents {
+            fields, row, err := backends.Fields(doc)
+            if err != nil {
+                return nil, err
+            }
+            if !slices.Equal(fields, columns) {
+                return nil, fmt.Errorf("%s: the documents in an InsertMany must all have the same fields", s.dialect.Name)
+            }
+            values = append(values, row...)
+        }
+        _, err = s.exec(ctx, s.insert(op.Collection, columns, len(op.Documents)), values)
+        return nil, err
+    case backends.Upsert:
+        if s.dialect.Upsert == nil {
+            return nil, backends.Unsupported(s.dialect.Name, op)
+        }
+        columns, values, err := backends.Fields(op.Document)
+        if err != nil {
+            return nil, err
+        }
+        keys, _, err := backends.Fields(op.Filter)
+        if err != nil {
+            return nil, err
+        }
+        _, err = s.exec(ctx, s.dialect.Upsert(s.insert(op.Collection, columns, 1), columns, keys), values)
+        return nil, err
+    case backends.Count:
+        var n int64
+        err := s.conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+s.dialect.Quote(op.Collection)).Scan(&n)
+        return n, err
+    case backends.EnsureIndex:
+        _, err := s.conn.ExecContext(ctx, s.createIndex(op))
+        if err != nil && s.dialect.IndexExists != nil && s.dialect.IndexExists(err) {
+            return nil, nil
+        }
+        return nil, err
+    case backends.Find:
+        columns, values, err := backends.Fields(op.Filter)
+        if err != nil {
+            return nil, err
+        }
+        query := s.selectOne(op.Collection, columns)
+        if s.txSize <= 1 {
+            stmt, err := s.prepare(ctx, query)
+            if err != nil {
+                return nil, err
+            }
+            return scanOne(stmt.QueryContext(ctx, values...))
+        }
+
+        // Not finding the row doesn't roll the transaction back
+        var doc map[string]any
+        var found error
+        err = s.execTx(ctx, call{query: query, args: values}, func(stmt *sql.Stmt) error {
+            doc, found = scanOne(stmt.QueryContext(ctx, values...))
+            if errors.Is(found, backends.ErrNotFound) {
+                return nil
+            }
+            return found
+        })
+        if err != nil {
+            return nil, err
+        }
+        return doc, found
+    case backends.Update:
+        set, setValues, err := backends.Fields(op.Set)
+        if err != nil {
+            return nil, err
+        }
+        where, whereValues, err := backends.Fields(op.Filter)
+        if err != nil {
+            return nil, err
+        }
+        return nil, affected(s.exec(ctx, s.update(op.Collection, set, where), append(setValues, whereValues...)))
+    case backends.Delete:
+        where, values, err := backends.Fields(op.Filter)
+        if err != nil {
+            return nil, err
+        }
+        return nil, affected(s.exec(ctx, s.delete(op.Collection, where), values))
+    }
+
+    return nil, backends.Unsupported(s.dialect.Name, op)
+
+}
+
+// Exec executes a statement, in the worker's transaction if the
+// Connector's TxSize is more than 1
+func (s *Store) exec(ctx context.Context, query string, args []any) (sql.Result, error) {
+
+    if s.txSize <= 1 {
+        stmt, err := s.prepare(ctx, query)
+        if err != nil {
+            return nil, err
+        }
+        return stmt.ExecContext(ctx, args...)
+    }
+
+    var res sql.Result
+    err := s.execTx(ctx, call{query: query, args: args}, func(stmt *sql.Stmt) error {
+        var err error
+        res, err = stmt.ExecContext(ctx, args...)
+        return err
+    })
+    return res, err
+
+}
+
+// ExecTx runs a statement in the worker's transaction with run, beginning
+// one if need be, and commits it once it's full
+func (s *Store) execTx(ctx context.Context, c call, run func(stmt *sql.Stmt) error) error {
+
+    stmt, err := s.prepare(ctx, c.query)
+    if err != nil {
+        return err
+    }
+    if s.tx == nil {
+        if err := s.begin(ctx); err != nil {
+            return err
+        }
+    }
+
+    if err := run(s.tx.StmtContext(ctx, stmt)); err != nil {
+        s.rollback()
+        return err
+    }
+    s.pending = append(s.pending, c)
+    if len(s.pending) < s.txSize {
+        return nil
+    }
+
+    err = s.tx.Commit()
+    s.tx = nil
+    if err != nil {
+        s.pending = s.pending[:len(s.pending)-1]
+        s.dropIfFatal(err)
+        return err
+    }
+    s.pending = s.pending[:0]
+    return nil
+
+}
+
+// Begin opens a transaction and replays the statements of any which was
+// rolled back. If they fail in a way which will never succeed they're
+// dropped, and an empty transaction begun in its place. It outlives the
+// context of the job which begins it, as database/sql rolls a transaction
+// back when its context is done.
+func (s *Store) begin(ctx context.Context) error {
+
+    for {
+        tx, err := s.conn.BeginTx(context.WithoutCancel(ctx), nil)
+        if err != nil {
+            return err
+        }
+        s.tx = tx
+        err = s.replay(ctx)
+        if err == nil {
+            return nil
+        }
+        s.rollback()
+        if !s.dropIfFatal(err) {
+            return err
+        }
+    }
+
+}
+
+// Replay executes the pending statements in the open transaction
+func (s *Store) replay(ctx context.Context) error {
+
+    for _, c := range s.pending {
+        stmt, err := s.prepare(ctx, c.query)
+        if err != nil {
+            return err
+        }
+        if _, err := s.tx.StmtContext(ctx, stmt).ExecContext(ctx, c.args...); err != nil {
+            return err
+        }
+    }
+    return nil
+
+}
+
+// DropIfFatal drops the pending statements if replaying or committing them
+// failed with an error which is Fatal, recording it on the Connector, and
+// reports whether they were
+func (s *Store) dropIfFatal(err error) bool {
+
+    classify := s.dialect.Classify
+    if classify == nil {
+        classify = pool.DefaultClassifier
+    }
+    if len(s.pending) == 0 || classify(err) != pool.Fatal {
+        return false
+    }
+    s.connector.drop(fmt.Errorf("%s: %d statements executed by worker %d were dropped: %w", s.dialect.Name, len(s.pending), s.worker, err))
+    s.pending = nil
+    return true
+
+}
+
+// Rollback abandons the open transaction, keeping its statements pending
+func (s *Store) rollback() {
+    s.tx.Rollback()
+    s.tx = nil
+}
+
+// Flush commits the statements still pending in a transaction
+func (s *Store) flush() error {
+
+    if len(s.pending) == 0 {
+        return nil
+    }
+    if s.tx == nil {
+        if err := s.begin(context.Background()); err != nil {
+            return err
+        }
+    }
+    err := s.tx.Commit()
+    s.tx = nil
+    if err == nil {
+        s.pending = nil
+    } else {
+        s.dropIfFatal(err)
+    }
+    return err
+
+}
+
+// Insert builds an INSERT statement for the given number of rows of the
+// columns of a table
+func (s *Store) insert(table string, columns []string, rows int) string {
+
+    quoted := make([]string, len(columns))
+    for i, column := range columns {
+        quoted[i] = s.dialect.Quote(column)
+    }
+    tuples := make([]string, rows)
+    for row := range tuples {
+        params := make([]string, len(columns))
+        for i := range columns {
+            params[i] = s.dialect.Placeholder(row*len(columns) + i + 1)
+        }
+        tuples[row] = "(" + strings.Join(params, ", ") + ")"
+    }
+    return fmt.Sprintf("INSERT INTO %s (%s) VALUES %s",
+        s.dialect.Quote(table), strings.Join(quoted, ", "), strings.Join(tuples, ", "))
+
+}
+
+// CreateIndex builds a CREATE INDEX statement, naming the index after its
+// table and columns if it has no name
+func (s *Store) createIndex(op backends.EnsureIndex) string {
+
+    name := op.Name
+    columns := make([]string, len(op.Fields))
+    names := []string{op.Collection}
+    for i, field := range op.Fields {
+        columns[i] = s.dialect.Quote(field.Name)
+        if field.Descending {
+            columns[i] += " DESC"
+        }
+        names = append(names, field.Name)
+    }
+    if name == "" {
+        name = strings.Join(names, "_") + "_idx"
+    }
+
+    create := "CREATE INDEX "
+    if op.Unique {
+        create = "CREATE UNIQUE INDEX "
+    }
+    return create + s.dialect.Quote(name) + " ON " + s.dialect.Quote(op.Collection) + " (" + strings.Join(columns, ", ") + ")"
+
+}
+
+// SelectOne builds a SELECT statement for the first row of a table whose
+// columns have the given values
+func (s *Store) selectOne(table string, columns []string) string {
+
+    where := make([]string, len(columns))
+    for i, column := range columns {
+        where[i] = s.dialect.Quote(column) + " = " + s.dialect.Placeholder(i+1)
+    }
+    query := "SELECT * FROM " + s.dialect.Quote(table)
+    if len(where) > 0 {
+        query += " WHERE " + strings.Join(where, " AND ")
+    }
+    return query + " LIMIT 1"
+
+}
+
+// Update builds an UPDATE statement setting columns of the rows of a table
+// whose where columns have the given values. The parameters are the set
+// values followed by the where values.
+func (s *Store) update(table string, set []string, where []string) string {
+
+    assignments := make([]string, len(set))
+    for i, column := range set {
+        assignments[i] = s.dialect.Quote(column) + " = " + s.dialect.Placeholder(i+1)
+    }
+    conditions := make([]string, len(where))
+    for i, column := range where {
+        conditions[i] = s.dialect.Quote(column) + " = " + s.dialect.Placeholder(len(set)+i+1)
+    }
+    query := fmt.Sprintf("UPDATE %s SET %s", s.dialect.Quote(table), strings.Join(assignments, ", "))
+    if len(conditions) > 0 {
+        query += " WHERE " + strings.Join(conditions, " AND ")
+    }
+    return query
+
+}
+
+// Delete builds a DELETE statement for the rows of a table whose columns
+// have the given values
+func (s *Store) delete(table string, columns []string) string {
+
+    conditions := make([]string, len(columns))
+    for i, column := range columns {
+        conditions[i] = s.dialect.Quote(column) + " = " + s.dialect.Placeholder(i+1)
+    }
+    query := "DELETE FROM " + s.dialect.Quote(table)
+    if len(conditions) > 0 {
+        query += " WHERE " + strings.Join(conditions, " AND ")
+    }
+    return query
+
+}
+
+// Affected returns backends.ErrNotFound if a statement affected no rows
+func affected(res sql.Result, err error) error {
+    if err != nil {
+        return err
+    }
+    if n, err := res.RowsAffected(); err == nil && n == 0 {
+        return backends.ErrNotFound
+    }
+    return nil
+}
+
+// ScanOne reads the first row of a query's results into a map of its
+// columns, or returns backends.ErrNotFound if there isn't one
+func scanOne(rows *sql.Rows, err error) (map[string]any, error) {
+
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    if !rows.Next() {
+        if err := rows.Err(); err != nil {
+            return nil, err
+        }
+        return nil, backends.ErrNotFound
+    }
+    columns, err := rows.Columns()
+    if err != nil {
+        return nil, err
+    }
+    values := make([]any, len(columns))
+    ptrs := make([]any, len(columns))
+    for i := range values {
+        ptrs[i] = &values[i]
+    }
+    if err := rows.Scan(ptrs...); err != nil {
+        return nil, err
+    }
+
+    doc := make(map[string]any, len(columns))
+    for i, column := range columns {
+        if b, ok := values[i].([]byte); ok {
+            values[i] = string(b)
+        }
+        doc[column] = values[i]
+    }
+    return doc, rows.Err()
+
+}
+
+// Prepare returns a prepared statement for query, preparing it on the
+// worker's connection the first time it's used
+func (s *Store) prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+
+    if stmt, ok := s.stmts[query]; ok {
+        return stmt, nil
+    }
+    stmt, err := s.conn.PrepareContext(ctx, query)
+    if err != nil {
+        return nil, err
+    }
+    s.stmts[query] = stmt
+    return stmt, nil
+
+}
+
+// Ping checks the connection is still alive
+func (s *Store) Ping(ctx context.Context) error {
+    return s.conn.PingContext(ctx)
+}
+
+// Close commits the worker's open transaction, closes its prepared
+// statements and returns its connection to the shared pool. Statements
+// which can't be committed are kept on the Connector for the worker's next
+// Store, as the jobs which executed them have already succeeded.
+func (s *Store) Close() error {
+
+    var errs []error
+    if err := s.flush(); err != nil {
+        if len(s.pending) > 0 {
+            s.connector.park(s.worker, s.pending)
+            s.pending = nil
+        }
+        errs = append(errs, err)
+    }
+    for _, stmt := range s.stmts {
+        stmt.Close()
+    }
+    return errors.Join(append(errs, s.conn.Close())...)
+
+}
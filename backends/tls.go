@@ -0,0 +1,52 @@
+package backends
+
+import (
+    "crypto/tls"
+    "crypto/x509"
+    "fmt"
+    "os"
+)
+
+// TLS describes how a backend should secure its connections
+type TLS struct {
+    // CAFile is a PEM bundle of the certificate authorities to trust
+    // instead of the system's
+    CAFile string
+
+    // CertFile and KeyFile hold a client certificate to present, for
+    // servers which require mutual TLS
+    CertFile string
+    KeyFile  string
+
+    // InsecureSkipVerify accepts any server certificate, which is only
+    // suitable for testing
+    InsecureSkipVerify bool
+}
+
+// Config loads the certificates into a tls.Config
+func (t *TLS) Config() (*tls.Config, error) {
+
+    config := &tls.Config{InsecureSkipVerify: t.InsecureSkipVerify}
+
+    if t.CAFile != "" {
+        pem, err := os.ReadFile(t.CAFile)
+        if err != nil {
+            return nil, err
+        }
+        config.RootCAs = x509.NewCertPool()
+        if !config.RootCAs.AppendCertsFromPEM(pem) {
+            return nil, fmt.Errorf("no certificates found in %s", t.CAFile)
+        }
+    }
+
+    if t.CertFile != "" || t.KeyFile != "" {
+        cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+        if err != nil {
+            return nil, err
+        }
+        config.Certificates = []tls.Certificate{cert}
+    }
+
+    return config, nil
+
+}
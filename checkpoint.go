@@ -0,0 +1,172 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "os"
+    "sort"
+    "sync"
+    "time"
+)
+
+// Checkpoint is the state of a run as saved in the --checkpoint file: which
+// of the documents' jobs have finished, by the documents' ids
+type checkpoint struct {
+    // Completed is the highest contiguous id finished, plus one, so every
+    // document below it has been dealt with, and Done lists those above it
+    // which have finished out of order
+    Completed int   `json:"completed"`
+    Done      []int `json:"done,omitempty"`
+
+    // Failed lists the documents whose jobs finished but failed, which are
+    // run again when the run is resumed
+    Failed []int `json:"failed,omitempty"`
+}
+
+// Progress tracks which documents' jobs have finished, and saves it to the
+// --checkpoint file every --checkpoint-interval so that an interrupted run
+// can be resumed
+type progress struct {
+    path     string
+    interval time.Duration
+    saved    time.Time
+
+    mu        sync.Mutex
+    completed int
+    done      map[int]bool
+    failed    map[int]bool
+}
+
+// NewProgress creates a tracker which saves to the file at path, starting
+// from the checkpoint saved there if resume is set
+func newProgress(path string, interval time.Duration, resume bool) (*progress, error) {
+
+    p := &progress{path: path, interval: interval, saved: time.Now(), done: map[int]bool{}, failed: map[int]bool{}}
+    if !resume {
+        return p, nil
+    }
+
+    b, err := os.ReadFile(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return p, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    var c checkpoint
+    if err := json.Unmarshal(b, &c); err != nil {
+        return nil, err
+    }
+    p.completed = c.Completed
+    for _, id := range c.Done {
+        p.done[id] = true
+    }
+    for _, id := range c.Failed {
+        p.failed[id] = true
+    }
+    return p, nil
+
+}
+
+// Finished reports whether the job for the document with the given id has
+// succeeded, so a resumed run can skip it
+func (p *progress) finished(id int) bool {
+
+    if p == nil {
+        return false
+    }
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    return (id < p.completed || p.done[id]) && !p.failed[id]
+
+}
+
+// Count returns the number of documents whose jobs have succeeded
+func (p *progress) count() int {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    return p.completed + len(p.done) - len(p.failed)
+}
+
+// Finish records that the job for the document with the given id has
+// finished, and saves the progress if it's due
+func (p *progress) finish(id int, ok bool) error {
+
+    if p == nil {
+        return nil
+    }
+
+    p.mu.Lock()
+    if ok {
+        delete(p.failed, id)
+    } else {
+        p.failed[id] = true
+    }
+    if id >= p.completed {
+        p.done[id] = true
+        for p.done[p.completed] {
+            delete(p.done, p.completed)
+            p.completed++
+        }
+    }
+    p.mu.Unlock()
+
+    if time.Since(p.saved) < p.interval {
+        return nil
+    }
+    return p.save()
+
+}
+
+// Save writes the progress to the file, replacing it in one go so that a
+// crash while saving leaves the last checkpoint intact
+func (p *progress) save() error {
+
+    if p == nil {
+        return nil
+    }
+
+    p.mu.Lock()
+    c := checkpoint{Completed: p.completed}
+    for id := range p.done {
+        c.Done = append(c.Done, id)
+    }
+    for id := range p.failed {
+        c.Failed = append(c.Failed, id)
+    }
+    p.mu.Unlock()
+    sort.Ints(c.Done)
+    sort.Ints(c.Failed)
+
+    b, err := json.Marshal(c)
+    if err != nil {
+        return err
+    }
+    tmp := p.path + ".tmp"
+    if err := os.WriteFile(tmp, b, 0644); err != nil {
+        return err
+    }
+    p.saved = time.Now()
+    return os.Rename(tmp, p.path)
+
+}
+
+// Unfinished returns the specs whose jobs haven't all succeeded, so that a
+// resumed run doesn't do them again
+func (p *progress) unfinished(specs []jobSpec) []jobSpec {
+
+    if p == nil {
+        return specs
+    }
+    var left []jobSpec
+    for _, s := range specs {
+        for id := s.Id; id < s.Id+max(s.Size, 1); id++ {
+            if !p.finished(id) {
+                left = append(left, s)
+                break
+            }
+        }
+    }
+    return left
+
+}
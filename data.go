@@ -0,0 +1,86 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "log"
+    "math/rand"
+    "strings"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/brianvoe/gofakeit/v6"
+)
+
+// SeedFor derives the seed for the random data of the job with the given
+// id from --seed, so that each job's data is different, but the same on
+// every run with the same --seed
+func seedFor(id int) int64 {
+    return int64(uint64(*seed)*0x9E3779B97F4A7C15 ^ uint64(id))
+}
+
+// FakeUser generates a realistic user for a job with gofakeit, so that the
+// data's cardinality and compressibility are closer to production's. The
+// faker is seeded for the job's id, so a job always gets the same user
+// and the reads, updates and deletes of an earlier run's users find them,
+// and the id is kept in the email address so that it's still unique.
+func fakeUser(id int) User {
+
+    // Not gofakeit.New, which seeds itself at random when given 0
+    f := gofakeit.NewCustom(rand.NewSource(seedFor(id)).(rand.Source64))
+    first, last := f.FirstName(), f.LastName()
+    local := strings.ToLower(strings.ReplaceAll(first+"."+last, " ", ""))
+    return User{
+        Name:    first + " " + last,
+        Email:   fmt.Sprintf("%s.%d@%s", local, id, f.DomainName()),
+        Profile: f.URL(),
+    }
+
+}
+
+// Pad adds --extra-fields fields of random letters to the job's document,
+// and then a padding field of them to bring its JSON encoding up to about
+// --doc-size bytes, so that users can see how the size of the payload
+// affects throughput. A User is turned into a map first. The letters are
+// seeded for the job's id, so a job always gets the same document.
+func pad(doc any, id int) any {
+
+    if *extraFields <= 0 && *docSize <= 0 {
+        return doc
+    }
+
+    names, values, err := backends.Fields(doc)
+    if err != nil {
+        log.Fatal(err)
+    }
+    padded := make(map[string]any, len(names)+*extraFields+1)
+    for i, name := range names {
+        padded[name] = values[i]
+    }
+
+    r := rand.New(rand.NewSource(seedFor(id)))
+    for i := 1; i <= *extraFields; i++ {
+        padded[fmt.Sprintf("field%d", i)] = letters(r, 16)
+    }
+    if *docSize > 0 {
+        encoded, err := json.Marshal(padded)
+        if err != nil {
+            log.Fatal(err)
+        }
+        if n := *docSize - len(encoded) - len(`,"padding":""`); n > 0 {
+            padded["padding"] = letters(r, n)
+        }
+    }
+    return padded
+
+}
+
+// Letters returns n random lower case letters
+func letters(r *rand.Rand, n int) string {
+
+    b := make([]byte, n)
+    for i := range b {
+        b[i] = byte('a' + r.Intn(26))
+    }
+    return string(b)
+
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+)
+
+// dedupCollection is the collection (or table) --dedup=db records the
+// idempotency keys of the jobs which have succeeded in
+const dedupCollection = "idempotency"
+
+// NewDeduplicator returns the pool.Deduplicator chosen with --dedup, or nil
+// if jobs aren't deduplicated
+func newDeduplicator(name string) (pool.Deduplicator, error) {
+
+    switch name {
+    case "":
+        return nil, nil
+    case "memory":
+        return pool.NewMemoryDedup(), nil
+    case "db":
+        return dbDedup{}, nil
+    }
+    return nil, fmt.Errorf("unknown --dedup %q, expected memory or db", name)
+
+}
+
+// DBDedup is a pool.Deduplicator which keeps a document for each key in
+// the database being written to, so that duplicates are suppressed across
+// processes and restarts, at the cost of a read before each job and a
+// write after it. The backend must support Find and Upsert.
+type dbDedup struct{}
+
+// Seen looks the key's document up
+func (dbDedup) Seen(ctx context.Context, deps pool.Deps, key string) (bool, error) {
+
+    _, err := deps.Conn.Exec(ctx, backends.Find{Collection: dedupCollection, Key: key, Filter: map[string]any{"idempotency_key": key}})
+    if errors.Is(err, backends.ErrNotFound) {
+        return false, nil
+    }
+    return err == nil, err
+
+}
+
+// Record writes the key's document, if it isn't there already
+func (dbDedup) Record(ctx context.Context, deps pool.Deps, key string) error {
+    doc := map[string]any{"idempotency_key": key}
+    _, err := deps.Conn.Exec(ctx, backends.Upsert{Collection: dedupCollection, Key: key, Filter: doc, Document: doc})
+    return err
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+// ParseFairWeights parses --fair-weights, comma separated collection:weight
+// pairs such as users_0:3,users_1:2, into the weight of each collection
+func parseFairWeights(s string) (map[string]int, error) {
+
+    weights := map[string]int{}
+    if s == "" {
+        return weights, nil
+    }
+    for _, part := range strings.Split(s, ",") {
+        name, weight, ok := strings.Cut(strings.TrimSpace(part), ":")
+        if !ok || name == "" {
+            return nil, fmt.Errorf("--fair-weights %q: expected collection:weight, got %q", s, part)
+        }
+        if _, ok := weights[name]; ok {
+            return nil, fmt.Errorf("--fair-weights %q: %s is given more than once", s, name)
+        }
+        w, err := strconv.Atoi(weight)
+        if err != nil || w < 1 {
+            return nil, fmt.Errorf("--fair-weights %q: invalid weight %q for %s", s, weight, name)
+        }
+        weights[name] = w
+    }
+    return weights, nil
+
+}
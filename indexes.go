@@ -0,0 +1,96 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "log"
+    "os"
+    "strings"
+    "time"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+)
+
+// IndexSpec is an index as written in an --ensure-indexes file
+type indexSpec struct {
+    Collection string   `json:"collection"`
+    Name       string   `json:"name"`
+    Fields     []string `json:"fields"`
+    Unique     bool     `json:"unique"`
+}
+
+// ParseIndexes parses --ensure-indexes, which is either @ and the path of
+// a JSON file of indexes, such as [{"fields": ["email"], "unique": true}],
+// or a comma separated list of indexes on the users collections, each of
+// its fields joined with +, such as email:unique,name+-link. A leading -
+// makes a field descending, and a :unique suffix the index unique.
+func parseIndexes(spec string) ([]backends.EnsureIndex, error) {
+
+    var specs []indexSpec
+    if path, ok := strings.CutPrefix(spec, "@"); ok {
+        data, err := os.ReadFile(path)
+        if err != nil {
+            return nil, err
+        }
+        if err := json.Unmarshal(data, &specs); err != nil {
+            return nil, fmt.Errorf("%s: %w", path, err)
+        }
+    } else {
+        for _, index := range strings.Split(spec, ",") {
+            fields, unique := strings.CutSuffix(strings.TrimSpace(index), ":unique")
+            specs = append(specs, indexSpec{Fields: strings.Split(fields, "+"), Unique: unique})
+        }
+    }
+
+    var indexes []backends.EnsureIndex
+    for _, s := range specs {
+        index := backends.EnsureIndex{Name: s.Name, Unique: s.Unique}
+        for _, field := range s.Fields {
+            name, descending := strings.CutPrefix(field, "-")
+            if name == "" {
+                return nil, fmt.Errorf("--ensure-indexes %q: an index has an empty field", spec)
+            }
+            index.Fields = append(index.Fields, backends.IndexField{Name: name, Descending: descending})
+        }
+        if len(index.Fields) == 0 {
+            return nil, fmt.Errorf("--ensure-indexes %q: an index has no fields", spec)
+        }
+
+        // Indexes without a collection are created on every one the jobs
+        // use, which is usually just users
+        if s.Collection != "" {
+            index.Collection = s.Collection
+            indexes = append(indexes, index)
+            continue
+        }
+        for _, collection := range collectionNames() {
+            index.Collection = collection
+            indexes = append(indexes, index)
+        }
+    }
+    return indexes, nil
+
+}
+
+// EnsureIndexes creates the indexes over a connection of its own, before
+// the workers start, so that the time it takes isn't counted in the run
+func ensureIndexes(ctx context.Context, connect pool.Connector, indexes []backends.EnsureIndex) error {
+
+    start := time.Now()
+    conn, err := connect.Connect(ctx, 0)
+    if err != nil {
+        return err
+    }
+    defer conn.Close()
+
+    for _, index := range indexes {
+        if _, err := conn.Exec(ctx, index); err != nil {
+            return fmt.Errorf("index on %s: %w", index.Collection, err)
+        }
+    }
+    log.Printf("Ensured %d indexes exist in %s", len(indexes), time.Since(start))
+    return nil
+
+}
@@ -0,0 +1,605 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "math/rand"
+    "os"
+    "slices"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+)
+
+// errMismatch is the error a read fails with if the document it finds isn't
+// the one it expected
+var errMismatch = errors.New("document does not match")
+
+// NewJob creates the job with the given id which performs the operation
+func newJob(operation string, id int) pool.Job {
+
+    if operation == "insert" && *objectSize > 0 {
+        return UploadJob{Collection: collectionFor(id), Key: fmt.Sprintf("object-%d", id), Size: *objectSize, Seed: seedFor(id)}
+    }
+
+    // Only inserts can do without a way to find the document again
+    t := newTarget(id)
+    if t.Filter == nil && operation != "insert" && operation != "transaction" && operation != "aggregate" {
+        log.Fatalf("--op=%s needs the --template to define a filter", operation)
+    }
+
+    switch operation {
+    case "insert":
+        return InsertJob[any]{Collection: t.Collection, Key: t.Key, Document: t.Document}
+    case "upsert":
+        return UpsertJob{Collection: t.Collection, Key: t.Key, Filter: t.Filter, Document: t.Document}
+    case "read":
+        return FindJob{Collection: t.Collection, Key: t.Key, Filter: t.Filter, Expect: t.Expect}
+    case "update":
+        return UpdateJob{Collection: t.Collection, Key: t.Key, Filter: t.Filter, Set: t.Set}
+    case "delete":
+        return DeleteJob{Collection: t.Collection, Key: t.Key, Filter: t.Filter}
+    case "transaction":
+        return TransactionJob{Collection: t.Collection, User: NewUser(id)}
+    case "aggregate":
+        if len(pipelines) == 0 {
+            log.Fatal("--op=aggregate needs a file of --pipelines to run")
+        }
+        return &AggregateJob{Collection: t.Collection, Pipeline: pipelines[id%len(pipelines)]}
+    }
+
+    log.Fatalf("Unknown --op %q, expected one of %s", operation, strings.Join(operations, ", "))
+    return nil
+
+}
+
+// JobSpec is all that's needed to create a job, as the documents are
+// generated from the id, so that jobs can be kept in the --queue-file
+type jobSpec struct {
+    Op string `json:"op"`
+    Id int    `json:"id"`
+
+    // Size is the number of documents a bulk insert inserts
+    Size int `json:"size,omitempty"`
+}
+
+// Job creates the job
+func (s jobSpec) job() pool.Job {
+
+    if s.Size > 0 {
+        return newBulkJob(s.Id, s.Size)
+    }
+    return newJob(s.Op, s.Id)
+
+}
+
+// BatchSpecs chooses the jobs for the n'th batch, each of which works on
+// its own documents
+func batchSpecs(n int, blend *Mix) []jobSpec {
+
+    var batch []jobSpec
+    for i := 0; i < *jobs; i += max(*batchSize, 1) {
+        id := n**jobs + i
+        if *batchSize > 1 {
+            batch = append(batch, jobSpec{Op: "insert", Id: id, Size: min(*batchSize, *jobs-i)})
+        } else if blend != nil {
+            batch = append(batch, jobSpec{Op: blend.pick(), Id: id})
+        } else {
+            batch = append(batch, jobSpec{Op: *op, Id: id})
+        }
+    }
+    return batch
+
+}
+
+// BatchJobs creates the jobs for the n'th batch
+func batchJobs(n int, blend *Mix) []pool.Job {
+
+    var batch []pool.Job
+    for _, s := range batchSpecs(n, blend) {
+        batch = append(batch, s.job())
+    }
+    return batch
+
+}
+
+// CollectionFor returns the collection the job with the given id works on,
+// spreading the jobs across --collections of them in turn. A shard number
+// from the template maps to a collection the same way.
+func collectionFor(n int) string {
+
+    if *collections <= 1 {
+        return "users"
+    }
+    return fmt.Sprintf("users_%d", (n%*collections+*collections)%*collections)
+
+}
+
+// CollectionNames returns the names of all of the collections the jobs
+// are spread across
+func collectionNames() []string {
+
+    if *collections <= 1 {
+        return []string{"users"}
+    }
+    names := make([]string, *collections)
+    for i := range names {
+        names[i] = collectionFor(i)
+    }
+    return names
+
+}
+
+// Target is the document a job works on, and how to find it again
+type target struct {
+    Collection string
+
+    // Key identifies the document in key-value stores, and Filter finds
+    // it in databases which can query by field
+    Key    string
+    Filter map[string]any
+
+    Document any
+
+    // Expect are the fields a read checks the document it finds has, and
+    // Set the fields an update changes
+    Expect map[string]any
+    Set    map[string]any
+}
+
+// NewTarget creates the target of the job with the given id: a User, found
+// by its email address, unless there's a --template
+func newTarget(id int) target {
+
+    if docs != nil {
+        t, err := docs.target(id)
+        if err != nil {
+            log.Fatal(err)
+        }
+        if t.Collection == "" {
+            t.Collection = collectionFor(id)
+        }
+        t.Document = pad(t.Document, id)
+        return t
+    }
+
+    user := NewUser(id)
+    return target{
+        Collection: collectionFor(id),
+        Key:        user.Email,
+        Filter:     map[string]any{"email": user.Email},
+        Document:   pad(user, id),
+        Expect:     map[string]any{"name": user.Name, "email": user.Email},
+        Set:        map[string]any{"link": fmt.Sprintf("http://example.com/users/%d", id)},
+    }
+
+}
+
+// InsertJob carries a document of any type, which it inserts into the
+// collection under the given key
+type InsertJob[T any] struct {
+    Collection string
+    Key        string
+    Document   T
+}
+
+// Execute performs the database query using the worker's store
+func (j InsertJob[T]) Execute(ctx context.Context, deps pool.Deps) error {
+    _, err := deps.Conn.Exec(ctx, backends.Insert{Collection: j.Collection, Key: j.Key, Document: j.Document})
+    return err
+}
+
+// RoutingKey identifies the document the job works on, for --affinity
+func (j InsertJob[T]) RoutingKey() string {
+    return documentKey(j.Collection, j.Key)
+}
+
+// IdempotencyKey identifies the document the job inserts, for --dedup
+func (j InsertJob[T]) IdempotencyKey() string {
+    if j.Key == "" {
+        return ""
+    }
+    return "insert:" + j.Collection + "/" + j.Key
+}
+
+// Group is the collection the job is for, for --fair
+func (j InsertJob[T]) Group() string {
+    return j.Collection
+}
+
+// DocumentKey identifies a document by its collection and key, or returns
+// "" if it has no key
+func documentKey(collection string, key string) string {
+    if key == "" {
+        return ""
+    }
+    return collection + "/" + key
+}
+
+// NewBulkJob creates a job which inserts n documents, starting with the
+// one for the given id
+func newBulkJob(id int, n int) pool.Job {
+
+    job := &BulkInsertJob{Start: id, Collections: make([]string, n), Keys: make([]string, n), Documents: make([]any, n)}
+    for i := 0; i < n; i++ {
+        t := newTarget(id + i)
+        job.Collections[i], job.Keys[i], job.Documents[i] = t.Collection, t.Key, t.Document
+    }
+    return job
+
+}
+
+// BulkInsertJob inserts several documents with a single InsertMany for
+// each collection they belong in. If that fails with a BulkError naming the
+// documents which weren't inserted the batch is split up: those documents
+// are inserted one at a time instead, and when the job is retried only
+// those which are still failing are tried again, so a bad document doesn't
+// hold up the rest of its batch. Any other failure, such as losing the
+// connection, is left to the pool to retry the InsertMany.
+type BulkInsertJob struct {
+    // Start is the id of the first of the documents
+    Start int
+
+    Collections []string
+    Keys        []string
+    Documents   []any
+
+    // inserted records which documents are in, and is kept between
+    // attempts as the pool retries the same *BulkInsertJob
+    inserted []bool
+
+    // split records whether an InsertMany failed, so the batch was split
+    split bool
+}
+
+// Execute inserts the documents using the worker's store
+func (j *BulkInsertJob) Execute(ctx context.Context, deps pool.Deps) error {
+
+    if j.inserted == nil {
+        j.inserted = make([]bool, len(j.Documents))
+    }
+    if !j.split {
+        for _, collection := range j.collections() {
+
+            var indexes []int
+            var docs []any
+            for i, doc := range j.Documents {
+                if j.Collections[i] == collection && !j.inserted[i] {
+                    indexes = append(indexes, i)
+                    docs = append(docs, doc)
+                }
+            }
+            if len(docs) == 0 {
+                continue
+            }
+
+            _, err := deps.Conn.Exec(ctx, backends.InsertMany{Collection: collection, Documents: docs})
+            if err == nil {
+                for _, i := range indexes {
+                    j.inserted[i] = true
+                }
+                continue
+            }
+
+            // A failure which doesn't say which documents failed, such as a
+            // lost connection, is classified and retried by the pool
+            var bulk *backends.BulkError
+            if !errors.As(err, &bulk) {
+                return err
+            }
+
+            // Only the documents a partial failure reports are left to insert
+            j.split = true
+            for n, i := range indexes {
+                _, failed := bulk.Errors[n]
+                j.inserted[i] = !failed
+            }
+
+        }
+    }
+
+    var errs []error
+    for i, doc := range j.Documents {
+        if j.inserted[i] {
+            continue
+        }
+        if _, err := deps.Conn.Exec(ctx, backends.Insert{Collection: j.Collections[i], Key: j.Keys[i], Document: doc}); err != nil {
+            errs = append(errs, fmt.Errorf("%s: %w", j.Keys[i], err))
+            continue
+        }
+        j.inserted[i] = true
+    }
+    return errors.Join(errs...)
+
+}
+
+// IdempotencyKey identifies the range of documents the job inserts, for
+// --dedup
+func (j *BulkInsertJob) IdempotencyKey() string {
+    return fmt.Sprintf("bulk:%d+%d", j.Start, len(j.Documents))
+}
+
+// Skipped records that the job was skipped because its documents had all
+// been inserted already
+func (j *BulkInsertJob) skipped() {
+    j.inserted = make([]bool, len(j.Documents))
+    for i := range j.inserted {
+        j.inserted[i] = true
+    }
+}
+
+// Collections returns the distinct collections the documents belong in
+func (j *BulkInsertJob) collections() []string {
+
+    var distinct []string
+    for _, collection := range j.Collections {
+        if !slices.Contains(distinct, collection) {
+            distinct = append(distinct, collection)
+        }
+    }
+    return distinct
+
+}
+
+// Remaining returns the number of the job's documents which haven't been
+// inserted
+func (j *BulkInsertJob) remaining() int {
+
+    if j.inserted == nil {
+        return len(j.Documents)
+    }
+    n := 0
+    for _, inserted := range j.inserted {
+        if !inserted {
+            n++
+        }
+    }
+    return n
+
+}
+
+// UpsertJob inserts a document, replacing any which the filter matches, so
+// that running the same batch again doesn't create duplicates
+type UpsertJob struct {
+    Collection string
+    Key        string
+    Filter     map[string]any
+    Document   any
+}
+
+// Execute upserts the document using the worker's store
+func (j UpsertJob) Execute(ctx context.Context, deps pool.Deps) error {
+    _, err := deps.Conn.Exec(ctx, backends.Upsert{Collection: j.Collection, Key: j.Key, Filter: j.Filter, Document: j.Document})
+    return err
+}
+
+// RoutingKey identifies the document the job works on, for --affinity
+func (j UpsertJob) RoutingKey() string {
+    return documentKey(j.Collection, j.Key)
+}
+
+// Group is the collection the job is for, for --fair
+func (j UpsertJob) Group() string {
+    return j.Collection
+}
+
+// Profile is a user's profile, which a TransactionJob stores in a
+// collection of its own
+type Profile struct {
+    Email string `bson:"email"`
+    Link  string `bson:"link"`
+}
+
+// TransactionJob inserts a user into the collection and their profile into
+// the matching profiles collection in a single transaction, so that neither
+// is stored without the other
+type TransactionJob struct {
+    Collection string
+    User       User
+}
+
+// Execute inserts the user and profile using the worker's store
+func (j TransactionJob) Execute(ctx context.Context, deps pool.Deps) error {
+    _, err := deps.Conn.Exec(ctx, backends.Transaction{Ops: []any{
+        backends.Insert{Collection: j.Collection, Key: j.User.Email, Document: j.User},
+        backends.Insert{Collection: profilesFor(j.Collection), Key: j.User.Email, Document: Profile{Email: j.User.Email, Link: j.User.Profile}},
+    }})
+    return err
+}
+
+// ProfilesFor returns the collection holding the profiles of the users in
+// a collection, profiles_3 for users_3
+func profilesFor(collection string) string {
+    return "profiles" + strings.TrimPrefix(collection, "users")
+}
+
+// RoutingKey identifies the user the job inserts, for --affinity
+func (j TransactionJob) RoutingKey() string {
+    return documentKey(j.Collection, j.User.Email)
+}
+
+// IdempotencyKey identifies the user the job inserts, for --dedup
+func (j TransactionJob) IdempotencyKey() string {
+    return "transaction:" + j.User.Email
+}
+
+// Group is the collection the job inserts into, for --fair
+func (j TransactionJob) Group() string {
+    return j.Collection
+}
+
+// UploadJob uploads an object of random data to the collection, for
+// benchmarking object stores
+type UploadJob struct {
+    Collection string
+    Key        string
+    Size       int64
+
+    // Seed seeds the random data, so the object is the same every time
+    Seed int64
+}
+
+// Execute uploads the object using the worker's store. The data is
+// generated afresh for each attempt.
+func (j UploadJob) Execute(ctx context.Context, deps pool.Deps) error {
+    body := io.LimitReader(rand.New(rand.NewSource(j.Seed)), j.Size)
+    _, err := deps.Conn.Exec(ctx, backends.PutObject{Collection: j.Collection, Key: j.Key, Body: body})
+    return err
+}
+
+// IdempotencyKey identifies the object the job uploads, for --dedup
+func (j UploadJob) IdempotencyKey() string {
+    return "upload:" + j.Collection + "/" + j.Key
+}
+
+// Group is the collection the job is for, for --fair
+func (j UploadJob) Group() string {
+    return j.Collection
+}
+
+// FindJob reads back a document inserted by an earlier run, looking it up
+// by its key or filter, and checks it has the fields expected
+type FindJob struct {
+    Collection string
+    Key        string
+    Filter     map[string]any
+    Expect     map[string]any
+}
+
+// Execute finds the document using the worker's store
+func (j FindJob) Execute(ctx context.Context, deps pool.Deps) error {
+
+    value, err := deps.Conn.Exec(ctx, backends.Find{Collection: j.Collection, Key: j.Key, Filter: j.Filter})
+    if err != nil {
+        return err
+    }
+
+    doc, _ := value.(map[string]any)
+    for field, expected := range j.Expect {
+        if fmt.Sprint(doc[field]) != fmt.Sprint(expected) {
+            return fmt.Errorf("%w: found %v for %s", errMismatch, doc, j.Key)
+        }
+    }
+    return nil
+
+}
+
+// RoutingKey identifies the document the job works on, for --affinity
+func (j FindJob) RoutingKey() string {
+    return documentKey(j.Collection, j.Key)
+}
+
+// Group is the collection the job is for, for --fair
+func (j FindJob) Group() string {
+    return j.Collection
+}
+
+// UpdateJob changes fields of a document inserted by an earlier run, found
+// by its key or filter
+type UpdateJob struct {
+    Collection string
+    Key        string
+    Filter     map[string]any
+    Set        map[string]any
+}
+
+// Execute updates the document using the worker's store
+func (j UpdateJob) Execute(ctx context.Context, deps pool.Deps) error {
+    _, err := deps.Conn.Exec(ctx, backends.Update{Collection: j.Collection, Key: j.Key, Filter: j.Filter, Set: j.Set})
+    return err
+}
+
+// RoutingKey identifies the document the job works on, for --affinity
+func (j UpdateJob) RoutingKey() string {
+    return documentKey(j.Collection, j.Key)
+}
+
+// Group is the collection the job is for, for --fair
+func (j UpdateJob) Group() string {
+    return j.Collection
+}
+
+// DeleteJob removes a document inserted by an earlier run, found by its key
+// or filter
+type DeleteJob struct {
+    Collection string
+    Key        string
+    Filter     map[string]any
+}
+
+// Execute deletes the document using the worker's store
+func (j DeleteJob) Execute(ctx context.Context, deps pool.Deps) error {
+    _, err := deps.Conn.Exec(ctx, backends.Delete{Collection: j.Collection, Key: j.Key, Filter: j.Filter})
+    return err
+}
+
+// RoutingKey identifies the document the job works on, for --affinity
+func (j DeleteJob) RoutingKey() string {
+    return documentKey(j.Collection, j.Key)
+}
+
+// Group is the collection the job is for, for --fair
+func (j DeleteJob) Group() string {
+    return j.Collection
+}
+
+// Pipeline is a named aggregation pipeline, a list of stages such as $match
+// and $group
+type Pipeline struct {
+    Name   string
+    Stages []map[string]any
+}
+
+// pipelines are the aggregation pipelines loaded from --pipelines, which
+// aggregate jobs take turns to run
+var pipelines []Pipeline
+
+// LoadPipelines reads a JSON file of named aggregation pipelines, an object
+// such as {"by-domain": [{"$group": {"_id": "$link"}}]}, in name order
+func loadPipelines(path string) ([]Pipeline, error) {
+
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    var named map[string][]map[string]any
+    if err := json.Unmarshal(data, &named); err != nil {
+        return nil, fmt.Errorf("%s: %w", path, err)
+    }
+
+    loaded := make([]Pipeline, 0, len(named))
+    for name, stages := range named {
+        loaded = append(loaded, Pipeline{Name: name, Stages: stages})
+    }
+    sort.Slice(loaded, func(i, j int) bool { return loaded[i].Name < loaded[j].Name })
+    return loaded, nil
+
+}
+
+// AggregateJob runs an aggregation pipeline over a users collection, and
+// records how long the server took to execute it
+type AggregateJob struct {
+    Collection string
+    Pipeline   Pipeline
+    ServerTime time.Duration
+}
+
+// Execute runs the pipeline using the worker's store
+func (j *AggregateJob) Execute(ctx context.Context, deps pool.Deps) error {
+
+    value, err := deps.Conn.Exec(ctx, backends.Aggregate{Collection: j.Collection, Pipeline: j.Pipeline.Stages})
+    if err != nil {
+        return err
+    }
+    result, _ := value.(backends.AggregateResult)
+    j.ServerTime = result.ServerTime
+    return nil
+
+}
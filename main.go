@@ -11,15 +11,25 @@
 package main
 
 import (
+    "context"
+    "errors"
     "fmt"
-    "io"
     "log"
     "math"
+    "os"
+    "os/signal"
     "runtime"
+    "sort"
+    "strings"
+    "syscall"
     "time"
 
-    "github.com/ogier/pflag"
-    "labix.org/v2/mgo"
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends/fanout"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+    "github.com/PaulMaddox/golang-db-pool-pattern/sources"
+    "github.com/robfig/cron/v3"
+    "github.com/spf13/pflag"
 )
 
 // User is our database collection structure
@@ -29,42 +39,318 @@ type User struct {
     Profile string `bson:"link"`
 }
 
-// Job structure holds details of each job
-// This could be used to pass additional information to the worker
-type Job struct {
-    JobId int
-}
+// NewUser generates the user for a job, as chosen by --data
+func NewUser(id int) User {
+
+    if *data == "faker" {
+        return fakeUser(id)
+    }
+    return User{
+        Name:    fmt.Sprintf("User %d", id),
+        Email:   fmt.Sprintf("user-%d@example.com", id),
+        Profile: fmt.Sprintf("http://example.com/%d", id),
+    }
 
-// JobResult structure is returned by the worker to the master thread
-// and contains information about whether the job was successful or not
-type JobResult struct {
-    JobId    int
-    WorkerId int
-    Error    error
 }
 
 // Allow our options to be configured as CLI parameters
+var backend *string = pflag.String("backend", "mongo", "The database to load")
+var op *string = pflag.String("op", "insert", "The operation each job performs: insert, upsert (insert, replacing any existing user), read, update or delete the users inserted by an earlier run, aggregate them with --pipelines, or transaction (insert a user and their profile together)")
+var mix *string = pflag.String("mix", "", "Run a blend of operations instead of --op, as comma separated op:weight pairs, e.g. insert:70,read:20,update:10")
+var pipelinesFile *string = pflag.String("pipelines", "", "A JSON file of named MongoDB aggregation pipelines, e.g. {\"by-link\": [{\"$group\": {\"_id\": \"$link\"}}]}, which --op=aggregate jobs take turns to run")
+var indexes *string = pflag.String("ensure-indexes", "", "Indexes to create before the run starts, e.g. email:unique,name+-link on the users collection (- for descending), or @file.json for a list of {collection, name, fields, unique}")
+var watch *string = pflag.String("watch", "", "Instead of generating jobs, follow the change stream of this MongoDB collection (configured with the MongoDB options) and record each change in the changes collection of --backend until interrupted")
+var verifySample *int = pflag.Int("verify", 0, "After an insert run, count the documents in the users collections and read back this many of those inserted at random, reporting any discrepancy with the jobs which succeeded (default is no verification)")
+var cronSpec *string = pflag.String("cron", "", "Run as a daemon, starting a batch of --jobs jobs each time this cron schedule comes round, e.g. \"*/15 * * * *\" or @hourly, until interrupted")
+var queueFile *string = pflag.String("queue-file", "", "Keep the jobs which haven't finished in this BoltDB file, so that after a crash running again with the same file picks up the jobs which were left rather than starting over")
+var checkpointFile *string = pflag.String("checkpoint", "", "Save which jobs have finished to this file every --checkpoint-interval, as the highest contiguous document id completed and the ids which failed, so an interrupted run can be continued with --resume")
+var checkpointInterval *time.Duration = pflag.Duration("checkpoint-interval", 10*time.Second, "How often to save the --checkpoint file")
+var resume *bool = pflag.Bool("resume", false, "Continue the run saved in the --checkpoint file, skipping the jobs which completed and running the ones which failed again")
+var source *string = pflag.String("source", "", "")
+var enqueue *bool = pflag.Bool("enqueue", false, "Publish the jobs to the --source for other processes to run, rather than running them")
+var fanOut *string = pflag.String("fan-out", "", "A comma separated list of other backends to write every job to as well as --backend, e.g. kafka for an audit topic")
 var workers *int = pflag.Int("workers", runtime.NumCPU(), "The number of worker threads to spawn (default is 1 per CPU core)")
+var chunkSize *int = pflag.Int("chunk-size", 1, "Have each worker take up to this many queued jobs at a time, which cuts the overhead of handing out jobs at rates of 100k+ a second when they're tiny (default is a job at a time)")
 var jobs *int = pflag.Int("jobs", 128000, "The number of jobs to spawn")
-var host *string = pflag.String("host", "localhost", "The MongoDB hostname to connect to")
-var db *string = pflag.String("db", "worker-test", "The MongoDB database to use")
+var data *string = pflag.String("data", "sequential", "How users are generated: sequential (User 1, user-1@example.com, ...) or faker, for realistic and varied names, emails and links")
+var seed *int64 = pflag.Int64("seed", 0, "The seed for all of the random data generated, the --data=faker users, padding, --mix and --object-size objects, so runs with the same seed are identical")
+var collections *int = pflag.Int("collections", 1, "Spread the jobs across this many collections (or tables), users_0 to users_N-1, rather than all using users, with --op=transaction's profiles likewise in profiles_0 to profiles_N-1")
+var docSize *int = pflag.Int("doc-size", 0, "Pad each document with a field of random letters to about this many bytes, as JSON (default is no padding, about 80 bytes for a user)")
+var extraFields *int = pflag.Int("extra-fields", 0, "Add this many fields of 16 random letters, field1 to fieldN, to each document")
+var templateFile *string = pflag.String("template", "", "A text/template file of the JSON document each job writes, e.g. {\"sku\": \"item-{{.JobId}}\"}, instead of a user, which can {{define}} a \"filter\" query to find it again and a \"key\"")
+var batchSize *int = pflag.Int("batch-size", 1, "Insert this many users in each job with a single bulk insert, inserting them one at a time instead if it fails (default is a user per job)")
+var objectSize *int64 = pflag.Int64("object-size", 0, "Upload an object of this many random bytes for each job, rather than inserting a user, for object stores such as S3 or MongoDB's GridFS")
+var batches *int = pflag.Int("batches", 1, "The number of batches of jobs to run, one after another, on the same workers")
+var maxConnections *uint64 = pflag.Uint64("max-connections", 0, "The maximum number of connections the workers share to the database (default is the driver's limit, 100 for MongoDB, none for SQL databases and HTTP endpoints and 10 per CPU for Redis)")
+var txSize *int = pflag.Int("tx-size", 1, "Wrap every this many jobs on a worker in one transaction, for SQL backends (default is a transaction per job)")
+var maxAttempts *int = pflag.Int("max-attempts", 0, "The maximum number of times to try each job before failing it (default is no limit)")
+var jobTimeout *time.Duration = pflag.Duration("job-timeout", 0, "The maximum time each attempt at a job may take before it is failed or retried (default is no limit)")
+var ttl *time.Duration = pflag.Duration("ttl", 0, "Fail jobs which wait on the queue longer than this for a worker, rather than running them late (default is no limit)")
+var maxDuration *time.Duration = pflag.Duration("max-duration", 0, "The maximum time the whole run may take before it is aborted (default is no limit)")
+var affinity *bool = pflag.Bool("affinity", false, "Send every job on the same document to the same worker, so that the jobs on a document, such as the --watch changes to it, run in the order they were created")
+var fair *bool = pflag.Bool("fair", false, "Share the workers fairly between the collections the jobs are for, taking jobs for each in turn, so that a huge backlog for one collection doesn't hold up the others")
+var fairWeights *string = pflag.String("fair-weights", "", "With --fair, give some collections more jobs per turn than others, as comma separated collection:weight pairs, e.g. users_0:3,users_1:2 (default is 1 each)")
+var dedup *string = pflag.String("dedup", "", "Skip insert jobs which have already succeeded, e.g. when they're replayed after a crash or delivered twice by a --source, remembering them in memory (per process) or in the db (default is to run every job)")
+var failFast *int = pflag.Int("fail-fast", 0, "Abort the run once this many jobs have failed, or the first if no number is given (default is to keep going)")
+var lazyConnect *bool = pflag.Bool("lazy-connect", false, "Connect each worker when it receives its first job, rather than when it starts")
+var warmUp *int = pflag.Int("warm-up", 0, "Before timing the run, connect every worker and have each make this many throwaway inserts into the warmup collection (default is no warm-up)")
+var healthCheck *time.Duration = pflag.Duration("health-check", 0, "Ping each worker's connection once it has been idle this long, reconnecting if it fails (default is never)")
+var reconnectAttempts *int = pflag.Int("reconnect-attempts", 0, "Abort the run once a worker has failed to reconnect to the database this many times in a row (default is no limit)")
+var reconnectTimeout *time.Duration = pflag.Duration("reconnect-timeout", 0, "Abort the run once a worker has been unable to reconnect to the database for this long (default is no limit)")
+var breakerThreshold *float64 = pflag.Float64("breaker-threshold", 0, "Stop all workers for --breaker-cooldown once this fraction (0-1) of the last --breaker-window attempts have failed (default is no circuit breaker)")
+var breakerWindow *int = pflag.Int("breaker-window", 100, "The number of recent attempts the circuit breaker considers")
+var breakerCooldown *time.Duration = pflag.Duration("breaker-cooldown", 30*time.Second, "How long the circuit breaker stops the workers for once it trips")
+var retryDelay *time.Duration = pflag.Duration("retry-delay", pool.DefaultRetryBackoff.Initial, "The initial delay before retrying a job which failed transiently, which doubles with each attempt")
+var retryMaxDelay *time.Duration = pflag.Duration("retry-max-delay", pool.DefaultRetryBackoff.Max, "The maximum delay before retrying a job")
+var reconnectDelay *time.Duration = pflag.Duration("reconnect-delay", pool.DefaultBackoff.Initial, "The initial delay between attempts to reconnect to the database")
+var reconnectMaxDelay *time.Duration = pflag.Duration("reconnect-max-delay", pool.DefaultBackoff.Max, "The maximum delay between attempts to reconnect to the database")
 
 // Main spawns the required worker threads and then places all of the required
 // work onto the work queue, where the workers will pick it up from
 func main() {
 
     // Parse the CLI arguments
+    describeBackends()
+    describeSources()
+    pflag.Lookup("fail-fast").NoOptDefVal = "1"
     pflag.Parse()
 
-    log.Printf("Running %d jobs across %d workers", *jobs, *workers)
+    // Cancel the run cleanly on Ctrl-C, stopping job production,
+    // draining the workers and aborting any connection attempts
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+    defer stop()
+
+    // Abort the run the same way if it exceeds its time budget
+    if *maxDuration > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, *maxDuration)
+        defer cancel()
+    }
+
+    // Choose each job's operation from the --mix if there is one
+    var blend *Mix
+    if *mix != "" {
+        var err error
+        if blend, err = parseMix(*mix); err != nil {
+            log.Fatal(err)
+        }
+    }
+
+    if *data != "sequential" && *data != "faker" {
+        log.Fatalf("Unknown --data %q, expected sequential or faker", *data)
+    }
+
+    // Load the template of the documents to write instead of users
+    if *templateFile != "" {
+        var err error
+        if docs, err = loadTemplate(*templateFile); err != nil {
+            log.Fatal(err)
+        }
+    }
+
+    // Load the aggregation pipelines to run
+    if *pipelinesFile != "" {
+        var err error
+        if pipelines, err = loadPipelines(*pipelinesFile); err != nil {
+            log.Fatal(err)
+        }
+    }
+
+    if *batchSize > 1 && (*op != "insert" || blend != nil || *objectSize > 0) {
+        log.Fatal("--batch-size only applies to inserting users with --op=insert")
+    }
+
+    if *verifySample > 0 && (*op != "insert" || blend != nil || *objectSize > 0 || *watch != "" || *cronSpec != "") {
+        log.Fatal("--verify only applies to inserting documents with --op=insert")
+    }
+
+    // Run a batch each time the cron schedule comes round instead of
+    // running the batches straight away
+    var schedule cron.Schedule
+    if *cronSpec != "" {
+        var err error
+        if schedule, err = cron.ParseStandard(*cronSpec); err != nil {
+            log.Fatalf("Invalid --cron %q: %s", *cronSpec, err)
+        }
+    }
 
-    // Setup buffered input/output queues for the workers
-    queue := make(chan *Job, 512)
-    results := make(chan *JobResult, 512)
+    // Open the queue of jobs shared with other processes, and if this one
+    // is producing the jobs publish them there and stop
+    var src sources.Source
+    if *source != "" {
+        if *watch != "" || schedule != nil || *queueFile != "" || *checkpointFile != "" || *verifySample > 0 {
+            log.Fatal("--source can't be used with --watch, --cron, --queue-file, --checkpoint or --verify")
+        }
+        var err error
+        if src, err = sources.Open(*source); err != nil {
+            log.Fatal(err)
+        }
+        defer src.Close()
+    }
+    if *enqueue {
+        if src == nil {
+            log.Fatal("--enqueue needs a --source to publish the jobs to")
+        }
+        if err := publishJobs(ctx, src, blend); err != nil {
+            log.Fatalf("Unable to publish the jobs to %s: %s", *source, err)
+        }
+        return
+    }
+
+    // Pick up the jobs left in the --queue-file by a run which didn't
+    // finish, instead of generating them afresh
+    var durable *jobQueue
+    var pending []jobSpec
+    if *queueFile != "" {
+        if *watch != "" || schedule != nil {
+            log.Fatal("--queue-file can't be used with --watch or --cron")
+        }
+        var err error
+        if durable, pending, err = openJobQueue(*queueFile); err != nil {
+            log.Fatalf("Unable to open --queue-file: %s", err)
+        }
+    }
+
+    // Track which jobs finish, picking up from where an interrupted run got
+    // to if it's being resumed
+    var tracked *progress
+    if *checkpointFile != "" {
+        if *watch != "" || schedule != nil {
+            log.Fatal("--checkpoint can't be used with --watch or --cron")
+        }
+        var err error
+        if tracked, err = newProgress(*checkpointFile, *checkpointInterval, *resume); err != nil {
+            log.Fatalf("Unable to read --checkpoint: %s", err)
+        }
+    } else if *resume {
+        log.Fatal("--resume needs the --checkpoint file of the run to continue")
+    }
+
+    // When watching for changes, running on a schedule or receiving jobs
+    // from a --source, Ctrl-C stops the jobs coming in, and the pool
+    // finishes those already queued rather than cancelling them
+    total := *jobs * *batches
+    poolCtx := ctx
+    if *watch != "" {
+        log.Printf("Watching %s for changes across %d workers", *watch, *workers)
+        total = 0
+        poolCtx = context.WithoutCancel(ctx)
+    } else if schedule != nil {
+        log.Printf("Running %d jobs across %d workers on the schedule %q", *jobs, *workers, *cronSpec)
+        total = 0
+        poolCtx = context.WithoutCancel(ctx)
+    } else if src != nil {
+        log.Printf("Receiving jobs from %s across %d workers", *source, *workers)
+        total = 0
+        poolCtx = context.WithoutCancel(ctx)
+    } else if len(pending) > 0 {
+        total = 0
+        for _, s := range pending {
+            total += max(s.Size, 1)
+        }
+        log.Printf("Resuming %d jobs left in %s across %d workers", len(pending), *queueFile, *workers)
+    } else if *resume {
+        skipped := tracked.count()
+        total -= skipped
+        log.Printf("Resuming %d batches of %d jobs across %d workers, %d of them have already completed", *batches, *jobs, *workers, skipped)
+    } else {
+        log.Printf("Running %d batches of %d jobs across %d workers", *batches, *jobs, *workers)
+    }
 
     // Spin up the workers
-    for id := 0; id < *workers; id++ {
-        go worker(id, queue, results)
+    database, classify := openBackend()
+
+    // Create any indexes before the timer starts, as they change how fast
+    // the jobs run
+    if *indexes != "" {
+        specs, err := parseIndexes(*indexes)
+        if err != nil {
+            log.Fatal(err)
+        }
+        if err := ensureIndexes(ctx, database, specs); err != nil {
+            log.Fatalf("Unable to create indexes: %s", err)
+        }
+    }
+
+    backoff := pool.DefaultBackoff
+    backoff.Initial = *reconnectDelay
+    backoff.Max = *reconnectMaxDelay
+    retry := pool.DefaultRetryBackoff
+    retry.Initial = *retryDelay
+    retry.Max = *retryMaxDelay
+    opts := []pool.Option{
+        pool.WithWorkers(*workers),
+        pool.WithChunkSize(*chunkSize),
+        pool.WithMaxAttempts(*maxAttempts),
+        pool.WithJobTimeout(*jobTimeout),
+        pool.WithTTL(*ttl),
+        pool.WithRetryPolicy(pool.BackoffRetry{Backoff: retry}),
+        pool.WithReconnectBackoff(backoff),
+        pool.WithReconnectLimit(*reconnectAttempts, *reconnectTimeout),
+        pool.WithHealthCheck(*healthCheck),
+        pool.WithCircuitBreaker(pool.CircuitBreaker{
+            Window:    *breakerWindow,
+            Threshold: *breakerThreshold,
+            Cooldown:  *breakerCooldown,
+        }),
+        pool.WithErrorClassifier(classify),
+    }
+    if *failFast > 0 {
+        opts = append(opts, pool.WithFailFast(*failFast))
+    }
+    if *lazyConnect {
+        opts = append(opts, pool.WithLazyConnect())
+    }
+    if *affinity {
+        opts = append(opts, pool.WithKeyAffinity())
+    }
+    if *fair {
+        weights, err := parseFairWeights(*fairWeights)
+        if err != nil {
+            log.Fatal(err)
+        }
+        opts = append(opts, pool.WithFairScheduling(weights))
+    }
+    if deduplicator, err := newDeduplicator(*dedup); err != nil {
+        log.Fatal(err)
+    } else if deduplicator != nil {
+        opts = append(opts, pool.WithDeduplicator(deduplicator))
+    }
+    if *warmUp > 0 {
+        opts = append(opts, pool.WithWarmUp(func(ctx context.Context, deps pool.Deps) error {
+            if err := deps.Conn.Ping(ctx); err != nil {
+                return err
+            }
+            for i := 0; i < *warmUp; i++ {
+                doc := NewUser(deps.WorkerId**warmUp + i)
+                if _, err := deps.Conn.Exec(ctx, backends.Insert{Collection: "warmup", Document: doc}); err != nil {
+                    return err
+                }
+            }
+            return nil
+        }))
+    }
+    p := pool.NewJobPool(poolCtx, database, opts...)
+    p.Start()
+    pauseOnSignal(ctx, p)
+
+    // On SIGTERM drain the pool, letting the jobs in flight finish and
+    // closing the DB sessions, but skipping the jobs still queued
+    terminate := make(chan os.Signal, 1)
+    signal.Notify(terminate, syscall.SIGTERM)
+    go func() {
+        if _, ok := <-terminate; ok {
+            log.Printf("Received SIGTERM, draining in-flight jobs and exiting")
+            p.Drain()
+        }
+    }()
+
+    // Wait for the workers to finish warming up, if they are
+    if *warmUp > 0 {
+        log.Printf("Warming up %d workers", *workers)
+        if err := p.Ready(ctx); err == nil {
+            log.Printf("Workers warmed up")
+        }
     }
 
     // Now that the workers are ready, start
@@ -74,115 +360,378 @@ func main() {
     // Assign work to the workers
     // Do this in a new goroutine so that we don't block the results reading queue
     // if the queue hits it's buffer of 1024 items
-    go func(jobs *int, queue chan<- *Job) {
-        for i := 0; i < *jobs; i++ {
-            queue <- &Job{JobId: i}
+    go func(jobs *int, p *pool.Pool[pool.Job, struct{}]) {
+
+        // Once everything has been submitted close the queue, which
+        // will terminate all of the workers once the jobs are processed
+        defer func() {
+            log.Printf("Closing job queue and terminating workers")
+            p.Close()
+        }()
+
+        if *watch != "" {
+            watchChanges(ctx, p)
+            return
+        }
+        if schedule != nil {
+            runSchedule(ctx, p, schedule, blend)
+            return
+        }
+        if src != nil {
+            consumeSource(ctx, p, src)
+            return
+        }
+
+        // Run the jobs left by the last run as a batch of their own
+        if len(pending) > 0 {
+            batch := p.Batch()
+            for _, s := range pending {
+                if _, err := batch.Submit(durable.job(s)); err != nil {
+                    return
+                }
+            }
+            if stats, err := batch.Wait(); err == nil {
+                log.Printf("Resumed %d jobs (%d failed) in %s", stats.Completed, stats.Failed, stats.Duration)
+            }
+            return
         }
-    }(jobs, queue)
+
+        // With a --queue-file every batch is recorded up front, so a crash
+        // part way through leaves the batches after it to pick up too
+        specs := make([][]jobSpec, *batches)
+        if durable != nil {
+            for n := range specs {
+                specs[n] = tracked.unfinished(batchSpecs(n, blend))
+                if err := durable.add(specs[n]); err != nil {
+                    log.Printf("Unable to add batch %d to --queue-file: %s", n+1, err)
+                    return
+                }
+            }
+        }
+
+        // Run each batch to completion before starting the next
+        for n := 0; n < *batches; n++ {
+
+            if specs[n] == nil {
+                specs[n] = tracked.unfinished(batchSpecs(n, blend))
+            }
+            batch := p.Batch()
+            for _, s := range specs[n] {
+                if _, err := batch.Submit(durable.job(s)); err != nil {
+                    return
+                }
+            }
+            specs[n] = nil
+
+            stats, err := batch.Wait()
+            if err != nil {
+                return
+            }
+            log.Printf("Batch %d completed %d jobs (%d failed) in %s", n+1, stats.Completed, stats.Failed, stats.Duration)
+
+        }
+
+    }(jobs, p)
 
     // Get the results for each job
     announced := 0
-    for i := 0; i < *jobs; i++ {
+    completed := 0
+    retried := 0
+    drained := 0
+    duplicates := 0
+    expired := 0
+    targetSuccesses := map[string]int{}
+    targetFailures := map[string]int{}
+    succeeded := 0
+    split := 0
+    notFound := 0
+    mismatched := 0
+    latencies := make([]time.Duration, 0, total)
+    byOp := map[string]*opStats{}
+    serverTimes := map[string][]time.Duration{}
+    sampled := newSample(*verifySample)
+    p.Each(func(result *pool.JobResult[pool.Job, struct{}]) {
+
+        // Mark the job done in the --queue-file
+        id, err := durable.finish(poolCtx, result)
+        if err != nil {
+            log.Printf("Unable to update --queue-file: %s", err)
+        }
+        if err := acknowledge(poolCtx, result); err != nil {
+            log.Printf("Unable to mark job %d done on %s: %s", result.JobId, *source, err)
+        }
 
-        // Announce progress percentage in 5% chunks
-        percentage := int(math.Ceil(float64(i) / float64(*jobs) * 100))
-        if percentage > announced {
+        // A bulk insert counts as the jobs for each of its documents
+        size := 1
+        bulk, _ := result.Job.(*BulkInsertJob)
+        if bulk != nil {
+            size = len(bulk.Documents)
+        }
+
+        // Announce progress percentage in 5% chunks, or when watching for
+        // changes, running on a schedule or receiving from a --source,
+        // which never complete, every 1000 jobs
+        completed += size
+        if total == 0 {
+            if completed%1000 == 0 {
+                log.Printf("Processed %d jobs", completed)
+            }
+        } else if percentage := int(math.Ceil(float64(completed) / float64(total) * 100)); percentage > announced {
             announced = percentage
             if percentage%5 == 0 {
                 log.Printf("Processing %d%% complete", percentage)
             }
         }
 
-        // Fetch a result from the results queue (blocking)
-        result := <-results
-        if result.Error != nil {
-            log.Printf("Job %d failed on worker %d (%s)", result.JobId, result.WorkerId, result.Error)
-            continue
+        // Jobs skipped by draining the pool were never processed
+        if result.Error == pool.ErrDrained {
+            drained += size
+            return
         }
 
-    }
+        // A duplicate's documents were all inserted by an earlier run of it
+        if result.Duplicate {
+            duplicates += size
+            if bulk != nil {
+                bulk.skipped()
+            }
+        }
 
-    // We've got all of the results, so close the queue
-    // which will terminate all of the workers
-    log.Printf("Closing job queue and terminating workers")
-    close(queue)
+        // Record which documents' jobs have finished for --checkpoint
+        var saveErr error
+        if bulk != nil {
+            for i, ok := range bulk.inserted {
+                saveErr = errors.Join(saveErr, tracked.finish(bulk.Start+i, ok))
+            }
+        } else {
+            saveErr = tracked.finish(id, result.Error == nil)
+        }
+        if saveErr != nil {
+            log.Printf("Unable to save --checkpoint: %s", saveErr)
+        }
 
-    duration := time.Now().Sub(start)
-    ns := duration.Nanoseconds() / int64(*jobs)
-    avg := time.Unix(0, ns).Sub(time.Unix(0, 0))
+        if result.Attempts > 1 {
+            retried++
+        }
+        latencies = append(latencies, result.Duration)
+
+        // Break the statistics down by operation for a mixed workload
+        stats := &opStats{}
+        if blend != nil {
+            name := jobOp(result.Job)
+            if byOp[name] == nil {
+                byOp[name] = &opStats{}
+            }
+            stats = byOp[name]
+        }
+        stats.jobs++
+        stats.latencies = append(stats.latencies, result.Duration)
 
-    log.Printf("All threads completed successfully in %s", duration.String())
-    log.Printf("Average speed of %s per job", avg.String())
+        // Count the jobs which waited too long for a worker to be run
+        if result.Error == pool.ErrExpired {
+            expired += size
+        }
 
-}
+        // Count the reads and updates which didn't find the user they expected,
+        // which aren't retried
+        if errors.Is(result.Error, backends.ErrNotFound) {
+            notFound++
+            stats.notFound++
+        } else if errors.Is(result.Error, errMismatch) {
+            mismatched++
+            stats.mismatched++
+        }
 
-// Worker spawns a new worker process that connects to the DB
-// and waits for incoming jobs in the 'queue' channel.
-// If a job is successful it will send the results back on the 'results'
-// channel. If a job fails to complete due to DB not being connected
-// it will put the failed job back on the 'queue' channel, re-establish
-// DB connectivity and the continue processing jobs.
-func worker(id int, queue chan *Job, results chan<- *JobResult) {
-
-    // Lets keep track of how many jobs this worker processed
-    var count int64 = 0
-
-    // Keep trying to connect to the database until we get a connection
-    var session *mgo.Session
-    users := connect(id, session)
-    //defer session.Close()
-
-    // Wait for incoming jobs on the job queue (blocking) or for the queue to close
-    for job := range queue {
-
-        // Perform the database query
-        err := users.Insert(User{
-            Name:    fmt.Sprintf("User %d", job.JobId),
-            Email:   fmt.Sprintf("user-%d@example.com", job.JobId),
-            Profile: fmt.Sprintf("http://example.com/%d", job.JobId),
-        })
-
-        if err == io.EOF || err == io.ErrUnexpectedEOF {
-            // Our job hasn't completed because the database is no longer connected
-            // Put our job back onto the queue (in another go routine to avoid blocking if queue buffer is full)
-            // Then reconnect the database and continue processing
-            go func(job *Job, queue chan *Job) {
-                queue <- job
-            }(job, queue)
-            users = connect(id, session)
-            continue
+        // Record how long the server spent on each aggregation pipeline
+        if agg, ok := result.Job.(*AggregateJob); ok && result.Error == nil {
+            serverTimes[agg.Pipeline.Name] = append(serverTimes[agg.Pipeline.Name], agg.ServerTime)
+        }
+
+        // Record which of the targets a fanned out job succeeded and failed
+        // on, which the fan-out has finished retrying
+        if fan, ok := database.(*fanout.Connector); ok {
+            fan.Forget(result.JobId)
+        }
+        if results, ok := result.Outcome.(fanout.Results); ok {
+            for name, err := range results {
+                if err != nil {
+                    targetFailures[name]++
+                } else {
+                    targetSuccesses[name]++
+                }
+            }
+        }
+
+        // Sample the documents inserted for --verify
+        if bulk != nil {
+            succeeded += size - bulk.remaining()
+            if bulk.split {
+                split++
+            }
+            for i, ok := range bulk.inserted {
+                if ok {
+                    sampled.add(bulk.Start + i)
+                }
+            }
+        } else if result.Error == nil {
+            succeeded++
+            sampled.add(id)
+        }
+        if result.Error != nil {
+            stats.failed++
+            log.Printf("Job %d failed on worker %d after %d attempts (%s)", result.JobId, result.WorkerId, result.Attempts, result.Error)
         }
 
-        // Send our results back
-        results <- &JobResult{
-            JobId:    job.JobId,
-            WorkerId: id,
-            Error:    err,
+    })
+
+    // Check the inserts against the database while the shared client is
+    // still open
+    discrepancy := false
+    if *verifySample > 0 && poolCtx.Err() == nil {
+        ok, err := verify(ctx, database, succeeded, sampled.ids)
+        if err != nil {
+            log.Printf("Unable to verify the run: %s", err)
         }
+        discrepancy = !ok
+    }
 
-        count++
+    // The workers have all exited, so the shared client can go, once the
+    // backend has written anything it was still holding on to
+    unwritten := database.Close()
+    if unwritten != nil {
+        log.Printf("Unable to write everything to the database: %s", unwritten)
+    }
+    if err := durable.close(); err != nil {
+        log.Printf("Unable to update --queue-file: %s", err)
+    }
+    if err := tracked.save(); err != nil {
+        log.Printf("Unable to save --checkpoint: %s", err)
+    }
 
+    aborted := poolCtx.Err()
+    if aborted != nil {
+        log.Printf("Run cancelled after %d of %d jobs (%s)", completed, total, aborted)
+    }
+    if err := p.Err(); errors.Is(err, pool.ErrUnreachable) {
+        log.Printf("Run aborted after %d of %d jobs, the database is unreachable (%s)", completed, total, err)
+        aborted = err
+    } else if err != nil {
+        log.Printf("Run aborted after %d jobs failed:\n%s", *failFast, err)
+        aborted = err
+    }
+    if drained > 0 {
+        log.Printf("Run drained, %d queued jobs were not processed", drained)
+        completed -= drained
+        aborted = pool.ErrDrained
     }
 
-}
+    duration := time.Now().Sub(start)
+    if completed == 0 {
+        if aborted != nil || unwritten != nil {
+            os.Exit(1)
+        }
+        return
+    }
+    ns := duration.Nanoseconds() / int64(completed)
+    avg := time.Unix(0, ns).Sub(time.Unix(0, 0))
 
-// Connect (re)connects to the database and returns a handle to a mongodb
-// collection which can be used for CRUD operations
-func connect(workerId int, session *mgo.Session) *mgo.Collection {
+    if completed == total {
+        log.Printf("All threads completed successfully in %s", duration.String())
+    } else {
+        log.Printf("Completed %d jobs in %s", completed, duration.String())
+    }
+    log.Printf("Average speed of %s per job", avg.String())
+    if *backend == "mongo" {
+        log.Printf("Workers used %s sessions", *sessionMode)
+    }
+    log.Printf("%d jobs needed more than one attempt", retried)
+    if duplicates > 0 {
+        log.Printf("%d jobs were skipped as duplicates of jobs which had already succeeded", duplicates)
+    }
+    if expired > 0 {
+        log.Printf("%d jobs expired after waiting longer than --ttl for a worker", expired)
+    }
 
-    for {
+    if *batchSize > 1 {
+        log.Printf("Inserted %d users, %d bulk inserts had to be split up", succeeded, split)
+    }
+    if *op == "delete" && blend == nil {
+        log.Printf("Deleted %d users, %d were missing", succeeded, notFound)
+    } else if notFound > 0 || mismatched > 0 {
+        log.Printf("%d users were not found and %d did not match what was expected", notFound, mismatched)
+    }
 
-        // Open a DB connection
-        log.Printf("Worker %d: Connecting to %s", workerId, fmt.Sprintf("mongodb://%s/%s", *host, *db))
-        s, err := mgo.Dial(*host)
-        if err != nil {
-            log.Printf("Worker %d: Unable to connect to database (%s)", workerId, err)
+    // Report how each target fared when fanning out
+    if *fanOut != "" {
+        for _, name := range append([]string{*backend}, strings.Split(*fanOut, ",")...) {
+            log.Printf("Target %s: %d jobs succeeded, %d failed", name, targetSuccesses[name], targetFailures[name])
+        }
+    }
+
+    // Report the distribution of how long the jobs themselves took
+    sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+    log.Printf("Job latency p50 %s, p90 %s, p99 %s, max %s",
+        percentile(latencies, 50), percentile(latencies, 90),
+        percentile(latencies, 99), percentile(latencies, 100))
+
+    // And the same for each operation of a mixed workload
+    if blend != nil {
+        for _, name := range blend.ops {
+            stats := byOp[name]
+            if stats == nil {
+                continue
+            }
+            sort.Slice(stats.latencies, func(i, j int) bool { return stats.latencies[i] < stats.latencies[j] })
+            log.Printf("%s: %d jobs (%.1f%%), %d failed, %d not found, %d mismatched, latency p50 %s, p99 %s",
+                name, stats.jobs, float64(stats.jobs)/float64(len(latencies))*100,
+                stats.failed, stats.notFound, stats.mismatched,
+                percentile(stats.latencies, 50), percentile(stats.latencies, 99))
+        }
+    }
+
+    // Report the time the server spent executing each pipeline
+    for _, pipeline := range pipelines {
+        times := serverTimes[pipeline.Name]
+        if len(times) == 0 {
             continue
         }
+        sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+        log.Printf("Pipeline %s ran %d times, server time p50 %s, p90 %s, p99 %s, max %s",
+            pipeline.Name, len(times), percentile(times, 50), percentile(times, 90),
+            percentile(times, 99), percentile(times, 100))
+    }
 
-        // Connect to the DB collection
-        return s.DB(*db).C("users")
+    // Report any reconnections, and which workers made them, so that a
+    // flapping connection stands out
+    if r := p.Reconnects(); r.Reconnects > 0 {
+        log.Printf("%d reconnects taking %d attempts, %s total downtime (longest %s)",
+            r.Reconnects, r.Attempts, r.Downtime, r.MaxDowntime)
+        ids := make([]int, 0, len(r.ByWorker))
+        for id := range r.ByWorker {
+            ids = append(ids, id)
+        }
+        sort.Ints(ids)
+        for _, id := range ids {
+            log.Printf("Worker %d reconnected %d times", id, r.ByWorker[id])
+        }
+    }
 
+    // Let scripts know the run didn't complete, or didn't leave the
+    // database as it should have
+    if aborted != nil || discrepancy || unwritten != nil {
+        os.Exit(1)
     }
 
 }
+
+// Percentile returns the p'th percentile of the sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+    if len(sorted) == 0 {
+        return 0
+    }
+    i := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+    if i < 0 {
+        i = 0
+    }
+    return sorted[i]
+}
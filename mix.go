@@ -0,0 +1,104 @@
+package main
+
+import (
+    "fmt"
+    "math/rand"
+    "slices"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+)
+
+// operations are the names --op and --mix accept
+var operations = []string{"insert", "upsert", "read", "update", "delete", "transaction", "aggregate"}
+
+// Mix is a blend of operations, each of which is chosen for a share of the
+// jobs in proportion to its weight
+type Mix struct {
+    ops     []string
+    weights []int
+    total   int
+
+    rand *rand.Rand
+}
+
+// ParseMix parses a --mix of comma separated op:weight pairs, such as
+// insert:70,read:20,update:10
+func parseMix(s string) (*Mix, error) {
+
+    m := &Mix{rand: rand.New(rand.NewSource(*seed))}
+    for _, part := range strings.Split(s, ",") {
+        name, weight, ok := strings.Cut(strings.TrimSpace(part), ":")
+        if !ok {
+            return nil, fmt.Errorf("--mix %q: expected op:weight, got %q", s, part)
+        }
+        if !slices.Contains(operations, name) {
+            return nil, fmt.Errorf("--mix %q: unknown op %q, expected one of %s", s, name, strings.Join(operations, ", "))
+        }
+        if slices.Contains(m.ops, name) {
+            return nil, fmt.Errorf("--mix %q: %s is given more than once", s, name)
+        }
+        w, err := strconv.Atoi(weight)
+        if err != nil || w < 0 {
+            return nil, fmt.Errorf("--mix %q: invalid weight %q for %s", s, weight, name)
+        }
+        m.ops = append(m.ops, name)
+        m.weights = append(m.weights, w)
+        m.total += w
+    }
+    if m.total == 0 {
+        return nil, fmt.Errorf("--mix %q: the weights add up to zero", s)
+    }
+    return m, nil
+
+}
+
+// Pick chooses the operation for a job at random, in proportion to the
+// weights, so the operations are interleaved throughout the run. The
+// choices are the same on every run with the same --seed.
+func (m *Mix) pick() string {
+
+    n := m.rand.Intn(m.total)
+    for i, w := range m.weights {
+        if n < w {
+            return m.ops[i]
+        }
+        n -= w
+    }
+    return m.ops[len(m.ops)-1]
+
+}
+
+// OpStats are the statistics for the jobs performing one operation
+type opStats struct {
+    jobs       int
+    failed     int
+    notFound   int
+    mismatched int
+    latencies  []time.Duration
+}
+
+// JobOp returns the name of the operation a job performs
+func jobOp(job pool.Job) string {
+
+    switch job.(type) {
+    case InsertJob[any], UploadJob, *BulkInsertJob:
+        return "insert"
+    case UpsertJob:
+        return "upsert"
+    case FindJob:
+        return "read"
+    case UpdateJob:
+        return "update"
+    case DeleteJob:
+        return "delete"
+    case TransactionJob:
+        return "transaction"
+    case *AggregateJob:
+        return "aggregate"
+    }
+    return fmt.Sprintf("%T", job)
+
+}
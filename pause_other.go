@@ -0,0 +1,15 @@
+//go:build !unix
+
+package main
+
+import (
+    "context"
+)
+
+// PauseOnSignal is a no-op on platforms without SIGUSR1
+func pauseOnSignal(ctx context.Context, p interface {
+    Pause()
+    Resume()
+    Paused() bool
+}) {
+}
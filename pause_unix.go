@@ -0,0 +1,43 @@
+//go:build unix
+
+package main
+
+import (
+    "context"
+    "log"
+    "os"
+    "os/signal"
+    "syscall"
+)
+
+// PauseOnSignal toggles the pool between paused and running each time the
+// process receives SIGUSR1, so that operators can halt writes during a
+// maintenance window without losing queued jobs
+func pauseOnSignal(ctx context.Context, p interface {
+    Pause()
+    Resume()
+    Paused() bool
+}) {
+
+    signals := make(chan os.Signal, 1)
+    signal.Notify(signals, syscall.SIGUSR1)
+
+    go func() {
+        defer signal.Stop(signals)
+        for {
+            select {
+            case <-signals:
+                if p.Paused() {
+                    log.Printf("Received SIGUSR1, resuming processing")
+                    p.Resume()
+                } else {
+                    log.Printf("Received SIGUSR1, pausing processing (send SIGUSR1 again to resume)")
+                    p.Pause()
+                }
+            case <-ctx.Done():
+                return
+            }
+        }
+    }()
+
+}
@@ -0,0 +1,283 @@
+package pool
+
+import (
+    "hash/fnv"
+    "sync"
+)
+
+// Routed is implemented by jobs with a routing key, such as the id of the
+// document they work on. With WithKeyAffinity, every job with the same key
+// goes to the same worker, so jobs on the same document run one at a time
+// in the order they were submitted. An empty key means the job can go to
+// any worker.
+type Routed interface {
+    RoutingKey() string
+}
+
+// RoutingKey returns the job's routing key, or "" if it isn't Routed, for
+// jobs which wrap others to pass the key through
+func RoutingKey(job any) string {
+    if routed, ok := job.(Routed); ok {
+        return routed.RoutingKey()
+    }
+    return ""
+}
+
+// WithKeyAffinity gives each worker a queue of its own, and sends Routed
+// jobs to the worker their key hashes to, while other jobs go to whichever
+// worker is free. A routed job which fails is retried by its worker before
+// it takes the next, so later jobs with the same key wait for it rather
+// than overtaking it. A worker with nothing to do steals work from the
+// others' queues a key at a time: it takes every job queued for a key none
+// of whose jobs is running, and the key's jobs go to it from then on until
+// they've all finished, so skewed keys don't leave workers idle and the
+// jobs for each key still run in order.
+func WithKeyAffinity() Option {
+    return func(c *config) {
+        c.affinity = true
+    }
+}
+
+// router holds the workers' own queues of routed jobs, and which worker
+// each key's jobs are going to while it has any queued or running
+type router[J any] struct {
+    mu     sync.Mutex
+    queues []*routedQueue[J]
+    keys   map[string]*route
+    size   int
+
+    // backlog is signalled when a worker has jobs queued behind the one
+    // it's running, for an idle worker to steal
+    backlog chan struct{}
+}
+
+// routedQueue is a worker's own queue. Ready is signalled when jobs are
+// added to it and space when they're taken off.
+type routedQueue[J any] struct {
+    tasks   []*task[J]
+    running bool
+    ready   chan struct{}
+    space   chan struct{}
+}
+
+// route is where a key's jobs are going, and how many of them are queued or
+// running
+type route struct {
+    worker  int
+    jobs    int
+    running bool
+}
+
+// newRouter creates a queue for each worker with room for size jobs
+func newRouter[J any](workers int, size int) *router[J] {
+
+    r := &router[J]{queues: make([]*routedQueue[J], workers), keys: map[string]*route{}, size: size, backlog: make(chan struct{}, 1)}
+    for i := range r.queues {
+        r.queues[i] = &routedQueue[J]{ready: make(chan struct{}, 1), space: make(chan struct{}, 1)}
+    }
+    return r
+
+}
+
+// signal wakes whoever is waiting on the channel, if no-one has already
+func signal(c chan struct{}) {
+    select {
+    case c <- struct{}{}:
+    default:
+    }
+}
+
+// add places a task on the queue of the worker its key is going to, or
+// returns the channel to wait on for room if that queue is full
+func (r *router[J]) add(t *task[J], key string) (<-chan struct{}, bool) {
+
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    k := r.keys[key]
+    if k == nil {
+        h := fnv.New64a()
+        h.Write([]byte(key))
+        k = &route{worker: jump(h.Sum64(), len(r.queues))}
+    }
+    q := r.queues[k.worker]
+    if len(q.tasks) >= r.size {
+        return q.space, false
+    }
+    r.keys[key] = k
+    k.jobs++
+    q.tasks = append(q.tasks, t)
+    signal(q.ready)
+    if len(q.tasks) > 1 || q.running {
+        signal(r.backlog)
+    }
+    return nil, true
+
+}
+
+// take removes the task at the head of the worker's queue, if there is one,
+// and marks its key as running
+func (r *router[J]) take(worker int, key func(t *task[J]) string) *task[J] {
+
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    q := r.queues[worker]
+    if len(q.tasks) == 0 {
+        return nil
+    }
+    t := q.tasks[0]
+    q.tasks[0] = nil
+    q.tasks = q.tasks[1:]
+    q.running = true
+    if k := r.keys[key(t)]; k != nil {
+        k.running = true
+    }
+    signal(q.space)
+    if len(q.tasks) > 0 {
+        signal(q.ready)
+    }
+    return t
+
+}
+
+// steal moves the jobs for one key from the longest of the other workers'
+// queues to this worker's, if its own is empty, choosing the first key in
+// that queue none of whose jobs is running. It reports whether it stole
+// anything.
+func (r *router[J]) steal(worker int, key func(t *task[J]) string) bool {
+
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    // A worker with jobs of its own passes the signal on to one without
+    mine := r.queues[worker]
+    if len(mine.tasks) > 0 {
+        signal(r.backlog)
+        return false
+    }
+
+    // Only a worker with a backlog is worth stealing from, not one which
+    // is about to take the job on its queue itself
+    victim := -1
+    for i, q := range r.queues {
+        if i == worker || len(q.tasks) == 0 || (len(q.tasks) == 1 && !q.running) {
+            continue
+        }
+        if victim < 0 || len(q.tasks) > len(r.queues[victim].tasks) {
+            victim = i
+        }
+    }
+    if victim < 0 {
+        return false
+    }
+
+    q := r.queues[victim]
+    stolen := ""
+    for _, t := range q.tasks {
+        if k := r.keys[key(t)]; k != nil && !k.running {
+            stolen = key(t)
+            k.worker = worker
+            break
+        }
+    }
+    if stolen == "" {
+        return false
+    }
+    left := q.tasks[:0]
+    for _, t := range q.tasks {
+        if key(t) == stolen {
+            mine.tasks = append(mine.tasks, t)
+        } else {
+            left = append(left, t)
+        }
+    }
+    clear(q.tasks[len(left):])
+    q.tasks = left
+
+    signal(q.space)
+    signal(mine.ready)
+    for _, q := range r.queues {
+        if len(q.tasks) > 1 {
+            signal(r.backlog)
+            break
+        }
+    }
+    return true
+
+}
+
+// done records that a task with the key has finished on the worker, or was
+// dropped if the worker is -1, so once all of the key's jobs have finished
+// it can go to any worker again
+func (r *router[J]) done(worker int, key string) {
+
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    if worker >= 0 {
+        r.queues[worker].running = false
+    }
+    k := r.keys[key]
+    if k == nil {
+        return
+    }
+    k.running = false
+    if k.jobs--; k.jobs <= 0 {
+        delete(r.keys, key)
+    }
+
+}
+
+// flush removes and returns every task on the workers' queues
+func (r *router[J]) flush() []*task[J] {
+
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    var tasks []*task[J]
+    for _, q := range r.queues {
+        tasks = append(tasks, q.tasks...)
+        q.tasks = nil
+    }
+    return tasks
+
+}
+
+// len returns the number of tasks on the workers' queues
+func (r *router[J]) len() int {
+
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    n := 0
+    for _, q := range r.queues {
+        n += len(q.tasks)
+    }
+    return n
+
+}
+
+// routingKey returns the key the task is routed by, or "" if it goes on
+// the shared queue because it has no key or the pool has no key affinity
+func (p *Pool[J, R]) routingKey(t *task[J]) string {
+    if p.router == nil || t.fn != nil {
+        return ""
+    }
+    return RoutingKey(t.job)
+}
+
+// jump is Lamping and Veach's jump consistent hash, which maps the key to
+// one of n buckets such that growing n only moves the keys which go to the
+// new bucket
+func jump(key uint64, n int) int {
+
+    b, j := int64(-1), int64(0)
+    for j < int64(n) {
+        b = j
+        key = key*2862933555777941757 + 1
+        j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+    }
+    return int(b)
+
+}
@@ -0,0 +1,64 @@
+package pool
+
+import (
+    "math/rand"
+    "time"
+)
+
+// Backoff describes an exponentially increasing delay with random jitter,
+// used between attempts to reconnect to the database, and by BackoffRetry
+// between attempts at a job, so that workers don't hammer a server which
+// is struggling, or all retry in lock step
+type Backoff struct {
+    // Initial is the delay after the first failed attempt
+    Initial time.Duration
+
+    // Max caps the delay, however many attempts have failed
+    Max time.Duration
+
+    // Multiplier is applied to the delay after every failed attempt
+    Multiplier float64
+
+    // Jitter randomises each delay by up to this fraction of it,
+    // e.g. 0.2 gives delays between 80% and 120% of the nominal value
+    Jitter float64
+}
+
+// DefaultBackoff is used for reconnects unless WithReconnectBackoff is given
+var DefaultBackoff = Backoff{
+    Initial:    100 * time.Millisecond,
+    Max:        30 * time.Second,
+    Multiplier: 2,
+    Jitter:     0.2,
+}
+
+// DefaultRetryBackoff is the delay DefaultRetry waits before retrying a
+// failed job
+var DefaultRetryBackoff = Backoff{
+    Initial:    50 * time.Millisecond,
+    Max:        10 * time.Second,
+    Multiplier: 2,
+    Jitter:     0.2,
+}
+
+// Delay returns how long to wait after the given number of failed attempts
+func (b Backoff) Delay(attempt int) time.Duration {
+
+    delay := float64(b.Initial)
+    for i := 1; i < attempt; i++ {
+        delay *= b.Multiplier
+        if b.Max > 0 && delay >= float64(b.Max) {
+            break
+        }
+    }
+    if b.Max > 0 && delay > float64(b.Max) {
+        delay = float64(b.Max)
+    }
+
+    if b.Jitter > 0 {
+        delay += delay * b.Jitter * (rand.Float64()*2 - 1)
+    }
+
+    return time.Duration(delay)
+
+}
@@ -0,0 +1,104 @@
+package pool
+
+import (
+    "context"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// Batch is a group of jobs submitted to a pool which can be waited on and
+// reported on independently, so the same workers (and their connections)
+// can be reused for several batches of jobs one after another
+type Batch[J any, R any] struct {
+    pool    *Pool[J, R]
+    start   time.Time
+    pending sync.WaitGroup
+
+    submitted atomic.Int64
+    completed atomic.Int64
+    failed    atomic.Int64
+    finished  atomic.Int64 // UnixNano of the last completed job
+}
+
+// BatchStats summarises the jobs in a batch
+type BatchStats struct {
+    Submitted int
+    Completed int
+    Failed    int
+
+    // Duration is the time from the batch being created until its most
+    // recent job completed
+    Duration time.Duration
+}
+
+// Batch starts a new batch of jobs on the pool
+func (p *Pool[J, R]) Batch() *Batch[J, R] {
+    return &Batch[J, R]{pool: p, start: p.clock.Now()}
+}
+
+// Submit places a job belonging to this batch onto the pool's work queue
+func (b *Batch[J, R]) Submit(job J) (int, error) {
+    return b.enqueue(&task[J]{job: job})
+}
+
+// Go dispatches a one-off function belonging to this batch to the pool
+func (b *Batch[J, R]) Go(fn func(ctx context.Context) error) (int, error) {
+    return b.enqueue(&task[J]{fn: fn})
+}
+
+// enqueue counts the task as part of the batch before submitting it
+func (b *Batch[J, R]) enqueue(t *task[J]) (int, error) {
+    t.batch = b
+    b.pending.Add(1)
+    id, err := b.pool.enqueue(t)
+    if err != nil {
+        b.pending.Done()
+        return id, err
+    }
+    b.submitted.Add(1)
+    return id, nil
+}
+
+// done records the outcome of one of the batch's jobs
+func (b *Batch[J, R]) done(err error) {
+    b.completed.Add(1)
+    if err != nil {
+        b.failed.Add(1)
+    }
+    b.finished.Store(b.pool.clock.Now().UnixNano())
+    b.pending.Done()
+}
+
+// Wait blocks until every job submitted to the batch so far has finished,
+// then returns the batch's statistics. If the pool's context is cancelled
+// first, the statistics so far are returned along with the context's error.
+func (b *Batch[J, R]) Wait() (BatchStats, error) {
+
+    finished := make(chan struct{})
+    go func() {
+        b.pending.Wait()
+        close(finished)
+    }()
+
+    select {
+    case <-finished:
+        return b.Stats(), nil
+    case <-b.pool.ctx.Done():
+        return b.Stats(), b.pool.ctx.Err()
+    }
+
+}
+
+// Stats returns a snapshot of the batch's statistics
+func (b *Batch[J, R]) Stats() BatchStats {
+    stats := BatchStats{
+        Submitted: int(b.submitted.Load()),
+        Completed: int(b.completed.Load()),
+        Failed:    int(b.failed.Load()),
+    }
+    if finished := b.finished.Load(); finished > 0 {
+        stats.Duration = time.Unix(0, finished).Sub(b.start)
+    }
+    return stats
+}
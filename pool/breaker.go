@@ -0,0 +1,106 @@
+package pool
+
+import (
+    "sync"
+    "time"
+)
+
+// CircuitBreaker stops every worker for a cool-down period once too many of
+// the most recent attempts at jobs have failed, rather than having each of
+// them keep retrying against a struggling database. Only errors classified
+// as Retryable or Disconnected count as failures; Fatal errors are a
+// problem with the job rather than the database.
+type CircuitBreaker struct {
+    // Window is the number of most recent attempts considered
+    Window int
+
+    // Threshold is the fraction of the attempts in the window, between 0
+    // and 1, which must have failed to trip the breaker
+    Threshold float64
+
+    // Cooldown is how long the workers are stopped for once it trips
+    Cooldown time.Duration
+}
+
+// breaker tracks the outcome of recent attempts in a ring buffer
+type breaker struct {
+    CircuitBreaker
+    mu       sync.Mutex
+    outcomes []bool
+    next     int
+    count    int
+    failures int
+}
+
+// attempted records the outcome of an attempt at a job, tripping the
+// circuit breaker if the failure rate has crossed its threshold
+func (p *Pool[J, R]) attempted(failed bool) {
+
+    b := p.breaker
+    if b == nil {
+        return
+    }
+
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    // Attempts which were already in flight when the breaker tripped
+    // don't count towards tripping it again
+    if p.circuitOpen() {
+        return
+    }
+
+    if b.count == len(b.outcomes) {
+        if b.outcomes[b.next] {
+            b.failures--
+        }
+    } else {
+        b.count++
+    }
+    b.outcomes[b.next] = failed
+    b.next = (b.next + 1) % len(b.outcomes)
+    if failed {
+        b.failures++
+    }
+
+    if b.count < len(b.outcomes) || float64(b.failures) < b.Threshold*float64(b.count) {
+        return
+    }
+
+    p.logger.Printf("%d of the last %d attempts failed, stopping the workers for %s", b.failures, b.count, b.Cooldown)
+    b.next, b.count, b.failures = 0, 0, 0
+    p.mu.Lock()
+    p.tripped = true
+    p.setGate()
+    p.mu.Unlock()
+    go p.cooldown()
+
+}
+
+// cooldown closes the circuit breaker again once its cool-down period is up
+func (p *Pool[J, R]) cooldown() {
+
+    timer := p.clock.NewTimer(p.breaker.Cooldown)
+    defer timer.Stop()
+    select {
+    case <-timer.C():
+    case <-p.quit:
+        return
+    case <-p.ctx.Done():
+        return
+    }
+
+    p.logger.Printf("Circuit breaker cool-down over, resuming the workers")
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    p.tripped = false
+    p.setGate()
+
+}
+
+// circuitOpen reports whether the circuit breaker has stopped the workers
+func (p *Pool[J, R]) circuitOpen() bool {
+    p.mu.RLock()
+    defer p.mu.RUnlock()
+    return p.tripped
+}
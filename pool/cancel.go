@@ -0,0 +1,199 @@
+package pool
+
+import (
+    "container/heap"
+    "errors"
+    "fmt"
+    "sync"
+)
+
+// ErrCancelled is the error reported for a job which was cancelled with
+// Cancel before it started, and so was never processed
+var ErrCancelled = errors.New("pool: job cancelled")
+
+// ErrNotQueued is returned by Cancel when the job has already started, or
+// has finished without being run
+var ErrNotQueued = errors.New("pool: job is no longer queued")
+
+// ErrUnknownJob is returned by Cancel for an id which hasn't been assigned
+// to a job yet, or whose job couldn't be submitted
+var ErrUnknownJob = errors.New("pool: unknown job")
+
+// cancels records which jobs have started, and which were never submitted
+// because they couldn't be queued, in bitsets the same as the graph's, and
+// which have been cancelled before they could start
+type cancels struct {
+    mu        sync.Mutex
+    started   []uint64
+    abandoned []uint64
+    cancelled map[int]bool
+}
+
+// cancel marks the job as cancelled, unless it has already started or was
+// never submitted
+func (c *cancels) cancel(id int) error {
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if isSet(c.abandoned, id) {
+        return ErrUnknownJob
+    }
+    if isSet(c.started, id) {
+        return ErrNotQueued
+    }
+    if c.cancelled == nil {
+        c.cancelled = map[int]bool{}
+    }
+    c.cancelled[id] = true
+    return nil
+
+}
+
+// start marks the job as started, returning false instead if it has been
+// cancelled, in which case it must not be run
+func (c *cancels) start(id int) bool {
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if c.cancelled[id] {
+        delete(c.cancelled, id)
+        return false
+    }
+    c.started = set(c.started, id)
+    return true
+
+}
+
+// abandon marks the job as never having been submitted, as it couldn't be
+// queued
+func (c *cancels) abandon(id int) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    delete(c.cancelled, id)
+    c.abandoned = set(c.abandoned, id)
+}
+
+// isSet reports whether the bit for id is set in a bitset
+func isSet(bits []uint64, id int) bool {
+    i := id / 64
+    return i < len(bits) && bits[i]&(1<<(id%64)) != 0
+}
+
+// set sets the bit for id in a bitset, growing it if need be
+func set(bits []uint64, id int) []uint64 {
+    for id/64 >= len(bits) {
+        bits = append(bits, 0)
+    }
+    bits[id/64] |= 1 << (id % 64)
+    return bits
+}
+
+// withdraw reports whether the job has been cancelled, clearing the mark
+// as its result is about to be sent without it being started
+func (c *cancels) withdraw(id int) bool {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if !c.cancelled[id] {
+        return false
+    }
+    delete(c.cancelled, id)
+    return true
+}
+
+// Cancel stops a job which hasn't started yet from being run, for
+// interactive control over what the pool is doing. The job's result is
+// reported with ErrCancelled, straight away if it's being held by SubmitAt,
+// or otherwise when a worker comes to take it from the queue, or when the
+// jobs it depends on have finished if it was submitted with SubmitAfter.
+// Any jobs depending on it fail with ErrDependencyFailed. Cancel returns
+// ErrNotQueued if the job has already started, including a job waiting to
+// be retried, or has finished, and ErrUnknownJob if there's no such job,
+// including one which couldn't be submitted.
+func (p *Pool[J, R]) Cancel(id int) error {
+
+    if id < 0 || id >= int(p.nextId.Load()) {
+        return fmt.Errorf("%w: %d", ErrUnknownJob, id)
+    }
+    if p.finished(id) {
+        return fmt.Errorf("%w: %d", ErrNotQueued, id)
+    }
+    if err := p.cancels.cancel(id); err != nil {
+        return fmt.Errorf("%w: %d", err, id)
+    }
+
+    // The job may have finished since it was checked, after finish had
+    // cleared its cancellation, in which case there's nothing to cancel
+    if p.finished(id) {
+        p.cancels.withdraw(id)
+        return fmt.Errorf("%w: %d", ErrNotQueued, id)
+    }
+
+    // A job held on the retry queue is taken off it and reported at once,
+    // in the background as the caller may be the one reading the results
+    if d, ok := p.retries.remove(id); ok {
+        if d.scheduled {
+            p.counters.scheduled.Add(-1)
+        }
+        p.requeues.Add(1)
+        go func() {
+            defer p.requeues.Done()
+            p.rejectCancelled(d.t)
+        }()
+    }
+    return nil
+
+}
+
+// finished reports whether the job with the given id has finished
+func (p *Pool[J, R]) finished(id int) bool {
+    p.graph.mu.Lock()
+    defer p.graph.mu.Unlock()
+    return p.graph.finished(id)
+}
+
+// remove takes the job with the given id off the retry queue, if it's held
+// there
+func (q *retryQueue[J]) remove(id int) (delayed[J], bool) {
+
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    for i, d := range q.delayed {
+        if d.t.id == id {
+            heap.Remove(&q.delayed, i)
+            if d.retry {
+                q.retries--
+            }
+            return d, true
+        }
+    }
+    return delayed[J]{}, false
+
+}
+
+// reject fails a job without running it, because it was cancelled or has
+// expired, reporting the worker which took it off its queue, or -1 if it
+// never reached one
+func (p *Pool[J, R]) reject(t *task[J], worker int, err error) bool {
+    result := &JobResult[J, R]{
+        JobId:    t.id,
+        WorkerId: worker,
+        Job:      t.job,
+        Error:    err,
+        Attempts: t.attempts,
+    }
+    return p.finish(t, result, JobInfo{JobId: t.id, WorkerId: worker, Attempt: t.attempts, Error: err})
+}
+
+// rejectCancelled fails a task with ErrCancelled if it has been cancelled,
+// for the paths by which a job finishes without a worker taking it, and
+// reports whether it was
+func (p *Pool[J, R]) rejectCancelled(t *task[J]) bool {
+
+    if !p.cancels.withdraw(t.id) {
+        return false
+    }
+    p.counters.cancelled.Add(1)
+    p.reject(t, -1, ErrCancelled)
+    return true
+
+}
@@ -0,0 +1,44 @@
+package pool
+
+import (
+    "time"
+)
+
+// Clock is the source of time used by the pool to time jobs and to wait
+// between retries and reconnects, so that it can be replaced in tests
+type Clock interface {
+    Now() time.Time
+    NewTimer(d time.Duration) Timer
+}
+
+// Timer is a single event created by a Clock, mirroring time.Timer
+type Timer interface {
+    C() <-chan time.Time
+    Stop() bool
+}
+
+// SystemClock is the default Clock, backed by the time package
+var SystemClock Clock = systemClock{}
+
+// systemClock implements Clock using the real time
+type systemClock struct{}
+
+// Now returns time.Now()
+func (systemClock) Now() time.Time {
+    return time.Now()
+}
+
+// NewTimer returns a wrapped time.Timer
+func (systemClock) NewTimer(d time.Duration) Timer {
+    return systemTimer{time.NewTimer(d)}
+}
+
+// systemTimer adapts *time.Timer to the Timer interface
+type systemTimer struct {
+    *time.Timer
+}
+
+// C returns the channel on which the time is delivered
+func (t systemTimer) C() <-chan time.Time {
+    return t.Timer.C
+}
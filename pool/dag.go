@@ -0,0 +1,186 @@
+package pool
+
+import (
+    "errors"
+    "fmt"
+    "sync"
+)
+
+// ErrDependencyFailed is the error reported for a job submitted with
+// SubmitAfter when one of the jobs it depends on fails, in which case it's
+// never processed. The dependency's own error is wrapped along with it.
+var ErrDependencyFailed = errors.New("pool: dependency failed")
+
+// ErrUnknownDependency is returned by SubmitAfter when a job depends on an
+// id which hasn't been assigned to a job yet
+var ErrUnknownDependency = errors.New("pool: unknown dependency")
+
+// graph records the outcome of every job, so that jobs submitted with
+// SubmitAfter can be held until the jobs they depend on have succeeded.
+// Whether each job has finished is kept in a bitset, and the error only for
+// those which failed, so tracking a large run takes little memory.
+type graph[J any] struct {
+    mu      sync.Mutex
+    done    []uint64
+    failed  map[int]error
+    waiting map[int][]*held[J]
+}
+
+// held is a task waiting for the jobs it depends on
+type held[J any] struct {
+    t         *task[J]
+    remaining int
+    failed    bool
+}
+
+// SubmitAfter submits a job which is only placed onto the work queue once
+// every job whose id is in deps has succeeded, so that multi-step workflows
+// can run over the same pool, and returns the id assigned to it. If one of
+// them fails the job is never processed, and its result has an error
+// wrapping ErrDependencyFailed and the dependency's error. Jobs can only
+// depend on jobs already submitted, so there can be no cycles.
+func (p *Pool[J, R]) SubmitAfter(job J, deps ...int) (int, error) {
+
+    next := int(p.nextId.Load())
+    for _, dep := range deps {
+        if dep < 0 || dep >= next {
+            return -1, fmt.Errorf("%w: %d", ErrUnknownDependency, dep)
+        }
+    }
+
+    p.mu.RLock()
+    if p.closed {
+        p.mu.RUnlock()
+        return -1, ErrClosed
+    }
+    p.pending.Add(1)
+    p.counters.pending.Add(1)
+    p.mu.RUnlock()
+
+    t := &task[J]{job: job}
+    t.id = int(p.nextId.Add(1) - 1)
+    h, dep, err := p.graph.hold(t, deps)
+    switch {
+    case err != nil:
+        // Fail the job in the background, as the caller may be the one
+        // reading the results
+        p.requeues.Add(1)
+        go func() {
+            defer p.requeues.Done()
+            p.failDependent(t, dep, err)
+        }()
+    case h == nil:
+        if err := p.push(t); err != nil {
+            p.abandon(t, err)
+            return -1, err
+        }
+    }
+    return t.id, nil
+
+}
+
+// hold records that the task is waiting for its dependencies, returning nil
+// if they have all already succeeded, or the id and error of one which has
+// failed
+func (g *graph[J]) hold(t *task[J], deps []int) (*held[J], int, error) {
+
+    g.mu.Lock()
+    defer g.mu.Unlock()
+    if g.waiting == nil {
+        g.waiting = map[int][]*held[J]{}
+        g.failed = map[int]error{}
+    }
+
+    h := &held[J]{t: t}
+    for _, dep := range deps {
+        if err, ok := g.failed[dep]; ok {
+            h.failed = true
+            return nil, dep, err
+        }
+        if !g.finished(dep) {
+            h.remaining++
+            g.waiting[dep] = append(g.waiting[dep], h)
+        }
+    }
+    if h.remaining == 0 {
+        return nil, 0, nil
+    }
+    return h, 0, nil
+
+}
+
+// finished reports whether the job with the given id has finished
+func (g *graph[J]) finished(id int) bool {
+    i := id / 64
+    return i < len(g.done) && g.done[i]&(1<<(id%64)) != 0
+}
+
+// finish records the outcome of a job, and returns the tasks waiting for it
+// which are now ready to run, and those which can't because it failed
+func (g *graph[J]) finish(id int, err error) (ready []*task[J], failed []*task[J]) {
+
+    g.mu.Lock()
+    defer g.mu.Unlock()
+    for id/64 >= len(g.done) {
+        g.done = append(g.done, 0)
+    }
+    g.done[id/64] |= 1 << (id % 64)
+    if err != nil {
+        if g.failed == nil {
+            g.failed = map[int]error{}
+        }
+        g.failed[id] = err
+    }
+
+    for _, h := range g.waiting[id] {
+        switch {
+        case h.failed:
+        case err != nil:
+            h.failed = true
+            failed = append(failed, h.t)
+        default:
+            h.remaining--
+            if h.remaining == 0 {
+                ready = append(ready, h.t)
+            }
+        }
+    }
+    delete(g.waiting, id)
+    return ready, failed
+
+}
+
+// resolve records the outcome of a finished job, queueing the jobs which
+// were waiting for it if it succeeded and failing them if not
+func (p *Pool[J, R]) resolve(id int, err error) {
+
+    ready, failed := p.graph.finish(id, err)
+    for _, t := range ready {
+        if !p.rejectCancelled(t) {
+            p.delay(t, p.clock.Now(), false)
+        }
+    }
+    for _, t := range failed {
+        p.failDependent(t, id, err)
+    }
+
+}
+
+// failDependent fails a job which can't run because the job it depends on
+// failed, which in turn fails any jobs depending on it. A job cancelled
+// while it was waiting is reported as cancelled instead.
+func (p *Pool[J, R]) failDependent(t *task[J], dep int, err error) {
+
+    if p.rejectCancelled(t) {
+        return
+    }
+    err = fmt.Errorf("%w: job %d: %w", ErrDependencyFailed, dep, err)
+    result := &JobResult[J, R]{
+        JobId:    t.id,
+        WorkerId: -1,
+        Job:      t.job,
+        Error:    err,
+    }
+    p.finish(t, result, JobInfo{JobId: t.id, WorkerId: -1, Error: err})
+
+}
@@ -0,0 +1,110 @@
+package pool
+
+import (
+    "context"
+    "errors"
+    "sync"
+)
+
+// errDuplicate is returned by an attempt at a job which was skipped because
+// one with the same idempotency key had already succeeded
+var errDuplicate = errors.New("pool: duplicate job")
+
+// Keyed is implemented by jobs with an idempotency key: jobs with the same
+// key have the same effect, so once one of them has succeeded the others
+// can be skipped. An empty key means the job has none.
+type Keyed interface {
+    IdempotencyKey() string
+}
+
+// IdempotencyKey returns the job's idempotency key, or "" if it isn't Keyed,
+// for jobs which wrap others to pass the key through
+func IdempotencyKey(job any) string {
+    if keyed, ok := job.(Keyed); ok {
+        return keyed.IdempotencyKey()
+    }
+    return ""
+}
+
+// Deduplicator remembers the idempotency keys of the jobs which have
+// succeeded, so that a job which is replayed, e.g. because it was submitted
+// again after a crash or delivered twice by a queue, isn't run again. A job
+// which succeeds but whose key can't be recorded is still reported as
+// having succeeded, and a job whose attempt fails after the database has
+// applied it, e.g. one which times out, isn't recorded, so duplicates are
+// suppressed, not ruled out.
+type Deduplicator interface {
+    // Seen reports whether a job with the key has already succeeded
+    Seen(ctx context.Context, deps Deps, key string) (bool, error)
+
+    // Record remembers that a job with the key has succeeded
+    Record(ctx context.Context, deps Deps, key string) error
+}
+
+// WithDeduplicator skips the Keyed jobs whose key the Deduplicator has
+// seen, reporting them as succeeded with Duplicate set on their results,
+// and records the keys of those which succeed. The default is to run every
+// job.
+func WithDeduplicator(d Deduplicator) Option {
+    return func(c *config) {
+        c.dedup = d
+    }
+}
+
+// MemoryDedup is a Deduplicator which keeps the keys in memory, so it only
+// suppresses duplicates within a single process, and holds every key it's
+// given for as long as it's in use
+type MemoryDedup struct {
+    mu   sync.Mutex
+    keys map[string]struct{}
+}
+
+// NewMemoryDedup creates an empty MemoryDedup
+func NewMemoryDedup() *MemoryDedup {
+    return &MemoryDedup{keys: map[string]struct{}{}}
+}
+
+// Seen reports whether the key has been recorded
+func (m *MemoryDedup) Seen(ctx context.Context, deps Deps, key string) (bool, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    _, ok := m.keys[key]
+    return ok, nil
+}
+
+// Record adds the key to those seen
+func (m *MemoryDedup) Record(ctx context.Context, deps Deps, key string) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.keys[key] = struct{}{}
+    return nil
+}
+
+// deduplicate runs a job through the pool's Deduplicator, if it has one and
+// the job has a key, skipping it with errDuplicate if its key has been seen
+func (p *Pool[J, R]) deduplicate(ctx context.Context, deps Deps, t *task[J], exec func() error) error {
+
+    key := ""
+    if p.dedup != nil && t.fn == nil {
+        key = IdempotencyKey(t.job)
+    }
+    if key == "" {
+        return exec()
+    }
+
+    seen, err := p.dedup.Seen(ctx, deps, key)
+    if err != nil {
+        return err
+    }
+    if seen {
+        return errDuplicate
+    }
+    if err := exec(); err != nil {
+        return err
+    }
+    if err := p.dedup.Record(ctx, deps, key); err != nil {
+        p.logger.Printf("Worker %d: Unable to record the idempotency key of job %d (%s)", deps.WorkerId, t.id, err)
+    }
+    return nil
+
+}
@@ -0,0 +1,92 @@
+package pool
+
+import (
+    "errors"
+)
+
+// ErrDrained is the error reported for jobs which were still queued when
+// the pool was drained, and so were never processed
+var ErrDrained = errors.New("pool: drained before job was processed")
+
+// Drain shuts the pool down gracefully but promptly: it stops accepting new
+// jobs, lets the jobs already in flight finish, fails any jobs still queued
+// with ErrDrained so that every job has a result, closes the workers'
+// connections and then closes the Results channel. Unlike Close it does not
+// wait for the queue to be processed. Results must be read while Drain is
+// running. Calling Drain more than once, or after Close, has no effect.
+func (p *Pool[J, R]) Drain() {
+
+    if _, ok := p.stopAccepting(); !ok {
+        return
+    }
+
+    // Stop the workers taking any more jobs, and wait for the
+    // jobs in flight and the retry queue to stop
+    close(p.draining)
+    p.workers.Wait()
+    p.requeues.Wait()
+    <-p.retries.done
+
+    // Flush the results for everything left on the retry queue and the
+    // work queue, including any jobs released by failing those which
+    // depended on them
+    for {
+        held := p.retries.flush()
+        if len(held) == 0 && p.queued() == 0 {
+            break
+        }
+        for _, d := range held {
+            if d.scheduled {
+                p.counters.scheduled.Add(-1)
+            }
+            p.drop(d.t)
+        }
+        for len(p.queue) > 0 {
+            p.drop(<-p.queue)
+        }
+        if p.router != nil {
+            for _, t := range p.router.flush() {
+                p.drop(t)
+            }
+        }
+        if p.fair != nil {
+            for _, t := range p.fair.flush() {
+                p.drop(t)
+            }
+        }
+    }
+
+    p.shutdown()
+
+}
+
+// queued returns the number of jobs on the work queue, the workers' own
+// queues and the groups' queues
+func (p *Pool[J, R]) queued() int {
+    n := len(p.queue)
+    if p.router != nil {
+        n += p.router.len()
+    }
+    if p.fair != nil {
+        n += p.fair.len()
+    }
+    return n
+}
+
+// drop fails a job which was never processed because the pool was drained,
+// or reports it as cancelled if it had been
+func (p *Pool[J, R]) drop(t *task[J]) {
+
+    if p.rejectCancelled(t) {
+        return
+    }
+    result := &JobResult[J, R]{
+        JobId:    t.id,
+        WorkerId: -1,
+        Job:      t.job,
+        Error:    ErrDrained,
+        Attempts: t.attempts,
+    }
+    p.finish(t, result, JobInfo{JobId: t.id, WorkerId: -1, Attempt: t.attempts, Error: ErrDrained})
+
+}
@@ -0,0 +1,81 @@
+package pool
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+)
+
+// ErrorClass categorises the error a job failed with, so the pool knows
+// whether it is worth trying the job again
+type ErrorClass int
+
+const (
+    // Fatal errors, such as invalid data, will fail the same way every
+    // time so the job is failed immediately without consulting the
+    // retry policy
+    Fatal ErrorClass = iota
+
+    // Retryable errors are transient, such as a timeout or an overloaded
+    // server, and the job is retried if the retry policy allows
+    Retryable
+
+    // Disconnected errors mean the worker's connection to the database
+    // is broken, so it reconnects before the job is retried
+    Disconnected
+)
+
+// String returns the name of the error class
+func (c ErrorClass) String() string {
+    switch c {
+    case Retryable:
+        return "retryable"
+    case Disconnected:
+        return "disconnected"
+    default:
+        return "fatal"
+    }
+}
+
+// ErrorClassifier decides which ErrorClass a job's error belongs to
+type ErrorClassifier func(err error) ErrorClass
+
+// DefaultClassifier treats a lost connection (EOF, or a network error
+// other than a timeout) as Disconnected, timeouts as Retryable, and
+// everything else as Fatal. Database specific classifiers can fall back
+// to it for errors they don't recognise.
+func DefaultClassifier(err error) ErrorClass {
+
+    if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+        return Disconnected
+    }
+
+    if errors.Is(err, context.DeadlineExceeded) {
+        return Retryable
+    }
+
+    var netErr net.Error
+    if errors.As(err, &netErr) {
+        if netErr.Timeout() {
+            return Retryable
+        }
+        return Disconnected
+    }
+
+    return Fatal
+
+}
+
+// PanicError is the error a job fails with if it panics. Jobs which panic
+// are never retried.
+type PanicError struct {
+    Value any
+    Stack []byte
+}
+
+// Error describes the value the job panicked with
+func (e *PanicError) Error() string {
+    return fmt.Sprintf("pool: job panicked: %v", e.Value)
+}
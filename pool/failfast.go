@@ -0,0 +1,56 @@
+package pool
+
+import (
+    "context"
+    "errors"
+    "fmt"
+)
+
+// ErrFailFast is the cause given to the pool's context when it is cancelled
+// because too many jobs have failed in fail-fast mode
+var ErrFailFast = errors.New("pool: too many jobs failed")
+
+// failFast records the failures in fail-fast mode, cancelling the pool once
+// the limit is reached
+type failFast struct {
+    limit  int
+    errors []error
+}
+
+// jobFailed records a job's failure if the pool is in fail-fast mode, and
+// cancels the remaining jobs once the limit has been reached
+func (p *Pool[J, R]) jobFailed(id int, err error) {
+
+    if p.failFast.limit <= 0 {
+        return
+    }
+
+    p.failMu.Lock()
+    defer p.failMu.Unlock()
+    if len(p.failFast.errors) >= p.failFast.limit {
+        return
+    }
+
+    p.failFast.errors = append(p.failFast.errors, fmt.Errorf("job %d: %w", id, err))
+    if len(p.failFast.errors) == p.failFast.limit {
+        p.logger.Printf("%d jobs have failed, cancelling the remaining jobs", p.failFast.limit)
+        p.cancel(ErrFailFast)
+    }
+
+}
+
+// Err returns the error which made the pool cancel its remaining jobs: the
+// combined error of the failures in fail-fast mode, or an ErrUnreachable
+// once a worker has used up its reconnect budget. It returns nil if neither
+// has happened.
+func (p *Pool[J, R]) Err() error {
+    if cause := context.Cause(p.ctx); errors.Is(cause, ErrUnreachable) {
+        return cause
+    }
+    p.failMu.Lock()
+    defer p.failMu.Unlock()
+    if p.failFast.limit <= 0 || len(p.failFast.errors) < p.failFast.limit {
+        return nil
+    }
+    return errors.Join(p.failFast.errors...)
+}
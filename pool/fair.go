@@ -0,0 +1,167 @@
+package pool
+
+import (
+    "slices"
+    "sync"
+)
+
+// Grouped is implemented by jobs which belong to a group, such as the
+// tenant they're for. With WithFairScheduling the workers take turns
+// between the groups, so one group with a huge backlog can't starve the
+// others. An empty group is a group of its own, shared by every job
+// without one.
+type Grouped interface {
+    Group() string
+}
+
+// Group returns the job's group, or "" if it isn't Grouped, for jobs which
+// wrap others to pass the group through
+func Group(job any) string {
+    if grouped, ok := job.(Grouped); ok {
+        return grouped.Group()
+    }
+    return ""
+}
+
+// WithFairScheduling queues the jobs of each group separately and has the
+// workers take from the groups with jobs queued in turn, weighted round
+// robin, so each gets its share of the workers however many jobs the
+// others have submitted. A group takes as many jobs in a row as its weight,
+// which defaults to 1. Each group has a queue of its own of the pool's
+// queue size, so a producer blocked by a full queue only holds up its own
+// group. Jobs routed WithKeyAffinity go to their worker's own queue
+// instead.
+func WithFairScheduling(weights map[string]int) Option {
+    return func(c *config) {
+        c.fair = true
+        c.weights = weights
+    }
+}
+
+// fairQueue holds the jobs waiting for a worker in a queue per group, along
+// with the groups which have jobs queued in the order they take turns
+type fairQueue[J any] struct {
+    mu      sync.Mutex
+    groups  map[string]*groupQueue[J]
+    turns   []*groupQueue[J]
+    turn    int
+    taken   int
+    weights map[string]int
+    size    int
+    queued  int
+
+    // ready is signalled when jobs are added, and again when one is taken
+    // while there are others left, for the next idle worker
+    ready chan struct{}
+}
+
+// groupQueue is the queue of a single group. Space is signalled when jobs
+// are taken off it.
+type groupQueue[J any] struct {
+    name   string
+    weight int
+    tasks  []*task[J]
+    space  chan struct{}
+}
+
+// newFairQueue creates a fair queue with room for size jobs in each group
+func newFairQueue[J any](size int, weights map[string]int) *fairQueue[J] {
+    return &fairQueue[J]{groups: map[string]*groupQueue[J]{}, weights: weights, size: size, ready: make(chan struct{}, 1)}
+}
+
+// add places a task on its group's queue, which joins the end of the turns
+// if it had nothing queued, or returns the channel to wait on for room if
+// the group's queue is full
+func (f *fairQueue[J]) add(t *task[J], group string) (<-chan struct{}, bool) {
+
+    f.mu.Lock()
+    defer f.mu.Unlock()
+
+    g := f.groups[group]
+    if g == nil {
+        g = &groupQueue[J]{name: group, weight: max(f.weights[group], 1), space: make(chan struct{}, 1)}
+        f.groups[group] = g
+        f.turns = append(f.turns, g)
+    }
+    if len(g.tasks) >= f.size {
+        return g.space, false
+    }
+    g.tasks = append(g.tasks, t)
+    f.queued++
+    signal(f.ready)
+    return nil, true
+
+}
+
+// take removes the task at the head of the queue of the group whose turn
+// it is, if there is one, moving on to the next group once this one has
+// taken its weight in jobs or has none left
+func (f *fairQueue[J]) take() *task[J] {
+
+    f.mu.Lock()
+    defer f.mu.Unlock()
+
+    if f.queued == 0 {
+        return nil
+    }
+    g := f.turns[f.turn]
+    t := g.tasks[0]
+    g.tasks[0] = nil
+    g.tasks = g.tasks[1:]
+    f.queued--
+    f.taken++
+    signal(g.space)
+
+    // A group with nothing queued drops out of the turns until it has
+    switch {
+    case len(g.tasks) == 0:
+        delete(f.groups, g.name)
+        f.turns = slices.Delete(f.turns, f.turn, f.turn+1)
+        f.taken = 0
+        if f.turn >= len(f.turns) {
+            f.turn = 0
+        }
+    case f.taken >= g.weight:
+        f.taken = 0
+        f.turn = (f.turn + 1) % len(f.turns)
+    }
+
+    if f.queued > 0 {
+        signal(f.ready)
+    }
+    return t
+
+}
+
+// flush removes and returns every task on the groups' queues
+func (f *fairQueue[J]) flush() []*task[J] {
+
+    f.mu.Lock()
+    defer f.mu.Unlock()
+
+    var tasks []*task[J]
+    for _, g := range f.turns {
+        tasks = append(tasks, g.tasks...)
+        signal(g.space)
+    }
+    clear(f.groups)
+    f.turns, f.turn, f.taken, f.queued = nil, 0, 0, 0
+    return tasks
+
+}
+
+// len returns the number of tasks on the groups' queues
+func (f *fairQueue[J]) len() int {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    return f.queued
+}
+
+// group returns the group a task is queued in, "" for those dispatched
+// with Go
+func (p *Pool[J, R]) group(t *task[J]) string {
+    if t.fn != nil {
+        return ""
+    }
+    return Group(t.job)
+}
@@ -0,0 +1,80 @@
+package pool
+
+import (
+    "time"
+)
+
+// JobInfo describes an attempt at a job, as passed to the pool's Hooks
+type JobInfo struct {
+    JobId    int
+    WorkerId int
+
+    // Attempt is the number of this attempt at the job, starting at 1
+    Attempt int
+
+    // StartedAt, Duration and Error are only set once the attempt is over
+    StartedAt time.Time
+    Duration  time.Duration
+    Error     error
+}
+
+// Hooks are callbacks made at key points in the life of a job or worker,
+// so that embedders can emit their own metrics or audit events without
+// changing the worker loop. Any of them may be nil. They are called from
+// the worker goroutines, so must be safe for concurrent use and should
+// return quickly.
+type Hooks struct {
+    // OnJobStart is called before each attempt at a job
+    OnJobStart func(info JobInfo)
+
+    // OnJobDone is called when a job has finished, successfully or not,
+    // and is not going to be retried
+    OnJobDone func(info JobInfo)
+
+    // OnRetry is called when a failed job is put back onto the queue, to
+    // be tried again after delay
+    OnRetry func(info JobInfo, delay time.Duration)
+
+    // OnWorkerDown is called when a worker loses its connection to the
+    // database, or is restarted after a job panics, before it reconnects
+    OnWorkerDown func(workerId int, err error)
+
+    // OnReconnect is called once a worker which went down has reconnected,
+    // with the number of attempts it took and how long it was down for
+    OnReconnect func(workerId int, attempts int, downtime time.Duration)
+}
+
+// jobStart calls the OnJobStart hook, if set
+func (h *Hooks) jobStart(info JobInfo) {
+    if h.OnJobStart != nil {
+        h.OnJobStart(info)
+    }
+}
+
+// jobDone calls the OnJobDone hook, if set
+func (h *Hooks) jobDone(info JobInfo) {
+    if h.OnJobDone != nil {
+        h.OnJobDone(info)
+    }
+}
+
+// retry calls the OnRetry hook, if set
+func (h *Hooks) retry(info JobInfo, delay time.Duration) {
+    if h.OnRetry != nil {
+        h.OnRetry(info, delay)
+    }
+}
+
+// workerDown calls the OnWorkerDown hook, if set
+func (h *Hooks) workerDown(workerId int, err error) {
+    if h.OnWorkerDown != nil {
+        h.OnWorkerDown(workerId, err)
+    }
+}
+
+// reconnect calls the OnReconnect hook, if set
+func (h *Hooks) reconnect(workerId int, attempts int, downtime time.Duration) {
+    if h.OnReconnect != nil {
+        h.OnReconnect(workerId, attempts, downtime)
+    }
+}
@@ -0,0 +1,31 @@
+package pool
+
+import (
+    "context"
+)
+
+// Job is a unit of work which carries its own implementation, so that a
+// single pool can process any mix of jobs without the workers needing to
+// know anything about what they do or which database they talk to
+type Job interface {
+    Execute(ctx context.Context, deps Deps) error
+}
+
+// Deps holds the resources a worker makes available to the jobs it runs
+type Deps struct {
+    WorkerId int
+
+    // Conn is the Store returned by the pool's Connector for this worker
+    Conn Store
+}
+
+// NewJobPool spins up a pool of workers configured by the options provided
+// which processes jobs implementing the Job interface
+func NewJobPool(ctx context.Context, connect Connector, opts ...Option) *Pool[Job, struct{}] {
+    return NewPool(ctx, connect, execute, opts...)
+}
+
+// execute is the Handler used by a job pool, it simply runs each job
+func execute(ctx context.Context, deps Deps, job Job) (struct{}, error) {
+    return struct{}{}, job.Execute(ctx, deps)
+}
@@ -0,0 +1,72 @@
+package pool
+
+import (
+    "context"
+    "sync"
+)
+
+// ExecFunc executes a single job on a worker
+type ExecFunc func(ctx context.Context, deps Deps) error
+
+// Middleware wraps the execution of every job, in the same way as HTTP
+// middleware wraps a handler, so that cross-cutting concerns like logging,
+// retries, metrics and timeouts can be added without changing the workers.
+// A middleware should call next to run the job and return its error.
+type Middleware func(next ExecFunc) ExecFunc
+
+// jobIdKey is the context key under which the id of the running job is stored
+type jobIdKey struct{}
+
+// JobIdFromContext returns the id of the job being executed, for use by
+// middleware and jobs
+func JobIdFromContext(ctx context.Context) (int, bool) {
+    id, ok := ctx.Value(jobIdKey{}).(int)
+    return id, ok
+}
+
+// outcomeKey is the context key under which the outcome of the running
+// attempt at a job is recorded
+type outcomeKey struct{}
+
+// outcome holds what was recorded about an attempt with SetOutcome, which
+// a job may do from goroutines of its own
+type outcome struct {
+    mu    sync.Mutex
+    value any
+}
+
+// get returns the outcome recorded for the attempt, if any
+func (o *outcome) get() any {
+    o.mu.Lock()
+    defer o.mu.Unlock()
+    return o.value
+}
+
+// SetOutcome records how the attempt at the job being executed went, for
+// Stores and jobs with more to report than an error. The outcome of the
+// job's final attempt is reported as its JobResult's Outcome. It does
+// nothing outside of a job.
+func SetOutcome(ctx context.Context, value any) {
+    if o, ok := ctx.Value(outcomeKey{}).(*outcome); ok {
+        o.mu.Lock()
+        o.value = value
+        o.mu.Unlock()
+    }
+}
+
+// Use adds middleware to the pool. The first middleware added is the
+// outermost, so it sees each job first and its error last. Use must be
+// called before the pool is started.
+func (p *Pool[J, R]) Use(mw ...Middleware) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    p.middleware = append(p.middleware, mw...)
+}
+
+// chain wraps exec in the pool's middleware
+func (p *Pool[J, R]) chain(exec ExecFunc) ExecFunc {
+    for i := len(p.middleware) - 1; i >= 0; i-- {
+        exec = p.middleware[i](exec)
+    }
+    return exec
+}
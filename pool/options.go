@@ -0,0 +1,279 @@
+package pool
+
+import (
+    "log"
+    "runtime"
+    "time"
+)
+
+// Logger is the interface the pool reports to, so that any logging library
+// can be plugged in. *log.Logger satisfies it.
+type Logger interface {
+    Printf(format string, v ...any)
+}
+
+// SubmitMode controls what Submit does when the queue is full, so that
+// producers can choose how to react when the workers fall behind
+type SubmitMode int
+
+const (
+    // SubmitBlock waits for space on the queue, however long it takes
+    SubmitBlock SubmitMode = iota
+
+    // SubmitTimeout waits for space on the queue for a limited time,
+    // then gives up with ErrQueueFull
+    SubmitTimeout
+
+    // SubmitReject gives up with ErrQueueFull straight away
+    SubmitReject
+)
+
+// Option configures a Pool when it is created with NewPool
+type Option func(*config)
+
+// config holds the settings used to construct a Pool
+type config struct {
+    workers       int
+    queueSize     int
+    chunkSize     int
+    retryQueue    int
+    resultsBuffer int
+    logger        Logger
+    retry         RetryPolicy
+    maxAttempts   int
+    jobTimeout    time.Duration
+    classify      ErrorClassifier
+    backoff       Backoff
+    clock         Clock
+    hooks         Hooks
+    submitMode    SubmitMode
+    submitTimeout time.Duration
+    failFast      int
+    ordered       bool
+    affinity      bool
+    fair          bool
+    weights       map[string]int
+    healthCheck   time.Duration
+    lazy          bool
+    warmUp        WarmUpFunc
+    breaker       CircuitBreaker
+    dedup         Deduplicator
+    ttl           time.Duration
+
+    reconnectAttempts int
+    reconnectTimeout  time.Duration
+}
+
+// defaultConfig returns the settings used for any option not supplied
+func defaultConfig() *config {
+    return &config{
+        workers:       runtime.NumCPU(),
+        queueSize:     512,
+        chunkSize:     1,
+        retryQueue:    512,
+        resultsBuffer: 512,
+        logger:        log.Default(),
+        retry:         DefaultRetry,
+        classify:      DefaultClassifier,
+        backoff:       DefaultBackoff,
+        clock:         SystemClock,
+    }
+}
+
+// WithWorkers sets the number of worker threads to spawn, with a minimum of
+// 1 (default is 1 per CPU core)
+func WithWorkers(n int) Option {
+    return func(c *config) {
+        c.workers = n
+    }
+}
+
+// WithQueueSize sets how many submitted jobs can be buffered waiting for
+// a free worker before Submit blocks (default 512)
+func WithQueueSize(n int) Option {
+    return func(c *config) {
+        c.queueSize = n
+    }
+}
+
+// WithChunkSize has each worker take up to n jobs from the queue at a
+// time: it waits for one, as usual, then takes as many more as are queued,
+// up to n in all, without waiting, and works through them before going
+// back to the queue. That saves waiting on the queue, and being woken, for
+// every job, which adds up at hundreds of thousands of tiny jobs a second,
+// but a worker may sit on queued jobs while others are idle, so it suits
+// many small jobs rather than a few slow ones. Jobs on a worker's own
+// queue, WithKeyAffinity, or a group's, WithFairScheduling, are still
+// taken one at a time. The default is 1.
+func WithChunkSize(n int) Option {
+    return func(c *config) {
+        c.chunkSize = n
+    }
+}
+
+// WithRetryQueueSize sets how many failed jobs can be held waiting for
+// their retry delay before being put back onto the queue (default 512).
+// Once it's full, a worker whose job fails retries it itself after the
+// delay, taking no new jobs meanwhile, so a burst of failures slows the
+// pool down rather than piling up. 0 means no limit.
+func WithRetryQueueSize(n int) Option {
+    return func(c *config) {
+        c.retryQueue = n
+    }
+}
+
+// WithResultsBuffer sets how many results can be buffered waiting to be
+// read before workers block (default 512)
+func WithResultsBuffer(n int) Option {
+    return func(c *config) {
+        c.resultsBuffer = n
+    }
+}
+
+// WithLogger sets the logger the pool reports connectivity problems and
+// retries to (default is the standard logger)
+func WithLogger(l Logger) Option {
+    return func(c *config) {
+        c.logger = l
+    }
+}
+
+// WithRetryPolicy sets the policy deciding which failed jobs are put back
+// onto the queue to be tried again, and after how long (default
+// DefaultRetry)
+func WithRetryPolicy(r RetryPolicy) Option {
+    return func(c *config) {
+        c.retry = r
+    }
+}
+
+// WithReconnectBackoff sets the delay between a worker's attempts to
+// (re)connect to the database (default DefaultBackoff)
+func WithReconnectBackoff(b Backoff) Option {
+    return func(c *config) {
+        c.backoff = b
+    }
+}
+
+// WithLazyConnect makes each worker wait until it receives its first job
+// before connecting to the database, rather than connecting as soon as
+// the pool starts, which avoids opening connections which are never used
+// when spawning many more workers than there are jobs.
+func WithLazyConnect() Option {
+    return func(c *config) {
+        c.lazy = true
+    }
+}
+
+// WithWarmUp runs fn on each worker once it has connected, before it
+// takes any jobs; see Ready. Workers with a warm-up connect as soon as the
+// pool starts even if WithLazyConnect is used.
+func WithWarmUp(fn WarmUpFunc) Option {
+    return func(c *config) {
+        c.warmUp = fn
+    }
+}
+
+// WithReconnectLimit gives up on the whole run, cancelling the pool with an
+// ErrUnreachable, once a worker has made the given number of attempts to
+// reconnect to the database or has been disconnected for the given time.
+// Either limit may be 0, and the default is to keep trying forever.
+func WithReconnectLimit(attempts int, downtime time.Duration) Option {
+    return func(c *config) {
+        c.reconnectAttempts = attempts
+        c.reconnectTimeout = downtime
+    }
+}
+
+// WithMaxAttempts sets the maximum number of times a job is tried before it
+// is failed, regardless of the retry policy (default 0, meaning no limit)
+func WithMaxAttempts(n int) Option {
+    return func(c *config) {
+        c.maxAttempts = n
+    }
+}
+
+// WithJobTimeout gives every attempt at a job a context with a deadline this
+// far in the future, so a job stuck on a hung connection fails (and is
+// retried per the retry policy) rather than stalling its worker
+// indefinitely. Jobs must respect the context for this to take effect.
+// The default is 0, meaning no timeout.
+func WithJobTimeout(d time.Duration) Option {
+    return func(c *config) {
+        c.jobTimeout = d
+    }
+}
+
+// WithErrorClassifier sets how job errors are classified as fatal, retryable
+// or a lost connection (default DefaultClassifier)
+func WithErrorClassifier(classify ErrorClassifier) Option {
+    return func(c *config) {
+        c.classify = classify
+    }
+}
+
+// WithClock sets the source of time used to time jobs and to wait between
+// retries and reconnects (default SystemClock)
+func WithClock(clock Clock) Option {
+    return func(c *config) {
+        c.clock = clock
+    }
+}
+
+// WithHooks sets callbacks to be made at key points in the life of each
+// job and worker
+func WithHooks(hooks Hooks) Option {
+    return func(c *config) {
+        c.hooks = hooks
+    }
+}
+
+// WithSubmitMode sets what Submit does when the queue is full (default
+// SubmitBlock). The timeout only applies to SubmitTimeout.
+func WithSubmitMode(mode SubmitMode, timeout time.Duration) Option {
+    return func(c *config) {
+        c.submitMode = mode
+        c.submitTimeout = timeout
+    }
+}
+
+// WithFailFast cancels the pool's remaining jobs, in the style of errgroup,
+// once n jobs have failed (after any retries), which is useful when the
+// jobs depend on each other. Wait and Err then return the combined error of
+// the failures. An n of less than 1 stops at the first failure, while the
+// default, without the option, is to keep going whatever fails.
+func WithFailFast(n int) Option {
+    return func(c *config) {
+        c.failFast = max(n, 1)
+    }
+}
+
+// WithOrderedResults delivers results in the order the jobs were submitted,
+// rather than the order they complete, for pipelines which need
+// deterministic downstream processing. Results which complete early are held
+// in memory until the jobs before them have completed, so one slow job holds
+// up the delivery of all those after it.
+func WithOrderedResults() Option {
+    return func(c *config) {
+        c.ordered = true
+    }
+}
+
+// WithHealthCheck pings each worker's connection once it has been idle for
+// the interval, so a broken connection is noticed and re-established before
+// a job is sent down it. The default is 0, meaning connections are only
+// found to be broken when a job fails.
+func WithHealthCheck(interval time.Duration) Option {
+    return func(c *config) {
+        c.healthCheck = interval
+    }
+}
+
+// WithCircuitBreaker stops all of the workers for a cool-down period once
+// the failure rate of recent attempts crosses the breaker's threshold. The
+// default is no circuit breaker.
+func WithCircuitBreaker(breaker CircuitBreaker) Option {
+    return func(c *config) {
+        c.breaker = breaker
+    }
+}
@@ -0,0 +1,51 @@
+package pool
+
+import (
+    "errors"
+)
+
+// errSkipped marks an id which was allocated to a job that never made it
+// onto the queue, so the results after it needn't wait for it
+var errSkipped = errors.New("pool: job not submitted")
+
+// order delivers the results sent by the workers to the Results channel in
+// the order the jobs were submitted, holding on to any which complete early
+func (p *Pool[J, R]) order() {
+
+    defer close(p.orderDone)
+
+    next := 0
+    held := make(map[int]*JobResult[J, R])
+
+    for result := range p.ordered {
+
+        held[result.JobId] = result
+
+        // Deliver as many results as are now available in order
+        for {
+            r, ok := held[next]
+            if !ok {
+                break
+            }
+            delete(held, next)
+            next++
+
+            if r.Error == errSkipped {
+                continue
+            }
+            select {
+            case p.results <- r:
+            case <-p.ctx.Done():
+            }
+        }
+
+    }
+
+}
+
+// skip tells the ordering goroutine that no result will arrive for an id
+func (p *Pool[J, R]) skip(id int) {
+    if p.ordered != nil {
+        p.ordered <- &JobResult[J, R]{JobId: id, Error: errSkipped}
+    }
+}
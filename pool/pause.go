@@ -0,0 +1,48 @@
+package pool
+
+// Pause stops the workers taking any more jobs from the queue, for example
+// during a database maintenance window. Jobs already in flight finish, and
+// queued jobs are kept until Resume is called. While paused, Wait and Close
+// will block until the pool is resumed.
+func (p *Pool[J, R]) Pause() {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    p.paused = true
+    p.setGate()
+}
+
+// Resume lets the workers carry on processing jobs after a Pause
+func (p *Pool[J, R]) Resume() {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    p.paused = false
+    p.setGate()
+}
+
+// Paused reports whether the pool is currently paused
+func (p *Pool[J, R]) Paused() bool {
+    p.mu.RLock()
+    defer p.mu.RUnlock()
+    return p.paused
+}
+
+// setGate closes the gate the workers wait on while the pool is paused or
+// its circuit breaker is open, and opens it again once neither is the case.
+// p.mu must be held.
+func (p *Pool[J, R]) setGate() {
+    hold := p.paused || p.tripped
+    if hold && !p.halted {
+        p.halted = true
+        p.resumed = make(chan struct{})
+    } else if !hold && p.halted {
+        p.halted = false
+        close(p.resumed)
+    }
+}
+
+// running returns a channel which is closed whenever the pool isn't paused
+func (p *Pool[J, R]) running() <-chan struct{} {
+    p.mu.RLock()
+    defer p.mu.RUnlock()
+    return p.resumed
+}
@@ -0,0 +1,41 @@
+package pool
+
+// Pipe chains two pools into a pipeline, such as fetch → transform →
+// insert, in which the value each job in from produces becomes a job in
+// to. Each stage is a pool of its own, so has its own workers, options and
+// Stats. Pipe reads from's results, so they mustn't be read anywhere else,
+// and submits the Value of each job which succeeded to to, while failed,
+// if it isn't nil, is called with the result of each job which failed, or
+// whose value to didn't accept, in which case Error is the error Submit
+// returned. Duplicates are passed over, as they have no Value, the first
+// job with their key having passed its own on already. A full queue in to holds up the results of from, which in turn
+// holds up its workers, so a slow stage slows the ones before it down
+// rather than piling up their output. Once from has been closed and all of
+// its results read, Pipe closes to, so closing the first stage closes each
+// of the stages after it once the jobs before them have finished, and the
+// last stage's Results can be read until the whole pipeline is done.
+func Pipe[J any, R any, S any](from *Pool[J, R], to *Pool[R, S], failed func(result *JobResult[J, R])) {
+
+    go func() {
+
+        defer to.Close()
+
+        for result := range from.Results() {
+            if result.Duplicate {
+                continue
+            }
+            if result.Error == nil {
+                _, err := to.Submit(result.Value)
+                if err == nil {
+                    continue
+                }
+                result.Error = err
+            }
+            if failed != nil {
+                failed(result)
+            }
+        }
+
+    }()
+
+}
@@ -0,0 +1,972 @@
+// Package pool implements a database connection pool using a master/worker
+// pattern. A fixed number of workers each hold their own connection to the
+// database and pick jobs off a shared queue, reconnecting and retrying the
+// job if connectivity is lost part way through a batch.
+//
+// The pool itself is not database specific, the caller supplies a
+// Connector which establishes a Store for each worker, and either
+// submits jobs implementing the Job interface or supplies a Handler to
+// process jobs of any type J into results of any type R.
+package pool
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "runtime/debug"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// JobResult structure is returned by the worker to the master thread
+// and contains information about whether the job was successful or not,
+// along with the value returned by the Handler
+type JobResult[J any, R any] struct {
+    JobId    int
+    WorkerId int
+    Job      J
+    Value    R
+    Error    error
+
+    // Attempts is the number of times the job was tried, including the
+    // final attempt which produced this result
+    Attempts int
+
+    // StartedAt and Duration time the final attempt at the job
+    StartedAt time.Time
+    Duration  time.Duration
+
+    // Duplicate is set if the job was skipped, rather than run, because one
+    // with the same idempotency key had already succeeded
+    Duplicate bool
+
+    // Outcome is whatever the job, or the Store it used, recorded about
+    // its final attempt with SetOutcome, such as how it went on each of
+    // the backends of a fan-out
+    Outcome any
+}
+
+// Handler performs a single job using the connection held in deps
+type Handler[J any, R any] func(ctx context.Context, deps Deps, job J) (R, error)
+
+// ErrClosed is returned when submitting a job to a pool which has been closed
+var ErrClosed = errors.New("pool: closed")
+
+// ErrQueueFull is returned when submitting a job to a pool whose queue is
+// full, if the pool's SubmitMode is SubmitReject or SubmitTimeout
+var ErrQueueFull = errors.New("pool: queue full")
+
+// ErrUnreachable is the cause given to the pool's context when it is
+// cancelled because a worker used up its reconnect budget
+var ErrUnreachable = errors.New("pool: unable to reconnect to the database")
+
+// Pool is a set of workers processing jobs of type J from a shared queue
+// and producing results of type R
+type Pool[J any, R any] struct {
+    ctx      context.Context
+    cancel   context.CancelCauseFunc
+    queue    chan *task[J]
+    router   *router[J]
+    fair     *fairQueue[J]
+    results  chan *JobResult[J, R]
+    ordered  chan *JobResult[J, R]
+    quit     chan struct{}
+    draining chan struct{}
+    connect  Connector
+    handle   Handler[J, R]
+    logger   Logger
+    retry    RetryPolicy
+    attempts int
+    timeout  time.Duration
+    classify ErrorClassifier
+    backoff  Backoff
+    clock    Clock
+    hooks    *Hooks
+    size     int
+    chunk    int
+    health   time.Duration
+    lazy     bool
+    warm     WarmUpFunc
+    dedup    Deduplicator
+    ttl      time.Duration
+
+    reconnectAttempts int
+    reconnectTimeout  time.Duration
+
+    submitMode    SubmitMode
+    submitTimeout time.Duration
+
+    middleware []Middleware
+
+    retries  *retryQueue[J]
+    workers  sync.WaitGroup
+    ready    sync.WaitGroup
+    requeues sync.WaitGroup
+    pending  sync.WaitGroup
+    nextId   atomic.Int64
+    counters counters
+
+    // mu guards started, closed, paused and middleware, so that no job is
+    // submitted once Close has started waiting for the pending jobs to
+    // finish, and the gate the workers wait on while paused or tripped
+    mu      sync.RWMutex
+    started bool
+    closed  bool
+    paused  bool
+    tripped bool
+    halted  bool
+    resumed chan struct{}
+
+    breaker *breaker
+
+    graph   graph[J]
+    cancels cancels
+
+    failMu   sync.Mutex
+    failFast failFast
+
+    reconnectMu sync.Mutex
+    reconnects  ReconnectStats
+
+    orderDone chan struct{}
+}
+
+// task is a submitted job along with the id the pool assigned to it.
+// Tasks dispatched with Go carry a function to run instead of a job.
+type task[J any] struct {
+    id       int
+    attempts int
+    job      J
+    fn       func(ctx context.Context) error
+    batch    interface{ done(err error) }
+    outcome  any
+
+    // expires is when the job has waited too long for a worker, if it has
+    // a TTL, from when it was last placed onto a queue
+    expires time.Time
+}
+
+// New creates a pool with the requested number of workers, each of which
+// will connect to the database using the Connector provided. It is
+// shorthand for NewJobPool(ctx, connect, WithWorkers(workers)).
+func New(ctx context.Context, workers int, connect Connector) *Pool[Job, struct{}] {
+    return NewJobPool(ctx, connect, WithWorkers(workers))
+}
+
+// NewPool creates a pool of workers configured by the options provided,
+// each of which will connect to the database using the Connector, to
+// process jobs using handle. Jobs may be submitted straight away but
+// will not be processed until Start is called.
+// Cancelling ctx stops the pool accepting jobs, aborts any connection
+// attempts in progress and terminates the workers once their current job
+// has finished. The context is also passed on to each job.
+func NewPool[J any, R any](ctx context.Context, connect Connector, handle Handler[J, R], opts ...Option) *Pool[J, R] {
+
+    c := defaultConfig()
+    for _, opt := range opts {
+        opt(c)
+    }
+
+    // Without any workers the jobs would never run, and the affinity
+    // router's queues would have no size
+    c.workers = max(c.workers, 1)
+
+    // The pool cancels its own context in fail-fast mode
+    ctx, cancel := context.WithCancelCause(ctx)
+
+    // Setup buffered input/output queues for the workers
+    p := &Pool[J, R]{
+        ctx:      ctx,
+        cancel:   cancel,
+        queue:    make(chan *task[J], c.queueSize),
+        results:  make(chan *JobResult[J, R], c.resultsBuffer),
+        quit:     make(chan struct{}),
+        draining: make(chan struct{}),
+        connect:  connect,
+        handle:   handle,
+        logger:   c.logger,
+        retry:    c.retry,
+        attempts: c.maxAttempts,
+        timeout:  c.jobTimeout,
+        classify: c.classify,
+        backoff:  c.backoff,
+        clock:    c.clock,
+        hooks:    &c.hooks,
+        size:     c.workers,
+        chunk:    max(c.chunkSize, 1),
+        health:   c.healthCheck,
+        lazy:     c.lazy,
+        warm:     c.warmUp,
+        dedup:    c.dedup,
+        ttl:      c.ttl,
+        retries:  newRetryQueue[J](c.retryQueue),
+
+        reconnectAttempts: c.reconnectAttempts,
+        reconnectTimeout:  c.reconnectTimeout,
+        resumed:           make(chan struct{}),
+
+        submitMode:    c.submitMode,
+        submitTimeout: c.submitTimeout,
+        failFast:      failFast{limit: c.failFast},
+    }
+
+    // With key affinity each worker has a queue of its own too
+    if c.affinity {
+        p.router = newRouter[J](c.workers, max(c.queueSize/c.workers, 1))
+    }
+
+    // With fair scheduling each group of jobs has a queue of its own
+    if c.fair {
+        p.fair = newFairQueue[J](max(c.queueSize, 1), c.weights)
+    }
+
+    // The pool starts off running rather than paused
+    close(p.resumed)
+    p.ready.Add(c.workers)
+    go p.retryLoop()
+
+    if c.breaker.Window > 0 && c.breaker.Threshold > 0 {
+        p.breaker = &breaker{CircuitBreaker: c.breaker, outcomes: make([]bool, c.breaker.Window)}
+    }
+
+    if c.ordered {
+        p.ordered = make(chan *JobResult[J, R], c.resultsBuffer)
+        p.orderDone = make(chan struct{})
+        go p.order()
+    }
+
+    return p
+
+}
+
+// Start spins up the workers, which connect to the database and begin
+// processing jobs from the queue. Calling Start more than once, or after
+// the pool has been closed, has no effect.
+func (p *Pool[J, R]) Start() {
+
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    if p.started || p.closed {
+        return
+    }
+    p.started = true
+
+    // Spin up the workers
+    for id := 0; id < p.size; id++ {
+        p.workers.Add(1)
+        go p.worker(id)
+    }
+
+}
+
+// Submit places a job onto the work queue, where the workers will pick it up
+// from, and returns the id assigned to it. Ids are allocated sequentially
+// from zero and are reported back in the job's JobResult. By default Submit
+// blocks if the queue buffer is full, so callers submitting a large batch
+// should read from Results in another goroutine; WithSubmitMode can make it
+// give up with ErrQueueFull instead. If the pool's context is cancelled
+// while waiting, the job is dropped and the context's error is returned.
+func (p *Pool[J, R]) Submit(job J) (int, error) {
+    return p.enqueue(&task[J]{job: job})
+}
+
+// Go dispatches a one-off function to the worker pool without the need to
+// define a job type, and returns the id assigned to it. The function's
+// JobResult has a zero Job and Value. Go treats a full queue the same way
+// as Submit.
+func (p *Pool[J, R]) Go(fn func(ctx context.Context) error) (int, error) {
+    return p.enqueue(&task[J]{fn: fn})
+}
+
+// enqueue assigns the task an id and places it onto the work queue,
+// counting it as pending until its result has been sent
+func (p *Pool[J, R]) enqueue(t *task[J]) (int, error) {
+
+    p.mu.RLock()
+    if p.closed {
+        p.mu.RUnlock()
+        return -1, ErrClosed
+    }
+    p.pending.Add(1)
+    p.counters.pending.Add(1)
+    p.mu.RUnlock()
+
+    t.id = int(p.nextId.Add(1) - 1)
+    if err := p.push(t); err != nil {
+        p.abandon(t, err)
+        return -1, err
+    }
+    return t.id, nil
+
+}
+
+// abandon gives up on a task which couldn't be placed onto the queue. Its
+// id is recorded as failed, in the background as the caller may be the one
+// reading the results, so that any job submitted with SubmitAfter to depend
+// on it fails rather than waiting forever.
+func (p *Pool[J, R]) abandon(t *task[J], err error) {
+
+    p.skip(t.id)
+    p.cancels.abandon(t.id)
+    p.requeues.Add(1)
+    go func() {
+        defer p.requeues.Done()
+        p.resolve(t.id, err)
+    }()
+    p.counters.pending.Add(-1)
+    p.pending.Done()
+
+}
+
+// push places a newly submitted task onto the queue, reacting to a full
+// queue according to the pool's SubmitMode
+func (p *Pool[J, R]) push(t *task[J]) error {
+
+    p.setExpiry(t)
+    if add := p.ownQueue(t); add != nil {
+        return p.pushOwn(add)
+    }
+
+    switch p.submitMode {
+
+    case SubmitReject:
+        select {
+        case p.queue <- t:
+            return nil
+        case <-p.ctx.Done():
+            return p.ctx.Err()
+        default:
+            return ErrQueueFull
+        }
+
+    case SubmitTimeout:
+        timer := p.clock.NewTimer(p.submitTimeout)
+        defer timer.Stop()
+        select {
+        case p.queue <- t:
+            return nil
+        case <-timer.C():
+            return ErrQueueFull
+        case <-p.ctx.Done():
+            return p.ctx.Err()
+        }
+
+    default:
+        select {
+        case p.queue <- t:
+            return nil
+        case <-p.ctx.Done():
+            return p.ctx.Err()
+        }
+
+    }
+
+}
+
+// ownQueue returns how to place the task onto the queue it goes on, if
+// that isn't the shared queue: its worker's if it's routed, or its group's
+// with fair scheduling. The function returned places the task, or returns
+// the channel to wait on for room if that queue is full.
+func (p *Pool[J, R]) ownQueue(t *task[J]) func() (<-chan struct{}, bool) {
+    if key := p.routingKey(t); key != "" {
+        return func() (<-chan struct{}, bool) { return p.router.add(t, key) }
+    }
+    if p.fair != nil {
+        group := p.group(t)
+        return func() (<-chan struct{}, bool) { return p.fair.add(t, group) }
+    }
+    return nil
+}
+
+// pushOwn places a newly submitted task onto a queue other than the shared
+// one, reacting to it being full according to the SubmitMode
+func (p *Pool[J, R]) pushOwn(add func() (<-chan struct{}, bool)) error {
+
+    var timeout <-chan time.Time
+    if p.submitMode == SubmitTimeout {
+        timer := p.clock.NewTimer(p.submitTimeout)
+        defer timer.Stop()
+        timeout = timer.C()
+    }
+
+    for {
+        space, ok := add()
+        if ok {
+            return nil
+        }
+        if p.submitMode == SubmitReject {
+            return ErrQueueFull
+        }
+        select {
+        case <-space:
+        case <-timeout:
+            return ErrQueueFull
+        case <-p.ctx.Done():
+            return p.ctx.Err()
+        }
+    }
+
+}
+
+// Results returns the channel on which a JobResult is sent for every job
+// once it has been processed, or in submission order if the pool was created
+// WithOrderedResults. The channel is closed by Close once every submitted
+// job has been accounted for.
+func (p *Pool[J, R]) Results() <-chan *JobResult[J, R] {
+    return p.results
+}
+
+// Each calls fn with the result of every job, in the order they are sent
+// on the Results channel,
+// until the pool has been closed and every submitted job (including any
+// which had to be retried) has been accounted for. Jobs are typically
+// submitted and the pool closed from another goroutine while Each runs.
+func (p *Pool[J, R]) Each(fn func(result *JobResult[J, R])) {
+    for result := range p.results {
+        fn(result)
+    }
+}
+
+// Wait blocks until every job submitted so far has finished and had its
+// result sent, or until the pool's context is cancelled in which case the
+// context's error is returned (or the error from Err, if the pool cancelled
+// itself). Results must be read while Wait is blocked, otherwise
+// the workers will stall once the results buffer is full.
+func (p *Pool[J, R]) Wait() error {
+
+    finished := make(chan struct{})
+    go func() {
+        p.pending.Wait()
+        close(finished)
+    }()
+
+    select {
+    case <-finished:
+        return nil
+    case <-p.ctx.Done():
+        if err := p.Err(); err != nil {
+            return err
+        }
+        return p.ctx.Err()
+    }
+
+}
+
+// Close stops the pool accepting new jobs, waits for the jobs already
+// submitted to finish, then terminates all of the workers, closing their
+// connections, and closes the Results channel. If the pool's context is
+// cancelled, or the pool was never started, any jobs still queued are
+// discarded. Calling Close more than once, or after Drain, has no effect.
+func (p *Pool[J, R]) Close() {
+
+    started, ok := p.stopAccepting()
+    if !ok {
+        return
+    }
+
+    if started {
+        p.Wait()
+    }
+
+    p.shutdown()
+
+}
+
+// stopAccepting marks the pool as closed to new jobs, returning false if
+// it had already been closed
+func (p *Pool[J, R]) stopAccepting() (started bool, ok bool) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    if p.closed {
+        return p.started, false
+    }
+    p.closed = true
+    return p.started, true
+}
+
+// shutdown terminates the workers and closes the Results channel
+func (p *Pool[J, R]) shutdown() {
+    close(p.quit)
+    p.workers.Wait()
+    p.requeues.Wait()
+    <-p.retries.done
+    if p.ordered != nil {
+        close(p.ordered)
+        <-p.orderDone
+    }
+    close(p.results)
+}
+
+// Worker connects to the DB and waits for incoming jobs on the queue.
+// Once a job is finished it will send the results back on the results
+// channel. If a job fails and the retry policy allows it will put the
+// failed job back on the queue instead, and if the failure was due to
+// the DB not being connected it will re-establish DB connectivity and
+// then continue processing jobs. If a job panics it is failed and the
+// worker restarts with a fresh connection.
+func (p *Pool[J, R]) worker(id int) {
+
+    defer p.workers.Done()
+
+    // Keep track of whether this worker is connected for the pool's stats
+    connected := false
+    setConnected := func(c bool) {
+        if c != connected {
+            connected = c
+            if c {
+                p.counters.active.Add(1)
+            } else {
+                p.counters.active.Add(-1)
+            }
+        }
+    }
+    defer setConnected(false)
+
+    // Keep trying to connect to the database until we get a connection,
+    // returning the number of attempts made and false if the pool is
+    // closed or cancelled first
+    deps := Deps{WorkerId: id}
+    connect := func() (int, bool) {
+        conn, attempts, err := p.reconnect(id)
+        if err != nil {
+            return attempts, false
+        }
+        setConnected(true)
+        deps.Conn = conn
+        return attempts, true
+    }
+
+    // Connect and warm up straight away unless connecting lazily, and
+    // make sure the connection is closed when the worker exits
+    ready := sync.OnceFunc(p.ready.Done)
+    defer ready()
+    if !p.lazy || p.warm != nil {
+        if _, ok := connect(); !ok {
+            return
+        }
+        p.warmUp(deps)
+    }
+    ready()
+    defer func() {
+        if deps.Conn != nil {
+            deps.Conn.Close()
+        }
+    }()
+
+    // Restart the worker with a fresh connection, returning false if
+    // the pool is closed or cancelled before it can reconnect
+    restart := func(err error) bool {
+        p.hooks.workerDown(id, err)
+        setConnected(false)
+        deps.Conn.Close()
+        deps.Conn = nil
+        down := p.clock.Now()
+        attempts, ok := connect()
+        if ok {
+            p.reconnected(id, attempts, p.clock.Now().Sub(down))
+        }
+        return ok
+    }
+
+    // Routed jobs come to this worker on its own queue, and when it has
+    // nothing to do it steals them from the others'
+    var mine, backlog chan struct{}
+    if p.router != nil {
+        mine, backlog = p.router.queues[id].ready, p.router.backlog
+    }
+    var fair chan struct{}
+    if p.fair != nil {
+        fair = p.fair.ready
+    }
+
+    // Jobs taken from the shared queue along with the one the worker was
+    // waiting for, which it works through before going back to the queue
+    buf := make([]*task[J], 0, p.chunk-1)
+    var chunk []*task[J]
+
+    // Jobs held by the worker when the pool is drained are failed
+    var overflow *task[J]
+    var overflowDelay time.Duration
+    drop := func() {
+        if overflow != nil {
+            p.drop(overflow)
+        }
+        for _, t := range chunk {
+            p.drop(t)
+        }
+    }
+
+    for {
+
+        // Hold off while the pool is paused
+        select {
+        case <-p.running():
+        case <-p.draining:
+            drop()
+            return
+        case <-p.quit:
+            return
+        case <-p.ctx.Done():
+            return
+        }
+
+        // A job the retry queue had no room for is retried by this worker
+        // once its delay is up, before it takes another from the queue, as
+        // is a job it was holding while the pool was paused
+        var t *task[J]
+        if overflow != nil {
+            t, overflow = overflow, nil
+            if !p.await(t, overflowDelay) {
+                select {
+                case <-p.draining:
+                    drop()
+                default:
+                }
+                return
+            }
+        } else if len(chunk) > 0 {
+            select {
+            case <-p.draining:
+                drop()
+                return
+            default:
+            }
+            t = chunk[0]
+            chunk[0] = nil
+            chunk = chunk[1:]
+        } else {
+
+            // Wait for an incoming job on the job queue (blocking), for the
+            // pool to close or drain or for the context to be cancelled. If the
+            // worker sits idle for too long check its connection is still good.
+            if p.router != nil {
+                p.router.steal(id, p.routingKey)
+            }
+            var idle Timer
+            var check <-chan time.Time
+            if p.health > 0 && deps.Conn != nil {
+                idle = p.clock.NewTimer(p.health)
+                check = idle.C()
+            }
+            select {
+            case t = <-p.queue:
+                if idle != nil {
+                    idle.Stop()
+                }
+                chunk = p.fill(buf[:0])
+            case <-mine:
+                if idle != nil {
+                    idle.Stop()
+                }
+                if t = p.router.take(id, p.routingKey); t == nil {
+                    continue
+                }
+            case <-backlog:
+                if idle != nil {
+                    idle.Stop()
+                }
+                p.router.steal(id, p.routingKey)
+                continue
+            case <-fair:
+                if idle != nil {
+                    idle.Stop()
+                }
+                if t = p.fair.take(); t == nil {
+                    continue
+                }
+            case <-check:
+                if err := p.ping(deps); err != nil {
+                    p.logger.Printf("Worker %d: Health check failed, reconnecting (%s)", id, err)
+                    p.counters.unhealthy.Add(1)
+                    ok := restart(err)
+                    p.counters.unhealthy.Add(-1)
+                    if !ok {
+                        return
+                    }
+                }
+                continue
+            case <-p.draining:
+                return
+            case <-p.quit:
+                return
+            case <-p.ctx.Done():
+                return
+            }
+
+        }
+
+        // The pool may have been paused, or its circuit breaker tripped,
+        // while the worker waited for the job, in which case it holds on to
+        // the job until the pool is running again
+        select {
+        case <-p.running():
+        default:
+            overflow, overflowDelay = t, 0
+            continue
+        }
+
+        // A job cancelled while it was queued, or which waited longer than
+        // its TTL, is failed without being run
+        if !p.cancels.start(t.id) {
+            p.counters.cancelled.Add(1)
+            if !p.reject(t, id, ErrCancelled) {
+                return
+            }
+            continue
+        }
+        if p.expired(t) {
+            p.counters.expired.Add(1)
+            if !p.reject(t, id, ErrExpired) {
+                return
+            }
+            continue
+        }
+
+        // A lazy worker connects when it receives its first job
+        if deps.Conn == nil {
+            if _, ok := connect(); !ok {
+                return
+            }
+        }
+
+        p.hooks.jobStart(JobInfo{JobId: t.id, WorkerId: id, Attempt: t.attempts + 1})
+
+        p.counters.inFlight.Add(1)
+        started := p.clock.Now()
+        value, err := p.run(t, deps)
+        duration := p.clock.Now().Sub(started)
+        p.counters.inFlight.Add(-1)
+        t.attempts++
+
+        duplicate := err == errDuplicate
+        if duplicate {
+            p.counters.duplicates.Add(1)
+            err = nil
+        }
+
+        info := JobInfo{
+            JobId:     t.id,
+            WorkerId:  id,
+            Attempt:   t.attempts,
+            StartedAt: started,
+            Duration:  duration,
+            Error:     err,
+        }
+
+        if err != nil {
+
+            // A panic fails the job, and as the connection may have been left
+            // in any state the worker restarts by reconnecting
+            class := p.classify(err)
+            p.attempted(class != Fatal)
+            var panicked *PanicError
+            if errors.As(err, &panicked) {
+                p.logger.Printf("Worker %d: Job %d panicked, restarting worker (%s)", id, t.id, err)
+                class = Fatal
+                if !restart(err) {
+                    return
+                }
+            }
+
+            // If the error isn't fatal, the job has attempts left and the retry policy allows,
+            // put our job back onto the queue after the delay, holding it
+            retry, delay := false, time.Duration(0)
+            if class != Fatal && (p.attempts <= 0 || t.attempts < p.attempts) {
+                retry, delay = p.retry.ShouldRetry(err, t.attempts)
+            }
+            // on the retry queue, or if that's full have this worker retry it
+            // itself once the delay is up, which holds back new jobs until
+            // the retry queue has room. Routed jobs are always retried by
+            // their worker, so the jobs with the same key stay in order.
+            if retry {
+                p.logger.Printf("Worker %d: Job %d failed on attempt %d, retrying in %s (%s)", id, t.id, t.attempts, delay, err)
+                p.hooks.retry(info, delay)
+                p.counters.retried.Add(1)
+                if p.routingKey(t) != "" || !p.delay(t, p.clock.Now().Add(delay), true) {
+                    overflow, overflowDelay = t, delay
+                }
+            }
+
+            // If our job failed because the database is no longer
+            // connected then reconnect before continue processing
+            if class == Disconnected {
+                p.logger.Printf("Worker %d: Lost database connection, reconnecting", id)
+                if !restart(err) {
+                    return
+                }
+            }
+
+            if retry {
+                continue
+            }
+
+        } else {
+            p.attempted(false)
+        }
+
+        // Send our results back
+        result := &JobResult[J, R]{
+            JobId:     t.id,
+            WorkerId:  id,
+            Job:       t.job,
+            Value:     value,
+            Error:     err,
+            Attempts:  t.attempts,
+            StartedAt: started,
+            Duration:  duration,
+            Duplicate: duplicate,
+            Outcome:   t.outcome,
+        }
+        if !p.finish(t, result, info) {
+            return
+        }
+
+    }
+
+}
+
+// fill takes jobs from the shared queue into the rest of a worker's chunk,
+// for as long as there are any queued and there's room
+func (p *Pool[J, R]) fill(chunk []*task[J]) []*task[J] {
+    for len(chunk) < cap(chunk) {
+        select {
+        case t := <-p.queue:
+            chunk = append(chunk, t)
+        default:
+            return chunk
+        }
+    }
+    return chunk
+}
+
+// ping checks a worker's connection, giving up after the health check
+// interval
+func (p *Pool[J, R]) ping(deps Deps) error {
+    ctx, cancel := context.WithTimeout(p.ctx, p.health)
+    defer cancel()
+    return deps.Conn.Ping(ctx)
+}
+
+// finish sends the final result of a job and records its outcome, returning
+// false if the pool's context was cancelled before the result could be sent
+func (p *Pool[J, R]) finish(t *task[J], result *JobResult[J, R], info JobInfo) bool {
+
+    // In ordered mode results go via the goroutine which reorders them
+    out := p.results
+    if p.ordered != nil {
+        out = p.ordered
+    }
+
+    select {
+    case out <- result:
+    case <-p.ctx.Done():
+        return false
+    }
+
+    if t.batch != nil {
+        t.batch.done(result.Error)
+    }
+    if result.Error != nil {
+        p.counters.failed.Add(1)
+        if result.Error != ErrDrained && result.Error != ErrCancelled {
+            p.jobFailed(result.JobId, result.Error)
+        }
+    } else {
+        p.counters.completed.Add(1)
+    }
+    p.counters.pending.Add(-1)
+    p.hooks.jobDone(info)
+    if key := p.routingKey(t); key != "" {
+        p.router.done(info.WorkerId, key)
+    }
+    p.resolve(t.id, result.Error)
+    p.cancels.withdraw(t.id)
+    p.pending.Done()
+    return true
+
+}
+
+// run makes a single attempt at a job, passing it through any middleware
+// and giving it a deadline if there is a timeout configured. A panic is
+// recovered and returned as a *PanicError. Any outcome recorded with
+// SetOutcome is kept on the task.
+func (p *Pool[J, R]) run(t *task[J], deps Deps) (value R, err error) {
+
+    ctx := context.WithValue(p.ctx, jobIdKey{}, t.id)
+    recorded := &outcome{}
+    ctx = context.WithValue(ctx, outcomeKey{}, recorded)
+    defer func() {
+        t.outcome = recorded.get()
+    }()
+    if p.timeout > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, p.timeout)
+        defer cancel()
+    }
+
+    defer func() {
+        if v := recover(); v != nil {
+            err = &PanicError{Value: v, Stack: debug.Stack()}
+        }
+    }()
+
+    exec := p.chain(func(ctx context.Context, deps Deps) error {
+        if t.fn != nil {
+            return t.fn(ctx)
+        }
+        return p.deduplicate(ctx, deps, t, func() error {
+            var err error
+            value, err = p.handle(ctx, deps, t.job)
+            return err
+        })
+    })
+
+    return value, exec(ctx, deps)
+
+}
+
+// reconnect keeps trying to connect the worker to the database, backing off
+// between attempts, until it succeeds or the pool is closed or cancelled.
+// It returns the number of attempts made along with the connection.
+func (p *Pool[J, R]) reconnect(id int) (Store, int, error) {
+
+    down := p.clock.Now()
+    for attempt := 1; ; attempt++ {
+
+        conn, err := p.connect.Connect(p.ctx, id)
+        if err == nil {
+            return conn, attempt, nil
+        }
+        if p.ctx.Err() != nil {
+            return nil, attempt, p.ctx.Err()
+        }
+
+        // Give up on the whole run once the reconnect budget is used up,
+        // rather than waiting forever for a database which isn't coming back
+        downtime := p.clock.Now().Sub(down)
+        if (p.reconnectAttempts > 0 && attempt >= p.reconnectAttempts) ||
+            (p.reconnectTimeout > 0 && downtime >= p.reconnectTimeout) {
+            err = fmt.Errorf("%w: worker %d gave up after %d attempts over %s: %w", ErrUnreachable, id, attempt, downtime, err)
+            p.logger.Printf("Worker %d: Unable to connect to database, aborting (%s)", id, err)
+            p.cancel(err)
+            return nil, attempt, err
+        }
+
+        delay := p.backoff.Delay(attempt)
+        p.logger.Printf("Worker %d: Unable to connect to database, retrying in %s (%s)", id, delay, err)
+
+        timer := p.clock.NewTimer(delay)
+        select {
+        case <-timer.C():
+        case <-p.quit:
+            timer.Stop()
+            return nil, attempt, ErrClosed
+        case <-p.ctx.Done():
+            timer.Stop()
+            return nil, attempt, p.ctx.Err()
+        }
+
+    }
+
+}
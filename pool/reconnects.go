@@ -0,0 +1,61 @@
+package pool
+
+import (
+    "time"
+)
+
+// ReconnectStats summarises the workers' reconnections after losing their
+// connection to the database (or restarting after a panic), so that a
+// flapping network path shows up in a run's statistics
+type ReconnectStats struct {
+    // Reconnects is the number of times a worker has re-established its
+    // connection, and Attempts the number of attempts that took in total
+    Reconnects int
+    Attempts   int
+
+    // Downtime is the total time workers spent reconnecting, and
+    // MaxDowntime the longest any single reconnection took
+    Downtime    time.Duration
+    MaxDowntime time.Duration
+
+    // ByWorker counts the reconnects made by each worker, by worker id
+    ByWorker map[int]int
+}
+
+// reconnected records a worker re-establishing its connection
+func (p *Pool[J, R]) reconnected(id int, attempts int, downtime time.Duration) {
+
+    p.hooks.reconnect(id, attempts, downtime)
+    p.counters.reconnects.Add(1)
+
+    p.reconnectMu.Lock()
+    defer p.reconnectMu.Unlock()
+
+    r := &p.reconnects
+    r.Reconnects++
+    r.Attempts += attempts
+    r.Downtime += downtime
+    if downtime > r.MaxDowntime {
+        r.MaxDowntime = downtime
+    }
+    if r.ByWorker == nil {
+        r.ByWorker = make(map[int]int)
+    }
+    r.ByWorker[id]++
+
+}
+
+// Reconnects returns a snapshot of the workers' reconnections so far
+func (p *Pool[J, R]) Reconnects() ReconnectStats {
+
+    p.reconnectMu.Lock()
+    defer p.reconnectMu.Unlock()
+
+    r := p.reconnects
+    r.ByWorker = make(map[int]int, len(p.reconnects.ByWorker))
+    for id, n := range p.reconnects.ByWorker {
+        r.ByWorker[id] = n
+    }
+    return r
+
+}
@@ -0,0 +1,95 @@
+package pool
+
+import (
+    "math"
+    "time"
+)
+
+// RetryPolicy decides whether a failed job should be put back onto the
+// queue to be tried again, and how long to wait before doing so. attempt
+// is the number of times the job has been tried so far, starting at 1.
+// It is only consulted for errors which the pool's ErrorClassifier does
+// not consider Fatal.
+type RetryPolicy interface {
+    ShouldRetry(err error, attempt int) (bool, time.Duration)
+}
+
+// RetryPolicyFunc adapts an ordinary function to the RetryPolicy interface
+type RetryPolicyFunc func(err error, attempt int) (bool, time.Duration)
+
+// ShouldRetry calls f(err, attempt)
+func (f RetryPolicyFunc) ShouldRetry(err error, attempt int) (bool, time.Duration) {
+    return f(err, attempt)
+}
+
+// DefaultRetry is the default policy, it retries jobs indefinitely after a
+// backoff, so a job which failed because of a broken connection or an
+// overloaded server doesn't go straight back and fail the same way
+var DefaultRetry RetryPolicy = BackoffRetry{Backoff: DefaultRetryBackoff}
+
+// RetryForever retries jobs immediately and indefinitely
+var RetryForever RetryPolicy = RetryPolicyFunc(func(err error, attempt int) (bool, time.Duration) {
+    return true, 0
+})
+
+// NoRetry never retries a job
+var NoRetry RetryPolicy = RetryPolicyFunc(func(err error, attempt int) (bool, time.Duration) {
+    return false, 0
+})
+
+// ConstantRetry retries failed jobs after a fixed delay, until it has
+// been tried MaxAttempts times (zero means no limit)
+type ConstantRetry struct {
+    Delay       time.Duration
+    MaxAttempts int
+}
+
+// ShouldRetry implements RetryPolicy
+func (r ConstantRetry) ShouldRetry(err error, attempt int) (bool, time.Duration) {
+    if r.MaxAttempts > 0 && attempt >= r.MaxAttempts {
+        return false, 0
+    }
+    return true, r.Delay
+}
+
+// ExponentialRetry retries failed jobs, doubling the delay between each
+// attempt from Initial up to Max, until it has been tried MaxAttempts times
+// (zero means no limit)
+type ExponentialRetry struct {
+    Initial     time.Duration
+    Max         time.Duration
+    MaxAttempts int
+}
+
+// ShouldRetry implements RetryPolicy
+func (r ExponentialRetry) ShouldRetry(err error, attempt int) (bool, time.Duration) {
+    if r.MaxAttempts > 0 && attempt >= r.MaxAttempts {
+        return false, 0
+    }
+    // Without a Max, the doubling stops before it would overflow
+    delay := r.Initial
+    for i := 1; i < attempt && (r.Max <= 0 || delay < r.Max) && delay <= math.MaxInt64/2; i++ {
+        delay *= 2
+    }
+    if r.Max > 0 && delay > r.Max {
+        delay = r.Max
+    }
+    return true, delay
+}
+
+// BackoffRetry retries failed jobs after the Backoff's delay for the number
+// of attempts made, which grows exponentially with random jitter, so jobs
+// which failed together don't all retry in lock step, until it has been
+// tried MaxAttempts times (zero means no limit)
+type BackoffRetry struct {
+    Backoff     Backoff
+    MaxAttempts int
+}
+
+// ShouldRetry implements RetryPolicy
+func (r BackoffRetry) ShouldRetry(err error, attempt int) (bool, time.Duration) {
+    if r.MaxAttempts > 0 && attempt >= r.MaxAttempts {
+        return false, 0
+    }
+    return true, r.Backoff.Delay(attempt)
+}
@@ -0,0 +1,237 @@
+package pool
+
+import (
+    "container/heap"
+    "sync"
+    "time"
+)
+
+// retryQueue holds the jobs waiting to go back onto the work queue: those
+// which failed and are to be retried after a delay, along with those
+// submitted with SubmitAt or waiting for their dependencies. A single
+// goroutine, retryLoop, moves each onto the work queue when it comes due.
+// Retries are bounded by size, so a burst of failures can't pile up without
+// limit, while scheduled jobs are bounded by the callers submitting them.
+type retryQueue[J any] struct {
+    mu      sync.Mutex
+    delayed delayedHeap[J]
+    retries int
+    size    int
+    added   uint64
+
+    // wake is signalled when a job is added, in case it's due sooner than
+    // the one retryLoop is waiting for, and done is closed once it exits
+    wake chan struct{}
+    done chan struct{}
+}
+
+// delayed is a job held by the retryQueue until it's due
+type delayed[J any] struct {
+    t         *task[J]
+    due       time.Time
+    retry     bool
+    scheduled bool
+    seq       uint64
+}
+
+// delayedHeap orders the delayed jobs by when they're due, and in the order
+// they were added when they're due at the same time
+type delayedHeap[J any] []delayed[J]
+
+func (h delayedHeap[J]) Len() int { return len(h) }
+func (h delayedHeap[J]) Less(i, j int) bool {
+    if h[i].due.Equal(h[j].due) {
+        return h[i].seq < h[j].seq
+    }
+    return h[i].due.Before(h[j].due)
+}
+func (h delayedHeap[J]) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *delayedHeap[J]) Push(x any)   { *h = append(*h, x.(delayed[J])) }
+func (h *delayedHeap[J]) Pop() any {
+    old := *h
+    d := old[len(old)-1]
+    *h = old[:len(old)-1]
+    return d
+}
+
+// newRetryQueue creates a retry queue with room for size retries
+func newRetryQueue[J any](size int) *retryQueue[J] {
+    return &retryQueue[J]{size: size, wake: make(chan struct{}, 1), done: make(chan struct{})}
+}
+
+// add holds a job until it's due, returning false without holding it if
+// it's a retry and the queue already has its fill of them
+func (q *retryQueue[J]) add(d delayed[J]) bool {
+
+    q.mu.Lock()
+    if d.retry {
+        if q.size > 0 && q.retries >= q.size {
+            q.mu.Unlock()
+            return false
+        }
+        q.retries++
+    }
+    d.seq = q.added
+    q.added++
+    heap.Push(&q.delayed, d)
+    q.mu.Unlock()
+
+    select {
+    case q.wake <- struct{}{}:
+    default:
+    }
+    return true
+
+}
+
+// next removes and returns the first job if it's due, or else returns how
+// long until it is, or a negative wait if the queue is empty
+func (q *retryQueue[J]) next(now time.Time) (d delayed[J], ok bool, wait time.Duration) {
+
+    q.mu.Lock()
+    defer q.mu.Unlock()
+
+    if len(q.delayed) == 0 {
+        return d, false, -1
+    }
+    if wait := q.delayed[0].due.Sub(now); wait > 0 {
+        return d, false, wait
+    }
+    d = heap.Pop(&q.delayed).(delayed[J])
+    if d.retry {
+        q.retries--
+    }
+    return d, true, 0
+
+}
+
+// flush removes and returns every job the queue holds
+func (q *retryQueue[J]) flush() []delayed[J] {
+
+    q.mu.Lock()
+    defer q.mu.Unlock()
+
+    held := q.delayed
+    q.delayed = nil
+    q.retries = 0
+    return held
+
+}
+
+// delay holds a task until due before placing it onto the work queue,
+// returning false if it's a retry and the retry queue is full
+func (p *Pool[J, R]) delay(t *task[J], due time.Time, retry bool) bool {
+    return p.retries.add(delayed[J]{t: t, due: due, retry: retry})
+}
+
+// retryLoop moves the jobs held by the retry queue onto the work queue as
+// they come due, until the pool is closed, drained or cancelled. The jobs
+// it still holds when the pool is drained are failed by Drain.
+func (p *Pool[J, R]) retryLoop() {
+
+    defer close(p.retries.done)
+
+    for {
+        d, ok, wait := p.retries.next(p.clock.Now())
+        if ok {
+            if d.scheduled {
+                p.counters.scheduled.Add(-1)
+            }
+            if !p.requeue(d.t) {
+                return
+            }
+            continue
+        }
+
+        var timer Timer
+        var due <-chan time.Time
+        if wait > 0 {
+            timer = p.clock.NewTimer(wait)
+            due = timer.C()
+        }
+        select {
+        case <-due:
+        case <-p.retries.wake:
+        case <-p.draining:
+        case <-p.quit:
+        case <-p.ctx.Done():
+        }
+        if timer != nil {
+            timer.Stop()
+        }
+        if p.stopping() {
+            return
+        }
+    }
+
+}
+
+// requeue places a task which has come due onto the shared queue, or its
+// own if it has one, returning false if the pool is drained, closed or
+// cancelled first, in which case a drained task is failed
+func (p *Pool[J, R]) requeue(t *task[J]) bool {
+
+    p.setExpiry(t)
+    add := p.ownQueue(t)
+    for {
+        queue, space := p.queue, (<-chan struct{})(nil)
+        if add != nil {
+            var ok bool
+            if space, ok = add(); ok {
+                return true
+            }
+            queue = nil
+        }
+        select {
+        case queue <- t:
+            return true
+        case <-space:
+        case <-p.draining:
+            p.drop(t)
+            return false
+        case <-p.quit:
+            return false
+        case <-p.ctx.Done():
+            return false
+        }
+    }
+
+}
+
+// stopping reports whether the pool is being drained, closed or cancelled,
+// so the retry loop should exit
+func (p *Pool[J, R]) stopping() bool {
+    select {
+    case <-p.draining:
+        return true
+    case <-p.quit:
+        return true
+    case <-p.ctx.Done():
+        return true
+    default:
+        return false
+    }
+}
+
+// await waits out the delay before a worker retries a job the retry queue
+// had no room for, returning false if the pool is closed, drained or
+// cancelled first, in which case a drained job is failed
+func (p *Pool[J, R]) await(t *task[J], delay time.Duration) bool {
+
+    if delay > 0 {
+        timer := p.clock.NewTimer(delay)
+        defer timer.Stop()
+        select {
+        case <-timer.C():
+        case <-p.draining:
+            p.drop(t)
+            return false
+        case <-p.quit:
+            return false
+        case <-p.ctx.Done():
+            return false
+        }
+    }
+    return true
+
+}
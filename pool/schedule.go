@@ -0,0 +1,52 @@
+package pool
+
+import (
+    "time"
+)
+
+// SubmitAt submits a job which the pool holds until its RunAt time, then
+// places onto the work queue, and returns the id assigned to it straight
+// away. A job whose time has already passed is queued at once. Close waits
+// for scheduled jobs to come due and be processed, while Drain fails them
+// with ErrDrained without waiting.
+func (p *Pool[J, R]) SubmitAt(job J, runAt time.Time) (int, error) {
+    return p.schedule(&task[J]{job: job}, runAt)
+}
+
+// SubmitAt places a job belonging to this batch onto the pool's work queue
+// at its RunAt time, as by Pool.SubmitAt
+func (b *Batch[J, R]) SubmitAt(job J, runAt time.Time) (int, error) {
+
+    t := &task[J]{job: job, batch: b}
+    b.pending.Add(1)
+    id, err := b.pool.schedule(t, runAt)
+    if err != nil {
+        b.pending.Done()
+        return id, err
+    }
+    b.submitted.Add(1)
+    return id, nil
+
+}
+
+// schedule assigns the task an id and counts it as pending, the same as
+// enqueue, but holds it on the retry queue until runAt before placing it
+// onto the work queue. Scheduled jobs don't count towards the retry
+// queue's size.
+func (p *Pool[J, R]) schedule(t *task[J], runAt time.Time) (int, error) {
+
+    p.mu.RLock()
+    if p.closed {
+        p.mu.RUnlock()
+        return -1, ErrClosed
+    }
+    p.pending.Add(1)
+    p.counters.pending.Add(1)
+    p.mu.RUnlock()
+
+    t.id = int(p.nextId.Add(1) - 1)
+    p.counters.scheduled.Add(1)
+    p.retries.add(delayed[J]{t: t, due: runAt, scheduled: true})
+    return t.id, nil
+
+}
@@ -0,0 +1,166 @@
+package pool
+
+import (
+    "context"
+    "sync"
+    "time"
+)
+
+// Schedule is when a recurring job comes round, such as a parsed cron
+// expression. Next returns the first time after t that it's due, or the
+// zero time if it never is again. A robfig/cron Schedule satisfies it.
+type Schedule interface {
+    Next(t time.Time) time.Time
+}
+
+// Scheduler submits jobs to a pool on recurring schedules, so that a
+// long-lived process can run batches of work on the same workers (and
+// their connections) at set times rather than once
+type Scheduler[J any, R any] struct {
+    pool *Pool[J, R]
+
+    mu      sync.Mutex
+    entries []*entry[J]
+    added   chan struct{}
+    batches sync.WaitGroup
+}
+
+// entry is a schedule along with the jobs to submit when it comes round
+type entry[J any] struct {
+    schedule Schedule
+    jobs     func(at time.Time) []J
+    next     time.Time
+}
+
+// NewScheduler creates a scheduler which submits jobs to the pool
+func NewScheduler[J any, R any](p *Pool[J, R]) *Scheduler[J, R] {
+    return &Scheduler[J, R]{pool: p, added: make(chan struct{}, 1)}
+}
+
+// Add calls jobs each time the schedule comes round, with the time it was
+// due, and submits the jobs it returns as a batch. It may be called while
+// the Scheduler is running.
+func (s *Scheduler[J, R]) Add(schedule Schedule, jobs func(at time.Time) []J) {
+
+    s.mu.Lock()
+    s.entries = append(s.entries, &entry[J]{schedule: schedule, jobs: jobs, next: schedule.Next(s.pool.clock.Now())})
+    s.mu.Unlock()
+
+    select {
+    case s.added <- struct{}{}:
+    default:
+    }
+
+}
+
+// Run submits the jobs for each schedule as it comes round until ctx is
+// done or the pool is closed or cancelled, and returns once every batch it
+// submitted has finished. Times missed while a previous batch was still
+// being submitted are skipped rather than run late. Each batch's outcome
+// is logged through the pool's Logger.
+func (s *Scheduler[J, R]) Run(ctx context.Context) error {
+
+    defer s.batches.Wait()
+
+    for {
+
+        // Sleep until the earliest schedule is due, or a new one is added
+        var timer Timer
+        var due <-chan time.Time
+        if next := s.next(); !next.IsZero() {
+            timer = s.pool.clock.NewTimer(next.Sub(s.pool.clock.Now()))
+            due = timer.C()
+        }
+        select {
+        case <-due:
+        case <-s.added:
+            if timer != nil {
+                timer.Stop()
+            }
+            continue
+        case <-ctx.Done():
+            if timer != nil {
+                timer.Stop()
+            }
+            return ctx.Err()
+        case <-s.pool.quit:
+            if timer != nil {
+                timer.Stop()
+            }
+            return ErrClosed
+        case <-s.pool.ctx.Done():
+            if timer != nil {
+                timer.Stop()
+            }
+            return s.pool.ctx.Err()
+        }
+
+        for _, e := range s.due() {
+            if err := s.submit(e); err != nil {
+                return err
+            }
+        }
+
+    }
+
+}
+
+// next returns the time the earliest schedule is next due, or the zero
+// time if none of them are
+func (s *Scheduler[J, R]) next() time.Time {
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    var next time.Time
+    for _, e := range s.entries {
+        if !e.next.IsZero() && (next.IsZero() || e.next.Before(next)) {
+            next = e.next
+        }
+    }
+    return next
+
+}
+
+// due returns the entries which have come round, each with the time it
+// was due, and moves them on to the next time they're due
+func (s *Scheduler[J, R]) due() []entry[J] {
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    now := s.pool.clock.Now()
+    var due []entry[J]
+    for _, e := range s.entries {
+        if e.next.IsZero() || e.next.After(now) {
+            continue
+        }
+        due = append(due, *e)
+        e.next = e.schedule.Next(now)
+    }
+    return due
+
+}
+
+// submit submits the jobs for an entry as a batch, and logs its outcome
+// once it has finished
+func (s *Scheduler[J, R]) submit(e entry[J]) error {
+
+    batch := s.pool.Batch()
+    for _, job := range e.jobs(e.next) {
+        if _, err := batch.Submit(job); err != nil {
+            return err
+        }
+    }
+
+    s.batches.Add(1)
+    go func() {
+        defer s.batches.Done()
+        stats, err := batch.Wait()
+        if err != nil {
+            return
+        }
+        s.pool.logger.Printf("Scheduled run at %s completed %d jobs (%d failed) in %s",
+            e.next.Format(time.RFC3339), stats.Completed, stats.Failed, stats.Duration)
+    }()
+    return nil
+
+}
@@ -0,0 +1,99 @@
+package pool
+
+import (
+    "sync/atomic"
+)
+
+// Stats is a snapshot of the pool's progress, for a supervising process
+// to monitor
+type Stats struct {
+    // Queued jobs have been submitted, or are waiting to be retried,
+    // but are not currently being processed by a worker
+    Queued int
+
+    // Scheduled jobs were submitted with SubmitAt and are being held
+    // until their RunAt time, and aren't counted as Queued
+    Scheduled int
+
+    // InFlight jobs are currently being processed by a worker
+    InFlight int
+
+    // Completed and Failed count the jobs which have finished
+    // successfully and unsuccessfully
+    Completed int
+    Failed    int
+
+    // Retried counts the number of times a failed job has been requeued
+    Retried int
+
+    // Cancelled counts the jobs cancelled before they started, which are
+    // counted as Failed
+    Cancelled int
+
+    // Expired counts the jobs which waited longer than their TTL for a
+    // worker, which are counted as Failed
+    Expired int
+
+    // Duplicates counts the jobs skipped, and counted as Completed, because
+    // one with the same idempotency key had already succeeded
+    Duplicates int
+
+    // Workers is the size of the pool, of which ActiveWorkers are
+    // currently connected to the database
+    Workers       int
+    ActiveWorkers int
+
+    // Unhealthy workers have failed a health check and are reconnecting
+    Unhealthy int
+
+    // Reconnects counts the times workers have re-established their
+    // connection; see Reconnects for the details
+    Reconnects int
+
+    // Paused is true while the pool is paused
+    Paused bool
+
+    // CircuitOpen is true while the circuit breaker has stopped the workers
+    CircuitOpen bool
+}
+
+// counters are updated by the workers as jobs progress through the pool
+type counters struct {
+    pending    atomic.Int64
+    scheduled  atomic.Int64
+    inFlight   atomic.Int64
+    completed  atomic.Int64
+    failed     atomic.Int64
+    retried    atomic.Int64
+    duplicates atomic.Int64
+    cancelled  atomic.Int64
+    expired    atomic.Int64
+    active     atomic.Int64
+    unhealthy  atomic.Int64
+    reconnects atomic.Int64
+}
+
+// Stats returns a snapshot of the pool's progress. The counts are read
+// individually while the workers are running, so may be very slightly
+// inconsistent with each other.
+func (p *Pool[J, R]) Stats() Stats {
+    inFlight := int(p.counters.inFlight.Load())
+    scheduled := int(p.counters.scheduled.Load())
+    return Stats{
+        Queued:        int(p.counters.pending.Load()) - inFlight - scheduled,
+        Scheduled:     scheduled,
+        InFlight:      inFlight,
+        Completed:     int(p.counters.completed.Load()),
+        Failed:        int(p.counters.failed.Load()),
+        Retried:       int(p.counters.retried.Load()),
+        Duplicates:    int(p.counters.duplicates.Load()),
+        Cancelled:     int(p.counters.cancelled.Load()),
+        Expired:       int(p.counters.expired.Load()),
+        Workers:       p.size,
+        ActiveWorkers: int(p.counters.active.Load()),
+        Unhealthy:     int(p.counters.unhealthy.Load()),
+        Reconnects:    int(p.counters.reconnects.Load()),
+        Paused:        p.Paused(),
+        CircuitOpen:   p.circuitOpen(),
+    }
+}
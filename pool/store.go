@@ -0,0 +1,37 @@
+package pool
+
+import (
+    "context"
+)
+
+// Store is a single worker's connection to a database. Implementations for
+// particular databases live under the backends directory.
+type Store interface {
+    // Exec performs an operation, such as a backends.Insert, and returns
+    // its result if it has one. Stores return backends.ErrUnsupported for
+    // operations they don't know how to perform.
+    Exec(ctx context.Context, op any) (any, error)
+
+    // Ping checks the connection is still alive
+    Ping(ctx context.Context) error
+
+    // Close releases the connection
+    Close() error
+}
+
+// Connector establishes a Store for each of the pool's workers. Connect
+// makes a single attempt; it is called when each worker starts, and again
+// each time a job fails due to lost connectivity. If it fails the pool
+// keeps trying, backing off between attempts, until it succeeds or the
+// context is cancelled.
+type Connector interface {
+    Connect(ctx context.Context, workerId int) (Store, error)
+}
+
+// ConnectFunc adapts an ordinary function to the Connector interface
+type ConnectFunc func(ctx context.Context, workerId int) (Store, error)
+
+// Connect calls f(ctx, workerId)
+func (f ConnectFunc) Connect(ctx context.Context, workerId int) (Store, error) {
+    return f(ctx, workerId)
+}
@@ -0,0 +1,71 @@
+package pool
+
+import (
+    "errors"
+    "time"
+)
+
+// ErrExpired is the error reported for a job which waited longer than its
+// TTL for a worker, and so was failed rather than processed late
+var ErrExpired = errors.New("pool: job expired before it was processed")
+
+// Expiring is implemented by jobs with a TTL, which are only worth
+// processing if a worker takes them within that long of their being
+// queued, such as those a user is waiting on. A TTL of 0 means the job
+// doesn't expire, unless the pool was created WithTTL.
+type Expiring interface {
+    TTL() time.Duration
+}
+
+// TTL returns the job's TTL, or 0 if it isn't Expiring, for jobs which wrap
+// others to pass the TTL through
+func TTL(job any) time.Duration {
+    if expiring, ok := job.(Expiring); ok {
+        return expiring.TTL()
+    }
+    return 0
+}
+
+// WithTTL fails every job which waits longer than d on the queue with
+// ErrExpired, rather than processing it late, unless the job is Expiring
+// with a TTL of its own. A job's wait starts when it's placed onto the
+// queue: when it's submitted, when it comes due if it was submitted with
+// SubmitAt or is waiting to be retried, or when its dependencies have
+// succeeded. The default is 0, meaning only Expiring jobs expire.
+func WithTTL(d time.Duration) Option {
+    return func(c *config) {
+        c.ttl = d
+    }
+}
+
+// setExpiry sets when a task which is being placed onto a queue expires,
+// if it has a TTL
+func (p *Pool[J, R]) setExpiry(t *task[J]) {
+
+    ttl := p.ttl
+    if t.fn == nil {
+        if d := TTL(t.job); d > 0 {
+            ttl = d
+        }
+    }
+    if ttl > 0 {
+        t.expires = p.clock.Now().Add(ttl)
+    }
+
+}
+
+// expired reports whether a task a worker has taken waited too long for it.
+// Once a worker has taken a task in time it no longer expires, so a job the
+// worker goes on to retry itself isn't expired part way through.
+func (p *Pool[J, R]) expired(t *task[J]) bool {
+
+    if t.expires.IsZero() {
+        return false
+    }
+    if p.clock.Now().After(t.expires) {
+        return true
+    }
+    t.expires = time.Time{}
+    return false
+
+}
@@ -0,0 +1,48 @@
+package pool
+
+import (
+    "context"
+)
+
+// WarmUpFunc is run by each worker once it has connected, before it takes
+// any jobs, e.g. to verify the connection and make a few throwaway
+// queries so that connection setup doesn't count against the first jobs
+type WarmUpFunc func(ctx context.Context, deps Deps) error
+
+// warmUp runs the warm-up on a newly connected worker. A failed warm-up is
+// only logged, as any real problem with the connection will be dealt with
+// once the worker starts taking jobs.
+func (p *Pool[J, R]) warmUp(deps Deps) {
+    if p.warm == nil {
+        return
+    }
+    if err := p.warm(p.ctx, deps); err != nil {
+        p.logger.Printf("Worker %d: Warm-up failed (%s)", deps.WorkerId, err)
+    }
+}
+
+// Ready blocks until every worker has connected and finished warming up,
+// so that a caller timing the jobs can start the clock once the pool is
+// ready. Workers connecting lazily without a warm-up are ready straight
+// away. It returns early with an error if ctx is done or the pool is
+// cancelled or closed first.
+func (p *Pool[J, R]) Ready(ctx context.Context) error {
+
+    ready := make(chan struct{})
+    go func() {
+        p.ready.Wait()
+        close(ready)
+    }()
+
+    select {
+    case <-ready:
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    case <-p.ctx.Done():
+        return p.ctx.Err()
+    case <-p.quit:
+        return ErrClosed
+    }
+
+}
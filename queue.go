@@ -0,0 +1,111 @@
+package main
+
+import (
+    "context"
+    "errors"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+    "github.com/PaulMaddox/golang-db-pool-pattern/queue"
+)
+
+// JobQueue keeps the jobs which haven't finished in the --queue-file, so a
+// run which crashes can pick up where it left off. A nil jobQueue does
+// nothing, so that the jobs don't need to be kept.
+type jobQueue struct {
+    q *queue.Queue[jobSpec]
+}
+
+// QueuedJob is a job submitted from the --queue-file, which is marked done
+// when its result comes in
+type queuedJob struct {
+    pool.Job
+    Key uint64
+}
+
+// IdempotencyKey passes on the key of the job, for --dedup
+func (j queuedJob) IdempotencyKey() string {
+    return pool.IdempotencyKey(j.Job)
+}
+
+// RoutingKey passes on the key of the job, for --affinity
+func (j queuedJob) RoutingKey() string {
+    return pool.RoutingKey(j.Job)
+}
+
+// Group passes on the group of the job, for --fair
+func (j queuedJob) Group() string {
+    return pool.Group(j.Job)
+}
+
+// OpenJobQueue opens the --queue-file, returning the jobs left in it by an
+// earlier run which didn't finish
+func openJobQueue(path string) (*jobQueue, []jobSpec, error) {
+
+    q, err := queue.Open[jobSpec](path)
+    if err != nil {
+        return nil, nil, err
+    }
+    entries, err := q.Pending()
+    if err != nil {
+        q.Close()
+        return nil, nil, err
+    }
+    pending := make([]jobSpec, len(entries))
+    for i, e := range entries {
+        pending[i] = e.Value
+    }
+    return &jobQueue{q: q}, pending, nil
+
+}
+
+// Add records the jobs before they're submitted
+func (j *jobQueue) add(specs []jobSpec) error {
+
+    if j == nil {
+        return nil
+    }
+    entries := make([]queue.Entry[jobSpec], len(specs))
+    for i, s := range specs {
+        entries[i] = queue.Entry[jobSpec]{Key: uint64(s.Id), Value: s}
+    }
+    return j.q.Add(entries)
+
+}
+
+// Job creates the job to submit, which carries its key in the file
+func (j *jobQueue) job(s jobSpec) pool.Job {
+
+    if j == nil {
+        return s.job()
+    }
+    return queuedJob{Job: s.job(), Key: uint64(s.Id)}
+
+}
+
+// Finish unwraps the job a result is for, and marks it done unless it was
+// never processed, because the pool was drained or cancelled, in which
+// case it's left to be run again. It returns the id of the job's document:
+// the jobs are submitted in order, so otherwise it's the job's id.
+func (j *jobQueue) finish(ctx context.Context, result *pool.JobResult[pool.Job, struct{}]) (int, error) {
+
+    job, ok := result.Job.(queuedJob)
+    if !ok {
+        return result.JobId, nil
+    }
+    result.Job = job.Job
+    if errors.Is(result.Error, pool.ErrDrained) || ctx.Err() != nil {
+        return int(job.Key), nil
+    }
+    return int(job.Key), j.q.Done(job.Key)
+
+}
+
+// Close removes the finished jobs from the file and closes it
+func (j *jobQueue) close() error {
+
+    if j == nil {
+        return nil
+    }
+    return j.q.Close()
+
+}
@@ -0,0 +1,155 @@
+// Package queue keeps a durable record of the jobs submitted to a pool in a
+// BoltDB file until they've finished, so that if the process crashes the
+// jobs which were still queued or in flight can be submitted again when it
+// restarts, rather than lost.
+package queue
+
+import (
+    "encoding/binary"
+    "encoding/json"
+    "sync"
+
+    bolt "go.etcd.io/bbolt"
+)
+
+// DefaultFlushSize is how many finished jobs a Queue collects before
+// removing them from the file in one transaction
+const DefaultFlushSize = 1000
+
+// bucket is where the jobs are kept in the file
+var bucket = []byte("jobs")
+
+// Entry is a job in the queue, under a key which is unique within it
+type Entry[T any] struct {
+    Key   uint64
+    Value T
+}
+
+// Queue is a BoltDB file of the jobs which haven't finished yet, encoded
+// as JSON. Jobs are added before they're submitted to the pool, and marked
+// done once their result is in. Writing to the file is synced to disk, so
+// finished jobs are removed in batches of FlushSize: after a crash up to
+// that many jobs which did finish may be run again.
+type Queue[T any] struct {
+    FlushSize int
+
+    db *bolt.DB
+
+    // mu guards done, the keys of the jobs which have finished but are
+    // still in the file
+    mu   sync.Mutex
+    done []uint64
+}
+
+// Open opens the queue in the file at path, creating it if need be
+func Open[T any](path string) (*Queue[T], error) {
+
+    db, err := bolt.Open(path, 0600, nil)
+    if err != nil {
+        return nil, err
+    }
+    err = db.Update(func(tx *bolt.Tx) error {
+        _, err := tx.CreateBucketIfNotExists(bucket)
+        return err
+    })
+    if err != nil {
+        db.Close()
+        return nil, err
+    }
+    return &Queue[T]{FlushSize: DefaultFlushSize, db: db}, nil
+
+}
+
+// Add records jobs before they're submitted, all in one transaction
+func (q *Queue[T]) Add(entries []Entry[T]) error {
+
+    return q.db.Update(func(tx *bolt.Tx) error {
+        b := tx.Bucket(bucket)
+        for _, e := range entries {
+            value, err := json.Marshal(e.Value)
+            if err != nil {
+                return err
+            }
+            if err := b.Put(key(e.Key), value); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+
+}
+
+// Pending returns the jobs in the queue which haven't finished, in the
+// order of their keys, such as those left by a process which crashed
+func (q *Queue[T]) Pending() ([]Entry[T], error) {
+
+    var entries []Entry[T]
+    err := q.db.View(func(tx *bolt.Tx) error {
+        return tx.Bucket(bucket).ForEach(func(k, v []byte) error {
+            e := Entry[T]{Key: binary.BigEndian.Uint64(k)}
+            if err := json.Unmarshal(v, &e.Value); err != nil {
+                return err
+            }
+            entries = append(entries, e)
+            return nil
+        })
+    })
+    return entries, err
+
+}
+
+// Done marks a job as finished, removing it from the file along with the
+// others once FlushSize of them have finished
+func (q *Queue[T]) Done(k uint64) error {
+
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    q.done = append(q.done, k)
+    if len(q.done) < q.FlushSize {
+        return nil
+    }
+    return q.flush()
+
+}
+
+// Close removes the jobs which have finished from the file and closes it
+func (q *Queue[T]) Close() error {
+
+    q.mu.Lock()
+    err := q.flush()
+    q.mu.Unlock()
+    if cerr := q.db.Close(); err == nil {
+        err = cerr
+    }
+    return err
+
+}
+
+// flush removes the finished jobs from the file. The caller holds mu.
+func (q *Queue[T]) flush() error {
+
+    if len(q.done) == 0 {
+        return nil
+    }
+    err := q.db.Update(func(tx *bolt.Tx) error {
+        b := tx.Bucket(bucket)
+        for _, k := range q.done {
+            if err := b.Delete(key(k)); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+    if err == nil {
+        q.done = q.done[:0]
+    }
+    return err
+
+}
+
+// key encodes a job's key big-endian, so the file keeps them in order
+func key(k uint64) []byte {
+    b := make([]byte, 8)
+    binary.BigEndian.PutUint64(b, k)
+    return b
+}
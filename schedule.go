@@ -0,0 +1,31 @@
+package main
+
+import (
+    "context"
+    "log"
+    "time"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+    "github.com/robfig/cron/v3"
+)
+
+// RunSchedule submits a batch of --jobs jobs to the pool each time the
+// --cron schedule comes round, until the context is done, so the binary
+// can run as a long-lived daemon. Each batch works on the next set of
+// documents, as with --batches.
+func runSchedule(ctx context.Context, p *pool.Pool[pool.Job, struct{}], schedule cron.Schedule, blend *Mix) {
+
+    n := 0
+    s := pool.NewScheduler(p)
+    s.Add(schedule, func(at time.Time) []pool.Job {
+        n++
+        log.Printf("Starting batch %d, due at %s", n, at.Format(time.RFC3339))
+        return batchJobs(n-1, blend)
+    })
+    log.Printf("Next batch is due at %s", schedule.Next(time.Now()).Format(time.RFC3339))
+
+    if err := s.Run(ctx); err != nil && ctx.Err() == nil {
+        log.Printf("Stopped running on the schedule (%s)", err)
+    }
+
+}
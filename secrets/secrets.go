@@ -0,0 +1,78 @@
+// Package secrets looks up credentials at runtime, so that passwords never
+// need to appear on the command line where they are visible in ps
+package secrets
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "strings"
+)
+
+// Provider looks up a single secret, such as a database password. It's
+// called each time a connection is established, so rotated secrets are
+// picked up on the next reconnect.
+type Provider interface {
+    Secret(ctx context.Context) (string, error)
+}
+
+// Env reads the secret from an environment variable
+type Env struct {
+    Name string
+}
+
+// Secret returns the value of the environment variable
+func (e Env) Secret(ctx context.Context) (string, error) {
+    value, ok := os.LookupEnv(e.Name)
+    if !ok {
+        return "", fmt.Errorf("secrets: environment variable %s is not set", e.Name)
+    }
+    return value, nil
+}
+
+// File reads the secret from a file, such as a mounted Docker or
+// Kubernetes secret. A trailing newline is ignored.
+type File struct {
+    Path string
+}
+
+// Secret returns the contents of the file
+func (f File) Secret(ctx context.Context) (string, error) {
+    data, err := os.ReadFile(f.Path)
+    if err != nil {
+        return "", fmt.Errorf("secrets: %w", err)
+    }
+    return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Parse creates a Provider from a specification of the form "env:NAME",
+// "file:PATH" or "vault:PATH#KEY". Vault's address and token are taken
+// from the standard VAULT_ADDR and VAULT_TOKEN environment variables.
+func Parse(spec string) (Provider, error) {
+
+    kind, ref, ok := strings.Cut(spec, ":")
+    if !ok || ref == "" {
+        return nil, fmt.Errorf("secrets: invalid source %q, expected env:NAME, file:PATH or vault:PATH#KEY", spec)
+    }
+
+    switch kind {
+    case "env":
+        return Env{Name: ref}, nil
+    case "file":
+        return File{Path: ref}, nil
+    case "vault":
+        path, key, ok := strings.Cut(ref, "#")
+        if !ok || key == "" {
+            return nil, fmt.Errorf("secrets: invalid vault source %q, expected vault:PATH#KEY", spec)
+        }
+        return &Vault{
+            Address: os.Getenv("VAULT_ADDR"),
+            Token:   os.Getenv("VAULT_TOKEN"),
+            Path:    path,
+            Key:     key,
+        }, nil
+    }
+
+    return nil, fmt.Errorf("secrets: unknown source %q, expected env, file or vault", kind)
+
+}
@@ -0,0 +1,77 @@
+package secrets
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strings"
+)
+
+// Vault reads the secret from a HashiCorp Vault KV secrets engine, using
+// its HTTP API. Both versions of the KV engine are supported; for version
+// 2 the Path includes the engine's data/ prefix, e.g. secret/data/db.
+type Vault struct {
+    // Address is Vault's URL, e.g. https://vault.example.com:8200
+    Address string
+
+    // Token authenticates the request
+    Token string
+
+    // Path is the secret's path, and Key the field within it to return
+    Path string
+    Key  string
+
+    // Client makes the request, defaulting to http.DefaultClient
+    Client *http.Client
+}
+
+// Secret fetches the secret from Vault
+func (v *Vault) Secret(ctx context.Context) (string, error) {
+
+    if v.Address == "" {
+        return "", fmt.Errorf("secrets: no Vault address, set VAULT_ADDR")
+    }
+
+    url := strings.TrimRight(v.Address, "/") + "/v1/" + strings.TrimLeft(v.Path, "/")
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+    if err != nil {
+        return "", fmt.Errorf("secrets: %w", err)
+    }
+    req.Header.Set("X-Vault-Token", v.Token)
+
+    client := v.Client
+    if client == nil {
+        client = http.DefaultClient
+    }
+    resp, err := client.Do(req)
+    if err != nil {
+        return "", fmt.Errorf("secrets: %w", err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return "", fmt.Errorf("secrets: reading %s from Vault: %s", v.Path, resp.Status)
+    }
+
+    // Version 1 of the KV engine returns the fields in data, and version 2
+    // nests them in data.data alongside the secret's metadata
+    var body struct {
+        Data map[string]any `json:"data"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+        return "", fmt.Errorf("secrets: reading %s from Vault: %w", v.Path, err)
+    }
+    fields := body.Data
+    if nested, ok := fields["data"].(map[string]any); ok {
+        if _, ok := fields["metadata"]; ok {
+            fields = nested
+        }
+    }
+
+    value, ok := fields[v.Key].(string)
+    if !ok {
+        return "", fmt.Errorf("secrets: %s has no key %s in Vault", v.Path, v.Key)
+    }
+    return value, nil
+
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "log"
+    "strings"
+    "time"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+    "github.com/PaulMaddox/golang-db-pool-pattern/sources"
+    "github.com/spf13/pflag"
+)
+
+// Each source_*.go file defines a job source's options and registers it in
+// an init function, the same way as the backends
+
+// DescribeSources lists the registered sources in --source's usage
+func describeSources() {
+    flag := pflag.Lookup("source")
+    flag.Usage = "Receive the jobs from this queue, shared with other processes, rather than generating them, or with --enqueue publish them to it: " + strings.Join(sources.Names(), ", ")
+}
+
+// SourcedJob is a job received from the --source, which is marked done
+// there when its result comes in
+type sourcedJob struct {
+    pool.Job
+    Delivery *sources.Delivery
+}
+
+// IdempotencyKey passes on the key of the job, for --dedup
+func (j sourcedJob) IdempotencyKey() string {
+    return pool.IdempotencyKey(j.Job)
+}
+
+// RoutingKey passes on the key of the job, for --affinity
+func (j sourcedJob) RoutingKey() string {
+    return pool.RoutingKey(j.Job)
+}
+
+// Group passes on the group of the job, for --fair
+func (j sourcedJob) Group() string {
+    return pool.Group(j.Job)
+}
+
+// PublishJobs publishes every batch of jobs to the --source, for the
+// processes receiving from it to run, as the specs the jobs are created
+// from. Those processes need the same options for the documents, such as
+// --template and --seed, to create the same jobs.
+func publishJobs(ctx context.Context, src sources.Source, blend *Mix) error {
+
+    for n := 0; n < *batches; n++ {
+        specs := batchSpecs(n, blend)
+        bodies := make([][]byte, len(specs))
+        for i, s := range specs {
+            body, err := json.Marshal(s)
+            if err != nil {
+                return err
+            }
+            bodies[i] = body
+        }
+        if err := src.Publish(ctx, bodies); err != nil {
+            return err
+        }
+        log.Printf("Published batch %d of %d jobs to %s", n+1, len(specs), *source)
+    }
+    return nil
+
+}
+
+// ConsumeSource submits a job to the pool for each one received from the
+// --source until the context is done, backing off while it can't be
+// reached
+func consumeSource(ctx context.Context, p *pool.Pool[pool.Job, struct{}], src sources.Source) {
+
+    for attempt := 1; ; {
+
+        d, err := src.Receive(ctx)
+        if ctx.Err() != nil {
+            return
+        }
+        if err != nil {
+            delay := pool.DefaultBackoff.Delay(attempt)
+            log.Printf("Unable to receive jobs from %s, retrying in %s (%s)", *source, delay, err)
+            attempt++
+            select {
+            case <-time.After(delay):
+            case <-ctx.Done():
+                return
+            }
+            continue
+        }
+        attempt = 1
+
+        var s jobSpec
+        if err := json.Unmarshal(d.Body, &s); err != nil {
+            log.Printf("Discarding a job from %s which can't be decoded (%s)", *source, err)
+            d.Done(err)
+            continue
+        }
+        if _, err := p.Submit(sourcedJob{Job: s.job(), Delivery: d}); err != nil {
+            return
+        }
+
+    }
+
+}
+
+// Acknowledge unwraps the job a result is for, and if it came from the
+// --source marks it done there, unless the pool was drained or cancelled
+// before it was processed, so it's delivered again
+func acknowledge(ctx context.Context, result *pool.JobResult[pool.Job, struct{}]) error {
+
+    job, ok := result.Job.(sourcedJob)
+    if !ok {
+        return nil
+    }
+    result.Job = job.Job
+    if result.Error == pool.ErrDrained || ctx.Err() != nil {
+        return nil
+    }
+    return job.Delivery.Done(result.Error)
+
+}
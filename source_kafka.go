@@ -0,0 +1,28 @@
+package main
+
+import (
+    "strings"
+    "time"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/sources"
+    "github.com/PaulMaddox/golang-db-pool-pattern/sources/kafka"
+    "github.com/spf13/pflag"
+)
+
+// The Kafka source's options, which bootstraps from the Kafka backend's
+// --kafka-brokers
+var kafkaSourceTopic *string = pflag.String("kafka-source-topic", kafka.DefaultTopic, "The Kafka topic --source=kafka publishes and receives jobs on")
+var kafkaGroup *string = pflag.String("kafka-group", kafka.DefaultGroup, "The consumer group the processes receiving jobs from --source=kafka share")
+var kafkaCommitInterval *time.Duration = pflag.Duration("kafka-commit-interval", kafka.DefaultCommitInterval, "How often --source=kafka commits the offsets of the jobs which have finished")
+
+// Register the Kafka source, chosen with --source=kafka
+func init() {
+    sources.Register("kafka", func() (sources.Source, error) {
+        return &kafka.Source{
+            Brokers:        strings.Split(*kafkaBrokers, ","),
+            Topic:          *kafkaSourceTopic,
+            Group:          *kafkaGroup,
+            CommitInterval: *kafkaCommitInterval,
+        }, nil
+    })
+}
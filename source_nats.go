@@ -0,0 +1,25 @@
+package main
+
+import (
+    "github.com/PaulMaddox/golang-db-pool-pattern/sources"
+    "github.com/PaulMaddox/golang-db-pool-pattern/sources/nats"
+    "github.com/spf13/pflag"
+)
+
+// NATS's options
+var natsURL *string = pflag.String("nats-url", "nats://127.0.0.1:4222", "The NATS server, or comma separated list of servers, --source=nats connects to")
+var natsSubject *string = pflag.String("nats-subject", nats.DefaultSubject, "The NATS subject --source=nats publishes and receives jobs on")
+var natsQueue *string = pflag.String("nats-queue", nats.DefaultQueue, "The queue group the processes receiving jobs from --source=nats share")
+var natsResults *string = pflag.String("nats-results", "", "A NATS subject to publish each job's result to, as JSON of the job and its error (default is not to)")
+
+// Register the NATS source, chosen with --source=nats
+func init() {
+    sources.Register("nats", func() (sources.Source, error) {
+        return &nats.Source{
+            URL:     *natsURL,
+            Subject: *natsSubject,
+            Queue:   *natsQueue,
+            Results: *natsResults,
+        }, nil
+    })
+}
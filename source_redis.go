@@ -0,0 +1,30 @@
+package main
+
+import (
+    "strings"
+    "time"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/sources"
+    "github.com/PaulMaddox/golang-db-pool-pattern/sources/redis"
+    "github.com/spf13/pflag"
+)
+
+// The Redis source's options, which connects with the Redis backend's
+var redisStream *string = pflag.String("redis-stream", redis.DefaultStream, "The Redis stream --source=redis publishes and receives jobs on")
+var redisGroup *string = pflag.String("redis-group", redis.DefaultGroup, "The consumer group the processes receiving jobs from --source=redis share")
+var redisClaimIdle *time.Duration = pflag.Duration("redis-claim-idle", redis.DefaultClaimIdle, "Run the jobs from --source=redis again if the process they were delivered to hasn't finished them after this long, e.g. because it crashed")
+
+// Register the Redis stream source, chosen with --source=redis
+func init() {
+    sources.Register("redis", func() (sources.Source, error) {
+        return &redis.Source{
+            Addrs:     strings.Split(*redisAddrs, ","),
+            Password:  *redisPassword,
+            DB:        *redisDB,
+            Stream:    *redisStream,
+            Group:     *redisGroup,
+            BatchSize: redis.DefaultBatchSize,
+            ClaimIdle: *redisClaimIdle,
+        }, nil
+    })
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+    "time"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/sources"
+    "github.com/PaulMaddox/golang-db-pool-pattern/sources/sqs"
+    "github.com/spf13/pflag"
+)
+
+// SQS's options
+var sqsQueue *string = pflag.String("sqs-queue", sqs.DefaultQueue, "The name or URL of the SQS queue --source=sqs publishes and receives jobs on")
+var sqsRegion *string = pflag.String("sqs-region", "", "The AWS region of the SQS queue (default is the one configured in the environment)")
+var sqsEndpoint *string = pflag.String("sqs-endpoint", "", "Send requests to this endpoint instead of SQS's, e.g. http://localhost:9324 for ElasticMQ")
+var sqsVisibilityTimeout *time.Duration = pflag.Duration("sqs-visibility-timeout", sqs.DefaultVisibilityTimeout, "How long a job from --source=sqs is hidden from other processes, which is extended while it's held and runs out if the process holding it crashes")
+
+// Register the SQS source, chosen with --source=sqs
+func init() {
+    sources.Register("sqs", func() (sources.Source, error) {
+        return &sqs.Source{
+            Region:            *sqsRegion,
+            Endpoint:          *sqsEndpoint,
+            Queue:             *sqsQueue,
+            VisibilityTimeout: *sqsVisibilityTimeout,
+        }, nil
+    })
+}
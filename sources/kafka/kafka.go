@@ -0,0 +1,180 @@
+// Package kafka implements a Source of jobs on a Kafka topic, which the
+// processes receiving jobs consume as a consumer group
+package kafka
+
+import (
+    "context"
+    "log"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/sources"
+    kafkago "github.com/segmentio/kafka-go"
+)
+
+// Defaults for a Source's options
+const (
+    DefaultTopic          = "jobs"
+    DefaultGroup          = "workers"
+    DefaultCommitInterval = time.Second
+)
+
+// Source is a Kafka topic with a message for each job. The processes
+// receiving jobs are members of a consumer group, so each partition, and
+// so each job, goes to just one of them. Jobs finish out of order, so a
+// partition's offset is only committed up to the oldest job fetched from
+// it which hasn't finished: a process which crashes or loses a partition
+// to a rebalance leaves the jobs after that to be fetched, and run, again,
+// so each job runs at least once. Failed jobs have already been retried by
+// the pool, so they're committed too rather than blocking their partition.
+type Source struct {
+    // Brokers are the host:port addresses of the brokers to bootstrap from
+    Brokers []string
+
+    // Topic is where jobs are published, and Group the consumer group
+    // the processes receiving them belong to
+    Topic string
+    Group string
+
+    // CommitInterval is how often offsets are committed
+    CommitInterval time.Duration
+
+    mu         sync.Mutex
+    writer     *kafkago.Writer
+    reader     *kafkago.Reader
+    partitions map[int]*partition
+}
+
+// Partition tracks the offsets fetched from a partition which haven't been
+// committed yet, in the order they were fetched
+type partition struct {
+    offsets []int64
+    done    map[int64]bool
+}
+
+// Publish sends a message for each job, and waits for every in-sync
+// replica to have them
+func (s *Source) Publish(ctx context.Context, bodies [][]byte) error {
+
+    s.mu.Lock()
+    if s.writer == nil {
+        s.writer = &kafkago.Writer{
+            Addr:                   kafkago.TCP(s.Brokers...),
+            Topic:                  s.Topic,
+            Balancer:               &kafkago.RoundRobin{},
+            RequiredAcks:           kafkago.RequireAll,
+            AllowAutoTopicCreation: true,
+        }
+    }
+    writer := s.writer
+    s.mu.Unlock()
+
+    msgs := make([]kafkago.Message, len(bodies))
+    for i, body := range bodies {
+        msgs[i] = kafkago.Message{Value: body}
+    }
+    return writer.WriteMessages(ctx, msgs...)
+
+}
+
+// Receive returns the next job fetched from one of the partitions assigned
+// to this process, joining the group the first time it's called
+func (s *Source) Receive(ctx context.Context) (*sources.Delivery, error) {
+
+    s.mu.Lock()
+    if s.reader == nil {
+        log.Printf("Connecting to %s for the %s topic", strings.Join(s.Brokers, ","), s.Topic)
+        s.reader = kafkago.NewReader(kafkago.ReaderConfig{
+            Brokers:        s.Brokers,
+            Topic:          s.Topic,
+            GroupID:        s.Group,
+            CommitInterval: s.CommitInterval,
+            StartOffset:    kafkago.FirstOffset,
+        })
+        s.partitions = map[int]*partition{}
+    }
+    reader := s.reader
+    s.mu.Unlock()
+
+    msg, err := reader.FetchMessage(ctx)
+    if err != nil {
+        return nil, err
+    }
+    s.fetched(msg)
+    return &sources.Delivery{
+        Body: msg.Value,
+        Done: func(error) error {
+            return s.commit(context.WithoutCancel(ctx), reader, msg)
+        },
+    }, nil
+
+}
+
+// Fetched adds a message's offset to those waiting to be committed for its
+// partition. An offset no later than one already waiting means the group
+// has rebalanced and the partition is being consumed again from its last
+// commit, so the offsets waiting from before are forgotten.
+func (s *Source) fetched(msg kafkago.Message) {
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    p := s.partitions[msg.Partition]
+    if p == nil || (len(p.offsets) > 0 && msg.Offset <= p.offsets[len(p.offsets)-1]) {
+        p = &partition{done: map[int64]bool{}}
+        s.partitions[msg.Partition] = p
+    }
+    p.offsets = append(p.offsets, msg.Offset)
+
+}
+
+// Commit records that a message's job has finished, and commits its
+// partition's offset past every message before it whose job has finished
+// too
+func (s *Source) commit(ctx context.Context, reader *kafkago.Reader, msg kafkago.Message) error {
+
+    s.mu.Lock()
+    p := s.partitions[msg.Partition]
+    if p == nil {
+        s.mu.Unlock()
+        return nil
+    }
+    p.done[msg.Offset] = true
+    committed := int64(-1)
+    for len(p.offsets) > 0 && p.done[p.offsets[0]] {
+        committed = p.offsets[0]
+        delete(p.done, committed)
+        p.offsets = p.offsets[1:]
+    }
+    s.mu.Unlock()
+
+    if committed < 0 {
+        return nil
+    }
+    msg.Offset = committed
+    return reader.CommitMessages(ctx, msg)
+
+}
+
+// Close leaves the group, committing the offsets which are due, and closes
+// the producer
+func (s *Source) Close() error {
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var err error
+    if s.reader != nil {
+        err = s.reader.Close()
+        s.reader = nil
+    }
+    if s.writer != nil {
+        if werr := s.writer.Close(); err == nil {
+            err = werr
+        }
+        s.writer = nil
+    }
+    return err
+
+}
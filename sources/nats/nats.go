@@ -0,0 +1,178 @@
+// Package nats implements a Source of jobs on a NATS subject, which the
+// processes receiving jobs subscribe to as a queue group
+package nats
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "log"
+    "os"
+    "sync"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/sources"
+    natsgo "github.com/nats-io/nats.go"
+)
+
+// Defaults for a Source's options
+const (
+    DefaultSubject = "jobs"
+    DefaultQueue   = "workers"
+)
+
+// Result is published for each job once it's done, if the Source has a
+// Results subject, carrying the job and its error as the JobResult does
+type Result struct {
+    Job   json.RawMessage `json:"job"`
+    Error string          `json:"error,omitempty"`
+}
+
+// Source is a NATS subject jobs are published to, one message per job.
+// The processes receiving them subscribe as a queue group, so each job
+// goes to just one of them. Plain NATS delivers each message at most once:
+// jobs published while no process is subscribed, or delivered to one which
+// crashes, are lost.
+type Source struct {
+    // URL is the server, or a comma separated list of servers, to connect to
+    URL string
+
+    // Subject is where jobs are published, and Queue the queue group the
+    // processes receiving them belong to
+    Subject string
+    Queue   string
+
+    // Results is the subject a Result is published to for each job, if
+    // it's set, so that the producer or a monitor can follow progress.
+    // Jobs published as requests are replied to with their Result too.
+    Results string
+
+    mu   sync.Mutex
+    conn *natsgo.Conn
+    sub  *natsgo.Subscription
+}
+
+// Publish sends a message for each job, and waits for the server to have
+// received them all
+func (s *Source) Publish(ctx context.Context, bodies [][]byte) error {
+
+    conn, err := s.dial()
+    if err != nil {
+        return err
+    }
+    for _, body := range bodies {
+        if err := conn.Publish(s.Subject, body); err != nil {
+            return err
+        }
+    }
+    return conn.FlushWithContext(ctx)
+
+}
+
+// Receive returns the next job delivered to this process's subscription,
+// subscribing the first time it's called
+func (s *Source) Receive(ctx context.Context) (*sources.Delivery, error) {
+
+    conn, err := s.dial()
+    if err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    if s.sub == nil {
+        s.sub, err = conn.QueueSubscribeSync(s.Subject, s.Queue)
+        if err == nil {
+            // Jobs wait in the subscription until the pool has room for
+            // them, however many there are
+            err = s.sub.SetPendingLimits(-1, -1)
+        }
+    }
+    sub := s.sub
+    s.mu.Unlock()
+    if err != nil {
+        return nil, err
+    }
+
+    msg, err := sub.NextMsgWithContext(ctx)
+    if err != nil {
+        return nil, err
+    }
+    return &sources.Delivery{
+        Body: msg.Data,
+        Done: func(err error) error {
+            return s.result(conn, msg, err)
+        },
+    }, nil
+
+}
+
+// result publishes the Result of a job to the Results subject, and replies
+// with it if the job was a request
+func (s *Source) result(conn *natsgo.Conn, msg *natsgo.Msg, err error) error {
+
+    if s.Results == "" && msg.Reply == "" {
+        return nil
+    }
+    result := Result{Job: msg.Data}
+    if !json.Valid(msg.Data) {
+        result.Job, _ = json.Marshal(string(msg.Data))
+    }
+    if err != nil {
+        result.Error = err.Error()
+    }
+    data, err := json.Marshal(result)
+    if err != nil {
+        return err
+    }
+
+    if msg.Reply != "" {
+        if err := msg.Respond(data); err != nil {
+            return err
+        }
+    }
+    if s.Results != "" {
+        return conn.Publish(s.Results, data)
+    }
+    return nil
+
+}
+
+// Close unsubscribes, sends any Results which are still buffered and closes
+// the connection
+func (s *Source) Close() error {
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if s.conn == nil {
+        return nil
+    }
+    if s.sub != nil {
+        s.sub.Unsubscribe()
+        s.sub = nil
+    }
+    err := s.conn.FlushTimeout(natsgo.DefaultTimeout)
+    s.conn.Close()
+    s.conn = nil
+    return err
+
+}
+
+// Dial connects the first time it's needed, reconnecting for as long as
+// it takes if the connection is lost after that
+func (s *Source) dial() (*natsgo.Conn, error) {
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if s.conn == nil {
+        log.Printf("Connecting to %s for the %s subject", s.URL, s.Subject)
+        host, _ := os.Hostname()
+        conn, err := natsgo.Connect(s.URL, natsgo.Name(fmt.Sprintf("%s-%d", host, os.Getpid())), natsgo.MaxReconnects(-1))
+        if err != nil {
+            return nil, err
+        }
+        s.conn = conn
+    }
+    return s.conn, nil
+
+}
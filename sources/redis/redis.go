@@ -0,0 +1,194 @@
+// Package redis implements a Source of jobs on a Redis stream, which the
+// processes receiving jobs read from as a consumer group
+package redis
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "os"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/sources"
+    goredis "github.com/redis/go-redis/v9"
+)
+
+// Defaults for a Source's options
+const (
+    DefaultStream    = "jobs"
+    DefaultGroup     = "workers"
+    DefaultBatchSize = 100
+    DefaultClaimIdle = time.Minute
+)
+
+// Source is a Redis stream of jobs. Each job is a stream entry, and the
+// processes receiving them are consumers in a group, so each job goes to
+// just one of them. A job is acknowledged once it's done, and jobs which
+// are left unacknowledged for ClaimIdle, because the consumer they were
+// delivered to crashed, are claimed by another consumer and run again.
+type Source struct {
+    // Addrs is a single host:port, or the seed nodes of a cluster, and
+    // Password and DB select the credentials and database number to use
+    Addrs    []string
+    Password string
+    DB       int
+
+    // Stream is the key of the stream, and Group the consumer group the
+    // processes receiving jobs belong to, which is created if need be
+    Stream string
+    Group  string
+
+    // Consumer names this process within the group, by default its host
+    // name and process id
+    Consumer string
+
+    // BatchSize is how many jobs are fetched from the stream at a time
+    BatchSize int
+
+    // ClaimIdle is how long a job can go unacknowledged before another
+    // consumer claims it
+    ClaimIdle time.Duration
+
+    mu       sync.Mutex
+    client   goredis.UniversalClient
+    grouped  bool
+    buffered []goredis.XMessage
+}
+
+// Publish adds the jobs to the end of the stream, in a single pipeline
+func (s *Source) Publish(ctx context.Context, bodies [][]byte) error {
+
+    s.mu.Lock()
+    client := s.dial()
+    s.mu.Unlock()
+
+    pipe := client.Pipeline()
+    for _, body := range bodies {
+        pipe.XAdd(ctx, &goredis.XAddArgs{Stream: s.Stream, Values: []any{"job", body}})
+    }
+    _, err := pipe.Exec(ctx)
+    return err
+
+}
+
+// Receive returns the next job for this consumer, first claiming any jobs
+// which other consumers left unacknowledged, then reading new ones
+func (s *Source) Receive(ctx context.Context) (*sources.Delivery, error) {
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for len(s.buffered) == 0 {
+        if err := s.fetch(ctx); err != nil {
+            return nil, err
+        }
+    }
+
+    client := s.client
+    msg := s.buffered[0]
+    s.buffered = s.buffered[1:]
+    body, _ := msg.Values["job"].(string)
+    return &sources.Delivery{
+        Body: []byte(body),
+        Done: func(err error) error {
+            // Failed jobs have already been retried by the pool, so they're
+            // acknowledged too rather than being run again forever
+            return client.XAck(context.WithoutCancel(ctx), s.Stream, s.Group, msg.ID).Err()
+        },
+    }, nil
+
+}
+
+// Fetch fills the buffer with jobs left idle by other consumers, or else
+// with new jobs, waiting a few seconds for them to arrive
+func (s *Source) fetch(ctx context.Context) error {
+
+    client := s.dial()
+    if !s.grouped {
+        err := client.XGroupCreateMkStream(ctx, s.Stream, s.Group, "0").Err()
+        if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+            return err
+        }
+        s.grouped = true
+    }
+
+    claimed, _, err := client.XAutoClaim(ctx, &goredis.XAutoClaimArgs{
+        Stream:   s.Stream,
+        Group:    s.Group,
+        Consumer: s.consumer(),
+        MinIdle:  s.ClaimIdle,
+        Start:    "0-0",
+        Count:    int64(s.BatchSize),
+    }).Result()
+    if err != nil {
+        return err
+    }
+    if len(claimed) > 0 {
+        log.Printf("Claimed %d jobs left unacknowledged on %s", len(claimed), s.Stream)
+        s.buffered = claimed
+        return nil
+    }
+
+    streams, err := client.XReadGroup(ctx, &goredis.XReadGroupArgs{
+        Group:    s.Group,
+        Consumer: s.consumer(),
+        Streams:  []string{s.Stream, ">"},
+        Count:    int64(s.BatchSize),
+        Block:    5 * time.Second,
+    }).Result()
+    if errors.Is(err, goredis.Nil) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    for _, stream := range streams {
+        s.buffered = append(s.buffered, stream.Messages...)
+    }
+    return nil
+
+}
+
+// Close closes the client
+func (s *Source) Close() error {
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if s.client == nil {
+        return nil
+    }
+    err := s.client.Close()
+    s.client = nil
+    return err
+
+}
+
+// Dial creates the client the first time it's needed. The caller holds mu.
+func (s *Source) dial() goredis.UniversalClient {
+
+    if s.client == nil {
+        log.Printf("Connecting to redis://%s/%d for the %s stream", strings.Join(s.Addrs, ","), s.DB, s.Stream)
+        s.client = goredis.NewUniversalClient(&goredis.UniversalOptions{
+            Addrs:    s.Addrs,
+            Password: s.Password,
+            DB:       s.DB,
+        })
+    }
+    return s.client
+
+}
+
+// Consumer returns the name of this process within the group
+func (s *Source) consumer() string {
+
+    if s.Consumer == "" {
+        host, _ := os.Hostname()
+        s.Consumer = fmt.Sprintf("%s-%d", host, os.Getpid())
+    }
+    return s.Consumer
+
+}
@@ -0,0 +1,91 @@
+// Package sources defines queues of jobs shared by several processes, so
+// that producers and pools of workers can run on different machines: one
+// process publishes the jobs, and any number of others each receive a
+// share of them to run on their own pool. The queues themselves are
+// implemented in its subpackages.
+package sources
+
+import (
+    "context"
+    "fmt"
+    "sort"
+    "strings"
+    "sync"
+)
+
+// Source is a queue of jobs, each encoded as a message body. Jobs which
+// are received but not done, e.g. because the process receiving them
+// crashed, are delivered again, to the same process or another.
+type Source interface {
+    // Publish adds jobs to the queue
+    Publish(ctx context.Context, bodies [][]byte) error
+
+    // Receive blocks until a job is delivered, or ctx is done
+    Receive(ctx context.Context) (*Delivery, error)
+
+    Close() error
+}
+
+// Delivery is a job received from a Source
+type Delivery struct {
+    Body []byte
+
+    // Done tells the Source the job has finished, with the error it
+    // failed with if it did, so that it can be removed from the queue or
+    // delivered again
+    Done func(err error) error
+}
+
+// Factory configures a source, typically from flags or the environment
+type Factory func() (Source, error)
+
+var (
+    registryMu sync.RWMutex
+    registry   = map[string]Factory{}
+)
+
+// Register makes a source available by name to Open. It's usually called
+// from an init function, and panics if the name is already registered.
+func Register(name string, factory Factory) {
+
+    registryMu.Lock()
+    defer registryMu.Unlock()
+
+    if factory == nil {
+        panic("sources: Register factory is nil for " + name)
+    }
+    if _, ok := registry[name]; ok {
+        panic("sources: Register called twice for " + name)
+    }
+    registry[name] = factory
+
+}
+
+// Open configures the named source using its registered Factory
+func Open(name string) (Source, error) {
+
+    registryMu.RLock()
+    factory, ok := registry[name]
+    registryMu.RUnlock()
+
+    if !ok {
+        return nil, fmt.Errorf("sources: unknown source %q, expected one of %s", name, strings.Join(Names(), ", "))
+    }
+    return factory()
+
+}
+
+// Names returns the names of the registered sources, sorted
+func Names() []string {
+
+    registryMu.RLock()
+    defer registryMu.RUnlock()
+
+    names := make([]string, 0, len(registry))
+    for name := range registry {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+
+}
@@ -0,0 +1,264 @@
+// Package sqs implements a Source of jobs on an AWS SQS queue, which the
+// processes receiving jobs all poll
+package sqs
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/sources"
+    "github.com/aws/aws-sdk-go-v2/aws"
+    "github.com/aws/aws-sdk-go-v2/config"
+    "github.com/aws/aws-sdk-go-v2/service/sqs"
+    "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// Defaults for a Source's options
+const (
+    DefaultQueue             = "jobs"
+    DefaultVisibilityTimeout = 30 * time.Second
+)
+
+// BatchSize is the most messages SQS sends, receives or changes the
+// visibility of in one request
+const batchSize = 10
+
+// Source is an SQS queue with a message for each job. A message received
+// by one process is hidden from the others for VisibilityTimeout, which is
+// extended for as long as the process holds the job, however long it
+// takes to run, and the message is deleted once its job has succeeded.
+// Failed jobs have already been retried by the pool, so their messages are
+// left to become visible again once the timeout runs out, to be received
+// again or moved to a dead-letter queue by the queue's redrive policy, as
+// are those of a process which crashes.
+type Source struct {
+    // Region is the AWS region of the queue, by default the one configured
+    // in the environment, and Endpoint overrides SQS's, e.g. for ElasticMQ
+    // or LocalStack
+    Region   string
+    Endpoint string
+
+    // Queue is the name of the queue, which is created if need be, or its URL
+    Queue string
+
+    // VisibilityTimeout is how long a received message is hidden from
+    // other processes before it's extended
+    VisibilityTimeout time.Duration
+
+    mu       sync.Mutex
+    client   *sqs.Client
+    url      string
+    buffered []types.Message
+    stop     chan struct{}
+    extender sync.WaitGroup
+
+    // held maps the ids of the messages this process has received but not
+    // finished to their receipt handles
+    heldMu sync.Mutex
+    held   map[string]string
+}
+
+// Publish sends a message for each job, ten to a request
+func (s *Source) Publish(ctx context.Context, bodies [][]byte) error {
+
+    client, url, err := s.dial(ctx)
+    if err != nil {
+        return err
+    }
+
+    for start := 0; start < len(bodies); start += batchSize {
+        var entries []types.SendMessageBatchRequestEntry
+        for i, body := range bodies[start:min(start+batchSize, len(bodies))] {
+            entries = append(entries, types.SendMessageBatchRequestEntry{
+                Id:          aws.String(strconv.Itoa(i)),
+                MessageBody: aws.String(string(body)),
+            })
+        }
+        out, err := client.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{QueueUrl: aws.String(url), Entries: entries})
+        if err != nil {
+            return err
+        }
+        if len(out.Failed) > 0 {
+            return fmt.Errorf("sqs: %d jobs weren't sent to %s: %s", len(out.Failed), s.Queue, aws.ToString(out.Failed[0].Message))
+        }
+    }
+    return nil
+
+}
+
+// Receive returns the next job received from the queue, long polling for
+// more when the ones already received have all been returned
+func (s *Source) Receive(ctx context.Context) (*sources.Delivery, error) {
+
+    client, url, err := s.dial(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if s.stop == nil {
+        s.stop = make(chan struct{})
+        s.extender.Add(1)
+        go s.extend(client, url, s.stop)
+    }
+    for len(s.buffered) == 0 {
+        out, err := client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+            QueueUrl:            aws.String(url),
+            MaxNumberOfMessages: batchSize,
+            VisibilityTimeout:   s.timeout(),
+            WaitTimeSeconds:     20,
+        })
+        if err != nil {
+            return nil, err
+        }
+        s.heldMu.Lock()
+        for _, msg := range out.Messages {
+            s.held[aws.ToString(msg.MessageId)] = aws.ToString(msg.ReceiptHandle)
+        }
+        s.heldMu.Unlock()
+        s.buffered = out.Messages
+    }
+
+    msg := s.buffered[0]
+    s.buffered = s.buffered[1:]
+    return &sources.Delivery{
+        Body: []byte(aws.ToString(msg.Body)),
+        Done: func(err error) error {
+            s.heldMu.Lock()
+            delete(s.held, aws.ToString(msg.MessageId))
+            s.heldMu.Unlock()
+            if err != nil {
+                return nil
+            }
+            _, err = client.DeleteMessage(context.WithoutCancel(ctx), &sqs.DeleteMessageInput{
+                QueueUrl:      aws.String(url),
+                ReceiptHandle: msg.ReceiptHandle,
+            })
+            return err
+        },
+    }, nil
+
+}
+
+// Extend keeps the messages this process holds hidden from the others,
+// extending their visibility timeout a few times before it runs out until
+// stop is closed
+func (s *Source) extend(client *sqs.Client, url string, stop chan struct{}) {
+
+    defer s.extender.Done()
+
+    ticker := time.NewTicker(time.Duration(s.timeout()) * time.Second / 3)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ticker.C:
+        case <-stop:
+            return
+        }
+
+        s.heldMu.Lock()
+        var entries []types.ChangeMessageVisibilityBatchRequestEntry
+        for id, handle := range s.held {
+            entries = append(entries, types.ChangeMessageVisibilityBatchRequestEntry{
+                Id:                aws.String(id),
+                ReceiptHandle:     aws.String(handle),
+                VisibilityTimeout: s.timeout(),
+            })
+        }
+        s.heldMu.Unlock()
+
+        for start := 0; start < len(entries); start += batchSize {
+            out, err := client.ChangeMessageVisibilityBatch(context.Background(), &sqs.ChangeMessageVisibilityBatchInput{
+                QueueUrl: aws.String(url),
+                Entries:  entries[start:min(start+batchSize, len(entries))],
+            })
+            if err != nil {
+                log.Printf("Unable to extend the visibility timeout of jobs from %s: %s", s.Queue, err)
+                break
+            }
+            // Jobs which finished in the meantime have been deleted
+            if len(out.Failed) > 0 {
+                log.Printf("Unable to extend the visibility timeout of %d jobs from %s: %s", len(out.Failed), s.Queue, aws.ToString(out.Failed[0].Message))
+            }
+        }
+    }
+
+}
+
+// Timeout returns the visibility timeout in seconds, as SQS takes it
+func (s *Source) timeout() int32 {
+    return int32(max(s.VisibilityTimeout.Round(time.Second), time.Second) / time.Second)
+}
+
+// Close stops extending the visibility timeout of the messages this
+// process still holds, so they're received again once it runs out
+func (s *Source) Close() error {
+
+    s.mu.Lock()
+    stop := s.stop
+    s.stop = nil
+    s.mu.Unlock()
+
+    if stop != nil {
+        close(stop)
+        s.extender.Wait()
+    }
+    return nil
+
+}
+
+// Dial creates the client, and finds the queue's URL, creating it if need
+// be, the first time it's needed
+func (s *Source) dial(ctx context.Context) (*sqs.Client, string, error) {
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if s.client != nil {
+        return s.client, s.url, nil
+    }
+
+    var opts []func(*config.LoadOptions) error
+    if s.Region != "" {
+        opts = append(opts, config.WithRegion(s.Region))
+    }
+    cfg, err := config.LoadDefaultConfig(ctx, opts...)
+    if err != nil {
+        return nil, "", err
+    }
+    log.Printf("Connecting to SQS in %s for the %s queue", cfg.Region, s.Queue)
+    client := sqs.NewFromConfig(cfg, func(o *sqs.Options) {
+        if s.Endpoint != "" {
+            o.BaseEndpoint = aws.String(s.Endpoint)
+        }
+    })
+
+    url := s.Queue
+    if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+        out, err := client.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(s.Queue)})
+        var missing *types.QueueDoesNotExist
+        if errors.As(err, &missing) {
+            created, err := client.CreateQueue(ctx, &sqs.CreateQueueInput{QueueName: aws.String(s.Queue)})
+            if err != nil {
+                return nil, "", err
+            }
+            url = aws.ToString(created.QueueUrl)
+        } else if err != nil {
+            return nil, "", err
+        } else {
+            url = aws.ToString(out.QueueUrl)
+        }
+    }
+
+    s.client, s.url, s.held = client, url, map[string]string{}
+    return client, url, nil
+
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "hash/fnv"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "text/template"
+)
+
+// docs renders the jobs' documents from the --template, if there is one
+var docs *docTemplate
+
+// DocTemplate renders each job's document from a text/template of JSON,
+// such as {"sku": "item-{{.JobId}}", "price": {{.JobId}}}, instead of using
+// a User, so that users can benchmark their own schemas. The file can also
+// {{define}} a "filter" template, the JSON query which finds the document
+// again for reads, updates, upserts and deletes, a "key" template, its
+// key in key-value stores (default is the job id), and a "shard" template,
+// the number of the --collections the document goes in, such as
+// {{mod (hash .User.Email) 4}}, so they're spread by a shard key rather
+// than by job id.
+type docTemplate struct {
+    doc    *template.Template
+    filter *template.Template
+    key    *template.Template
+    shard  *template.Template
+}
+
+// TemplateData is what the templates are executed with
+type templateData struct {
+    JobId int
+
+    // User is the User the job would have used without a template
+    User User
+}
+
+// LoadTemplate parses the template file
+func loadTemplate(path string) (*docTemplate, error) {
+
+    funcs := template.FuncMap{"json": toJSON, "hash": hash, "mod": mod}
+    t, err := template.New(filepath.Base(path)).Funcs(funcs).ParseFiles(path)
+    if err != nil {
+        return nil, err
+    }
+    return &docTemplate{doc: t, filter: t.Lookup("filter"), key: t.Lookup("key"), shard: t.Lookup("shard")}, nil
+
+}
+
+// Target renders the document for the job with the given id, and how to
+// find it again. A read expects the document it finds to have the same
+// top-level string, number and boolean fields, and an update sets all of
+// the fields not in the filter.
+func (d *docTemplate) target(id int) (target, error) {
+
+    data := templateData{JobId: id, User: NewUser(id)}
+    t := target{Key: strconv.Itoa(id), Expect: map[string]any{}, Set: map[string]any{}}
+
+    doc := map[string]any{}
+    if err := render(d.doc, data, &doc); err != nil {
+        return t, err
+    }
+    t.Document = doc
+    if d.filter != nil {
+        if err := render(d.filter, data, &t.Filter); err != nil {
+            return t, err
+        }
+    }
+    if d.key != nil {
+        var key bytes.Buffer
+        if err := d.key.Execute(&key, data); err != nil {
+            return t, err
+        }
+        t.Key = strings.TrimSpace(key.String())
+    }
+    if d.shard != nil {
+        var shard int
+        if err := render(d.shard, data, &shard); err != nil {
+            return t, err
+        }
+        t.Collection = collectionFor(shard)
+    }
+
+    for field, value := range doc {
+        switch value.(type) {
+        case string, float64, bool:
+            t.Expect[field] = value
+        }
+        if _, ok := t.Filter[field]; !ok {
+            t.Set[field] = value
+        }
+    }
+    return t, nil
+
+}
+
+// Render executes the template and decodes the JSON it produces into v
+func render(t *template.Template, data templateData, v any) error {
+
+    var out bytes.Buffer
+    if err := t.Execute(&out, data); err != nil {
+        return err
+    }
+    if err := json.Unmarshal(out.Bytes(), v); err != nil {
+        return fmt.Errorf("template %s: %w in %s", t.Name(), err, out.String())
+    }
+    return nil
+
+}
+
+// ToJSON encodes a value for the templates' json function
+func toJSON(v any) (string, error) {
+    b, err := json.Marshal(v)
+    return string(b), err
+}
+
+// Hash returns the FNV-1a hash of a value for the templates' hash function,
+// which spreads shard keys evenly
+func hash(v any) uint32 {
+
+    h := fnv.New32a()
+    fmt.Fprint(h, v)
+    return h.Sum32()
+
+}
+
+// Mod returns a modulo b for the templates' mod function, which accepts
+// the results of hash and arithmetic on the job id
+func mod(a any, b int) (int, error) {
+
+    if b <= 0 {
+        return 0, fmt.Errorf("mod by %d", b)
+    }
+    switch a := a.(type) {
+    case int:
+        return (a%b + b) % b, nil
+    case uint32:
+        return int(a % uint32(b)), nil
+    }
+    return 0, fmt.Errorf("mod of %T", a)
+
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "log"
+    "math/rand"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+)
+
+// Sample picks the ids of n of the documents inserted at random, as their
+// inserts succeed, without having to keep the ids of all of them
+type sample struct {
+    ids  []int
+    seen int
+    rand *rand.Rand
+}
+
+// NewSample creates a sample of up to n ids, chosen the same way on every
+// run with the same --seed
+func newSample(n int) *sample {
+    return &sample{ids: make([]int, 0, n), rand: rand.New(rand.NewSource(*seed))}
+}
+
+// Add offers the id of another document which was inserted to the sample
+func (s *sample) add(id int) {
+
+    s.seen++
+    if len(s.ids) < cap(s.ids) {
+        s.ids = append(s.ids, id)
+    } else if i := s.rand.Intn(s.seen); i < len(s.ids) {
+        s.ids[i] = id
+    }
+
+}
+
+// Verify checks the database against the jobs' results once the inserts
+// are done, over a connection of its own: it counts the documents in the
+// users collections, which should be at least the number inserted, and
+// reads back each of the sample to check it's there as it was inserted.
+// It returns whether any discrepancies were found.
+func verify(ctx context.Context, connect pool.Connector, inserted int, ids []int) (bool, error) {
+
+    conn, err := connect.Connect(ctx, 0)
+    if err != nil {
+        return false, err
+    }
+    defer conn.Close()
+
+    // Documents left by earlier runs make the count higher than the
+    // number inserted, so only a shortfall is certainly wrong
+    ok := true
+    var count int64
+    for _, collection := range collectionNames() {
+        n, err := conn.Exec(ctx, backends.Count{Collection: collection})
+        if errors.Is(err, backends.ErrUnsupported) {
+            log.Printf("Verify: %s can't count documents, only reading back the sample", *backend)
+            count = -1
+            break
+        }
+        if err != nil {
+            return false, err
+        }
+        count += n.(int64)
+    }
+    if count >= 0 {
+        log.Printf("Verify: counted %d documents, %d inserts succeeded", count, inserted)
+    }
+    if count >= 0 && count < int64(inserted) {
+        log.Printf("Verify: %d documents are missing", int64(inserted)-count)
+        ok = false
+    } else if count > int64(inserted) {
+        log.Printf("Verify: %d more documents than were inserted, from earlier runs or inserts reported as failed", count-int64(inserted))
+    }
+
+    missing := 0
+    mismatched := 0
+    for _, id := range ids {
+        err := newJob("read", id).Execute(ctx, pool.Deps{Conn: conn})
+        switch {
+        case errors.Is(err, backends.ErrNotFound):
+            missing++
+            log.Printf("Verify: document %d is missing", id)
+        case errors.Is(err, errMismatch):
+            mismatched++
+            log.Printf("Verify: document %d %s", id, err)
+        case err != nil:
+            return false, err
+        }
+    }
+    log.Printf("Verify: read back %d documents, %d were missing and %d did not match", len(ids), missing, mismatched)
+    return ok && missing == 0 && mismatched == 0, nil
+
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "log"
+
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends"
+    "github.com/PaulMaddox/golang-db-pool-pattern/backends/mongo"
+    "github.com/PaulMaddox/golang-db-pool-pattern/pool"
+)
+
+// WatchChanges follows the change stream of the --watch collection, in the
+// MongoDB database configured by the MongoDB options, and submits a job to
+// the pool for each change until the context is done
+func watchChanges(ctx context.Context, p *pool.Pool[pool.Job, struct{}]) {
+
+    w := &mongo.Watcher{Connector: mongoConnector(), Collection: *watch, Backoff: pool.DefaultBackoff}
+    defer w.Connector.Close()
+
+    err := w.Watch(ctx, func(change mongo.Change) error {
+        _, err := p.Submit(ChangeJob{Change: change})
+        return err
+    })
+    if err != nil {
+        log.Printf("Stopped watching %s (%s)", *watch, err)
+    }
+
+}
+
+// ChangeJob records a change made to a MongoDB collection in the changes
+// collection of the backend, keyed by the change's resume token so that a
+// change delivered twice can be recognised
+type ChangeJob struct {
+    Change mongo.Change
+}
+
+// Execute records the change using the worker's store
+func (j ChangeJob) Execute(ctx context.Context, deps pool.Deps) error {
+    _, err := deps.Conn.Exec(ctx, backends.Insert{Collection: "changes", Key: j.Change.ID, Document: map[string]any{
+        "id":         j.Change.ID,
+        "operation":  j.Change.Operation,
+        "collection": j.Change.Collection,
+        "key":        j.Change.Key,
+        "document":   j.Change.Document,
+        "time":       j.Change.Time,
+    }})
+    return err
+}
+
+// RoutingKey identifies the document which changed, so that with --affinity
+// the changes to it are recorded in the order they were made
+func (j ChangeJob) RoutingKey() string {
+    return documentKey(j.Change.Collection, fmt.Sprint(j.Change.Key))
+}
+
+// Group is the collection which changed, for --fair
+func (j ChangeJob) Group() string {
+    return j.Change.Collection
+}